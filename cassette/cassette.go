@@ -0,0 +1,151 @@
+// Package cassette records requests the plugin makes to Azure into files and serves them back,
+// it is used to reproduce issues offline and to turn real sessions into spec fixtures.
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces tokens and secrets in recorded interactions
+const Redacted = "REDACTED"
+
+// Interaction is a request to Azure and a response to it, every interaction is kept in its own file
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request to Azure
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response of Azure
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// secretHeaders are replaced in both requests and responses
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// secretFields are replaced in form and JSON bodies, names are compared case insensitively
+var secretFields = map[string]bool{
+	"access_token":     true,
+	"refresh_token":    true,
+	"id_token":         true,
+	"client_secret":    true,
+	"client_assertion": true,
+	"password":         true,
+	"adminpassword":    true,
+	"customdata":       true,
+	"key1":             true,
+	"key2":             true,
+	"primarykey":       true,
+	"secondarykey":     true,
+}
+
+func redactHeaders(headers http.Header) http.Header {
+	result := make(http.Header, len(headers))
+	for name, values := range headers {
+		result[name] = append([]string(nil), values...)
+	}
+	for _, name := range secretHeaders {
+		if result.Get(name) != "" {
+			result.Set(name, Redacted)
+		}
+	}
+	return result
+}
+
+// redactBody replaces secrets in form and JSON bodies, other bodies are kept as is
+func redactBody(body string, contentType string) string {
+	if body == "" {
+		return body
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(body)
+		if err != nil {
+			return body
+		}
+		for name := range values {
+			if secretFields[strings.ToLower(name)] {
+				values.Set(name, Redacted)
+			}
+		}
+		return values.Encode()
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return body
+	}
+	b, err := json.Marshal(RedactJSON(v))
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+// RedactJSON replaces secrets in decoded JSON value, maps and slices are modified in place
+func RedactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// storage account keys: {"keyName": "key1", "value": "...", "permissions": "Full"}
+		_, isKey := v["keyName"]
+		for name, value := range v {
+			if secretFields[strings.ToLower(name)] || (isKey && name == "value") {
+				v[name] = Redacted
+			} else {
+				v[name] = RedactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = RedactJSON(value)
+		}
+	}
+	return v
+}
+
+var uuidRegexp = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// matchKey identifies request regardless of host and generated IDs: recorded interactions
+// could be replayed against another endpoint, ex: ghttp server of specs, and role assignments get new UUIDs every time
+func matchKey(method string, u *url.URL) string {
+	path := uuidRegexp.ReplaceAllString(strings.ToLower(u.Path), "{uuid}")
+	return fmt.Sprintf("%s %s?%s", strings.ToUpper(method), path, u.Query().Encode())
+}
+
+// Load reads interactions recorded into the directory in the order they were recorded
+func Load(dir string) ([]*Interaction, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	interactions := make([]*Interaction, 0, len(files))
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(b, &interaction); err != nil {
+			return nil, fmt.Errorf("invalid cassette file %s: %v", file, err)
+		}
+		interactions = append(interactions, &interaction)
+	}
+	return interactions, nil
+}
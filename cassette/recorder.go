@@ -0,0 +1,91 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Recorder is a http.RoundTripper which writes every request and response into the directory with secrets redacted
+type Recorder struct {
+	// Transport sends requests to Azure
+	Transport http.RoundTripper
+	// Dir is a directory interactions are written to
+	Dir string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewRecorder creates recorder, interactions are added after the ones already recorded into the directory
+func NewRecorder(dir string, transport http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Transport: transport, Dir: dir, seq: len(files)}, nil
+}
+
+// RoundTrip sends request and records it along with the response, failed requests are not recorded
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: Request{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: redactHeaders(req.Header),
+			Body:    redactBody(string(reqBody), req.Header.Get("Content-Type")),
+		},
+		Response: Response{
+			Status:  resp.StatusCode,
+			Headers: redactHeaders(resp.Header),
+			Body:    redactBody(string(respBody), resp.Header.Get("Content-Type")),
+		},
+	}
+	if err := r.write(interaction); err != nil {
+		return nil, fmt.Errorf("unable to record interaction: %v", err)
+	}
+	return resp, nil
+}
+
+// write saves interaction into '<sequence number>_<method>.json' file
+func (r *Recorder) write(interaction *Interaction) error {
+	b, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	name := fmt.Sprintf("%06d_%s.json", r.seq, strings.ToLower(interaction.Request.Method))
+	return ioutil.WriteFile(filepath.Join(r.Dir, name), b, 0600)
+}
@@ -0,0 +1,93 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Replayer is a http.RoundTripper which serves recorded interactions instead of sending requests to Azure.
+// Requests are matched by method, path and query, identical requests get responses in the order they were recorded
+// and the last one is repeated after that, ex: polling of async operation.
+type Replayer struct {
+	mu           sync.Mutex
+	interactions map[string][]*Interaction
+	// served is a number of served interactions per request
+	served map[string]int
+}
+
+// NewReplayer loads interactions recorded into the directory
+func NewReplayer(dir string) (*Replayer, error) {
+	interactions, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &Replayer{interactions: make(map[string][]*Interaction), served: make(map[string]int)}
+	for _, interaction := range interactions {
+		u, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL of recorded request %s: %v", interaction.Request.URL, err)
+		}
+		key := matchKey(interaction.Request.Method, u)
+		r.interactions[key] = append(r.interactions[key], interaction)
+	}
+	return r, nil
+}
+
+// RoundTrip returns recorded response, requests which were not recorded get 501 response
+// since it is not retried and its body is shown to the user like any other error of Azure
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	key := matchKey(req.Method, req.URL)
+	r.mu.Lock()
+	interactions := r.interactions[key]
+	var interaction *Interaction
+	if len(interactions) > 0 {
+		i := r.served[key]
+		if i >= len(interactions) {
+			i = len(interactions) - 1
+		}
+		interaction = interactions[i]
+		r.served[key] = i + 1
+	}
+	r.mu.Unlock()
+
+	if interaction == nil {
+		b, _ := json.Marshal(map[string]interface{}{
+			"error": map[string]string{
+				"code":    "InteractionNotRecorded",
+				"message": fmt.Sprintf("Request %s %s is not recorded.", req.Method, req.URL.String()),
+			},
+		})
+		return newResponse(req, http.StatusNotImplemented, http.Header{"Content-Type": {"application/json"}}, string(b)), nil
+	}
+	headers := make(http.Header, len(interaction.Response.Headers))
+	for name, values := range interaction.Response.Headers {
+		headers[name] = append([]string(nil), values...)
+	}
+	return newResponse(req, interaction.Response.Status, headers, interaction.Response.Body), nil
+}
+
+func newResponse(req *http.Request, status int, headers http.Header, body string) *http.Response {
+	// body could be changed by redaction
+	headers.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+// apiVersions is a registry of Azure API versions keyed by resource provider namespace or resource type,
+// version of the closest parent type is used if resource type is not listed
+var apiVersions = map[string]string{
+	"Microsoft.Authorization":                "2014-10-01-preview",
+	"Microsoft.Compute":                      "2016-03-30",
+	"Microsoft.Compute/locations/operations": "2015-05-01-preview",
+	"Microsoft.Insights":                     "2014-04-01",
+	"Microsoft.Network":                      "2016-03-30",
+	"Microsoft.Network/locations/operations": "2015-06-15",
+	"Microsoft.Resources":                    "2016-02-01",
+	"Microsoft.Resources/operationResults":   "2015-11-01",
+	"Microsoft.Resources/providers":          "2015-01-01",
+	"Microsoft.Resources/subscriptions":      "2015-01-01",
+	"Microsoft.Storage":                      "2016-01-01",
+	"Microsoft.Storage/operations":           "2015-06-15",
+}
+
+// APIVersion returns Azure API version for the given resource type, ex: Microsoft.Network/virtualNetworks/subnets
+func APIVersion(resourceType string) string {
+	key := strings.ToLower(resourceType)
+	for {
+		for t, version := range apiVersions {
+			if strings.ToLower(t) == key {
+				return version
+			}
+		}
+		i := strings.LastIndex(key, "/")
+		if i < 0 {
+			Logger.Error("API version is not configured:", "type", resourceType)
+			return ""
+		}
+		key = key[:i]
+	}
+}
+
+// loadAPIVersions overrides default API versions by ones from JSON file:
+// {"Microsoft.Network": "2016-09-01", "Microsoft.Compute/virtualMachines": "2016-04-30-preview"}
+func loadAPIVersions(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	versions := make(map[string]string)
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return err
+	}
+	for resourceType, version := range versions {
+		for t := range apiVersions {
+			if strings.EqualFold(t, resourceType) {
+				delete(apiVersions, t)
+			}
+		}
+		apiVersions[resourceType] = version
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API versions", func() {
+
+	var dir string
+	var defaults map[string]string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "api_versions")
+		Expect(err).NotTo(HaveOccurred())
+		defaults = make(map[string]string, len(apiVersions))
+		for t, version := range apiVersions {
+			defaults[t] = version
+		}
+	})
+
+	AfterEach(func() {
+		apiVersions = defaults
+		os.RemoveAll(dir)
+	})
+
+	writeFile := func(content string) string {
+		path := filepath.Join(dir, "api_versions.json")
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+		return path
+	}
+
+	It("uses version of the closest parent type", func() {
+		Ω(APIVersion("Microsoft.Network/virtualNetworks/subnets")).Should(Equal(defaults["Microsoft.Network"]))
+		Ω(APIVersion("microsoft.network/locations/operations")).Should(Equal(defaults["Microsoft.Network/locations/operations"]))
+	})
+
+	It("overrides versions by ones loaded from file", func() {
+		Expect(loadAPIVersions(writeFile(`{"microsoft.network": "2016-09-01", "Microsoft.Compute/virtualMachines": "2016-04-30-preview"}`))).To(Succeed())
+		Ω(APIVersion("Microsoft.Network/virtualNetworks")).Should(Equal("2016-09-01"))
+		Ω(APIVersion("Microsoft.Network/locations/operations")).Should(Equal(defaults["Microsoft.Network/locations/operations"]))
+		Ω(APIVersion("Microsoft.Compute/virtualMachines")).Should(Equal("2016-04-30-preview"))
+		Ω(APIVersion("Microsoft.Compute/availabilitySets")).Should(Equal(defaults["Microsoft.Compute"]))
+		Ω(apiVersions).ShouldNot(HaveKey("Microsoft.Network"))
+	})
+
+	It("fails to load malformed file", func() {
+		Ω(loadAPIVersions(writeFile(`{"Microsoft.Network": 2016}`))).ShouldNot(Succeed())
+		Ω(APIVersion("Microsoft.Network")).Should(Equal(defaults["Microsoft.Network"]))
+	})
+
+	It("fails to load missing file", func() {
+		Ω(loadAPIVersions(filepath.Join(dir, "missing.json"))).ShouldNot(Succeed())
+	})
+})
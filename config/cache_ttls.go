@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cacheTTLs are lifetimes of cached Azure lookups keyed by endpoint
+var cacheTTLs = map[string]time.Duration{
+	"images":         24 * time.Hour,
+	"instance_types": 24 * time.Hour,
+	"locations":      24 * time.Hour,
+	"providers":      time.Hour,
+	"subscription":   time.Hour,
+}
+
+// CacheTTL returns lifetime of cached responses of the endpoint, 0 is returned if the endpoint is not cached
+func CacheTTL(endpoint string) time.Duration {
+	return cacheTTLs[endpoint]
+}
+
+// CacheEndpoints returns sorted names of cached endpoints
+func CacheEndpoints() []string {
+	var endpoints []string
+	for endpoint := range cacheTTLs {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// parseCacheTTLs overrides default lifetimes of cached responses: "locations=12h,providers=30m",
+// zero lifetime disables caching of the endpoint
+func parseCacheTTLs(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected 'endpoint=ttl', got '%s'", pair)
+		}
+		endpoint := strings.TrimSpace(parts[0])
+		if _, ok := cacheTTLs[endpoint]; !ok {
+			return fmt.Errorf("unknown endpoint '%s'", endpoint)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || ttl < 0 {
+			return fmt.Errorf("invalid TTL of endpoint '%s': %s", endpoint, parts[1])
+		}
+		cacheTTLs[endpoint] = ttl
+	}
+	return nil
+}
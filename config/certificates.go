@@ -0,0 +1,39 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// CertificateProfile references certificate used for authentication of service principal
+type CertificateProfile struct {
+	// Path is a path to PEM or PKCS#12 file with certificate and private key
+	Path string `json:"path"`
+	// Password is a password of PKCS#12 file
+	Password string `json:"password"`
+	// TenantID and ClientID identify the only service principal the certificate could be used for
+	TenantID string `json:"tenant_id"`
+	ClientID string `json:"client_id"`
+}
+
+// CertificateProfiles could be selected via 'CertificateProfile' cookie, they are loaded from file passed via 'certificate_profiles' flag
+var CertificateProfiles = make(map[string]CertificateProfile)
+
+// loadCertificateProfiles loads profiles from JSON file:
+// {"production": {"path": "/etc/azure_plugin/production.pfx", "password": "secret", "tenant_id": "...", "client_id": "..."}}
+func loadCertificateProfiles(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &CertificateProfiles); err != nil {
+		return err
+	}
+	for name, profile := range CertificateProfiles {
+		if profile.Path == "" || profile.TenantID == "" || profile.ClientID == "" {
+			return fmt.Errorf("'path', 'tenant_id' and 'client_id' are required in profile '%s'", name)
+		}
+	}
+	return nil
+}
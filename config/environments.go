@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Environment represents set of endpoints of Azure cloud
+type Environment struct {
+	Name               string `json:"name"`
+	ResourceManagerURL string `json:"resource_manager_url"`
+	GraphURL           string `json:"graph_url"`
+	AuthHost           string `json:"auth_host"`
+	// TokenAudience is a resource access token is requested for
+	TokenAudience string `json:"token_audience"`
+	// StorageSuffix is DNS suffix of storage endpoints, ex: core.windows.net
+	StorageSuffix string `json:"storage_suffix"`
+}
+
+// environments are known Azure clouds, custom ones could be added via 'cloud_file' flag
+var environments = map[string]*Environment{
+	"public": {
+		Name:               "public",
+		ResourceManagerURL: "https://management.azure.com",
+		GraphURL:           "https://graph.windows.net",
+		AuthHost:           "https://login.windows.net",
+		TokenAudience:      "https://management.core.windows.net/",
+		StorageSuffix:      "core.windows.net",
+	},
+	"usgov": {
+		Name:               "usgov",
+		ResourceManagerURL: "https://management.usgovcloudapi.net",
+		GraphURL:           "https://graph.windows.net",
+		AuthHost:           "https://login.microsoftonline.us",
+		TokenAudience:      "https://management.core.usgovcloudapi.net/",
+		StorageSuffix:      "core.usgovcloudapi.net",
+	},
+	"china": {
+		Name:               "china",
+		ResourceManagerURL: "https://management.chinacloudapi.cn",
+		GraphURL:           "https://graph.chinacloudapi.cn",
+		AuthHost:           "https://login.chinacloudapi.cn",
+		TokenAudience:      "https://management.core.chinacloudapi.cn/",
+		StorageSuffix:      "core.chinacloudapi.cn",
+	},
+	"germany": {
+		Name:               "germany",
+		ResourceManagerURL: "https://management.microsoftazure.de",
+		GraphURL:           "https://graph.cloudapi.de",
+		AuthHost:           "https://login.microsoftonline.de",
+		TokenAudience:      "https://management.core.cloudapi.de/",
+		StorageSuffix:      "core.cloudapi.de",
+	},
+}
+
+// GetEnvironment returns Azure cloud by name, the cloud selected by 'cloud' flag is returned for empty name.
+// Endpoints of the default cloud are taken from BaseURL, GraphURL and AuthHost vars to be able to modify them in the specs.
+func GetEnvironment(name string) (*Environment, error) {
+	if name == "" || strings.EqualFold(name, *Cloud) {
+		env := *environments[strings.ToLower(*Cloud)]
+		env.ResourceManagerURL = BaseURL
+		env.GraphURL = GraphURL
+		env.AuthHost = AuthHost
+		return &env, nil
+	}
+	env, ok := environments[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud '%s'", name)
+	}
+	return env, nil
+}
+
+// loadEnvironments adds custom clouds from JSON file:
+// [{"name": "azurestack", "resource_manager_url": "https://management.local.azurestack.external", ...}]
+func loadEnvironments(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var envs []*Environment
+	if err := json.Unmarshal(b, &envs); err != nil {
+		return err
+	}
+	for _, env := range envs {
+		if err := AddEnvironment(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddEnvironment registers custom Azure cloud
+func AddEnvironment(env *Environment) error {
+	if env.Name == "" || env.ResourceManagerURL == "" || env.AuthHost == "" || env.TokenAudience == "" {
+		return fmt.Errorf("name, resource_manager_url, auth_host and token_audience are required for every cloud")
+	}
+	environments[strings.ToLower(env.Name)] = env
+	return nil
+}
+
+// setupEnvironment sets endpoints of the cloud selected by 'cloud' flag
+func setupEnvironment() error {
+	if *CloudFile != "" {
+		if err := loadEnvironments(*CloudFile); err != nil {
+			return err
+		}
+	}
+	env, ok := environments[strings.ToLower(*Cloud)]
+	if !ok {
+		return fmt.Errorf("unknown cloud '%s'", *Cloud)
+	}
+	BaseURL = env.ResourceManagerURL
+	GraphURL = env.GraphURL
+	AuthHost = env.AuthHost
+	return nil
+}
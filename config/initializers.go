@@ -15,13 +15,12 @@ import (
 
 const (
 	version = "0.0.1"
-	// APIVersion is a default Azure API version
-	// TODO: remove this const or introduce api version per service
-	APIVersion = "2014-12-01-Preview"
 	// MediaType is default media type for requests to the Azure cloud
 	MediaType = "application/json"
 	// UserAgent is a RS request sign
 	UserAgent = "RightScale Self-Service Plugin"
+	// GenerateCATCommand prints RightScale CAT with namespace of the plugin resources instead of serving requests
+	GenerateCATCommand = "generate-cat"
 	// SyslogAddr is the address to use for connecting to syslog.
 	SyslogAddr = "syslog:514"
 	// ApplicationName is, you know, the name of the application
@@ -38,6 +37,81 @@ var (
 	AppPrefix = app.Flag("prefix", "URL prefix.").Default("").String()
 	// LogType could be: stdout or syslog
 	LogType = app.Flag("log_type", "Type of Logger.").Default("stdout").String()
+	// RetryMaxAttempts is a maximum number of attempts for every request to Azure
+	RetryMaxAttempts = app.Flag("retry_max_attempts", "Maximum number of attempts for throttled or failed requests to Azure.").Default("4").Int()
+	// RetryBaseDelay is a base delay of exponential backoff between attempts
+	RetryBaseDelay = app.Flag("retry_base_delay", "Base delay of exponential backoff between attempts, e.g. '500ms'.").Default("500ms").Duration()
+	// RetryMaxDelay is a maximum delay between attempts, it also limits delay requested by Azure in 'Retry-After' header
+	RetryMaxDelay = app.Flag("retry_max_delay", "Maximum delay between attempts, e.g. '30s'.").Default("30s").Duration()
+	// TokenRefreshMargin is a period before expiration when cached access token is refreshed
+	TokenRefreshMargin = app.Flag("token_refresh_margin", "Period before expiration when cached access token is refreshed, e.g. '5m'.").Default("5m").Duration()
+	// OperationSecret is a key used to sign operation tokens, random key is generated on start if it is not passed
+	OperationSecret = app.Flag("operation_secret", "Key used to sign async operation tokens. Random key is generated on start if it is empty.").Default("").String()
+	// SessionKey is a key used to encrypt and sign credential sessions, random key is generated on start if it is not passed
+	SessionKey = app.Flag("session_key", "Key used to encrypt and sign credential sessions. Random key is generated on start if it is empty.").Default("").String()
+	// SessionStore is a type of credential sessions store
+	SessionStore = app.Flag("session_store", "Store of credential sessions: 'memory' (default) or 'file'.").Default("memory").String()
+	// SessionDir is a directory used by file store of credential sessions
+	SessionDir = app.Flag("session_dir", "Directory used by file store of credential sessions.").Default("/var/lib/azure_plugin/sessions").String()
+	// SessionTTL is a lifetime of credential sessions
+	SessionTTL = app.Flag("session_ttl", "Lifetime of credential sessions, e.g. '1h'.").Default("1h").Duration()
+	// FanOutConcurrency is a maximum number of concurrent requests made to list child resources of every parent
+	FanOutConcurrency = app.Flag("fan_out_concurrency", "Maximum number of concurrent requests to Azure made to list child resources of all parents, e.g. subnets of all networks.").Default("8").Int()
+	// FanOutTimeout is a timeout of every request made to list child resources of a parent
+	FanOutTimeout = app.Flag("fan_out_timeout", "Timeout of every request to Azure made to list child resources of a parent, e.g. '30s'.").Default("30s").Duration()
+	// ImageIndexDir is a directory crawled catalogs of VM images are kept in
+	ImageIndexDir = app.Flag("image_index_dir", "Directory crawled catalogs of VM images are kept in.").Default("/var/lib/azure_plugin/images").String()
+	// ImageIndexTTL is a period after which catalog of VM images is crawled again in background
+	ImageIndexTTL = app.Flag("image_index_ttl", "Period after which catalog of VM images is crawled again in background, e.g. '24h'.").Default("24h").Duration()
+	// ImageCrawlConcurrency is a maximum number of concurrent requests made by crawler of VM images
+	ImageCrawlConcurrency = app.Flag("image_crawl_concurrency", "Maximum number of concurrent requests to Azure made by crawler of VM images.").Default("8").Int()
+	// CacheBackend is a type of cache of rarely changing Azure lookups
+	CacheBackend = app.Flag("cache_backend", "Cache of rarely changing Azure lookups, e.g. locations and VM sizes: 'memory' (default), 'redis' or 'none'.").Default("memory").String()
+	// CacheSize is a maximum number of entries kept by in-memory cache
+	CacheSize = app.Flag("cache_size", "Maximum number of entries kept by in-memory cache, least recently used ones are evicted.").Default("1000").Int()
+	// CacheRedisAddr is an address of Redis server used by 'redis' cache
+	CacheRedisAddr = app.Flag("cache_redis_addr", "Address of Redis compatible server used by 'redis' cache.").Default("localhost:6379").String()
+	// CacheTTLs overrides default lifetimes of cached responses per endpoint
+	CacheTTLs = app.Flag("cache_ttls", "Lifetimes of cached responses overriding default ones per endpoint, e.g. 'locations=12h,providers=30m'.").Default("").String()
+	// CacheAdminKey is a key which allows to invalidate cached responses of all subscriptions
+	CacheAdminKey = app.Flag("cache_admin_key", "Key passed in 'X-Admin-Key' header to invalidate cached responses of all subscriptions.").Default("").String()
+	// IdempotencyTTL is a period outcomes of POST requests passing 'Idempotency-Key' header are kept for
+	IdempotencyTTL = app.Flag("idempotency_ttl", "Period outcomes of POST requests passing 'Idempotency-Key' header are replayed to their retries for, e.g. '24h'.").Default("24h").Duration()
+	// AuditSink is a sink audit events of mutating calls are written to
+	AuditSink = app.Flag("audit_sink", "Sink audit events of mutating calls are written to: 'none' (default), 'file', 'syslog' or 'webhook'.").Default("none").String()
+	// AuditFile is a path to JSON-lines file used by 'file' audit sink
+	AuditFile = app.Flag("audit_file", "Path to JSON-lines file audit events are appended to by 'file' sink.").Default("/var/log/azure_plugin/audit.log").String()
+	// AuditWebhook is a URL audit events are posted to by 'webhook' audit sink
+	AuditWebhook = app.Flag("audit_webhook", "URL audit events are posted to by 'webhook' sink, e.g. 'https://audit.example.com/events'.").Default("").String()
+	// APIVersionsFile is a path to JSON file with Azure API versions
+	APIVersionsFile = app.Flag("api_versions", "Path to JSON file with Azure API versions per resource provider or resource type.").Default("").String()
+	// Cloud is a name of Azure cloud used by default: public, usgov, china, germany or custom one from 'cloud_file'
+	Cloud = app.Flag("cloud", "Azure cloud used by default: 'public' (default), 'usgov', 'china', 'germany' or custom one from 'cloud_file'.").Default("public").String()
+	// CloudFile is a path to JSON file with endpoints of custom Azure clouds
+	CloudFile = app.Flag("cloud_file", "Path to JSON file with endpoints of custom Azure clouds.").Default("").String()
+	// CertificatePath is a path to PEM or PKCS#12 file with certificate used if client secret is not passed
+	CertificatePath = app.Flag("certificate", "Path to PEM or PKCS#12 file with certificate used for authentication of the service principal passed via 'certificate_tenant_id' and 'certificate_client_id' flags if client secret is not passed.").Default("").String()
+	// CertificatePassword is a password of PKCS#12 file passed via 'certificate' flag
+	CertificatePassword = app.Flag("certificate_password", "Password of PKCS#12 file passed via 'certificate' flag.").Default("").String()
+	// CertificateTenantID and CertificateClientID identify the only service principal certificate passed via 'certificate' flag could be used for
+	CertificateTenantID = app.Flag("certificate_tenant_id", "Tenant ID of the service principal certificate passed via 'certificate' flag is used for, required along with 'certificate' flag.").Default("").String()
+	CertificateClientID = app.Flag("certificate_client_id", "Client ID of the service principal certificate passed via 'certificate' flag is used for, required along with 'certificate' flag.").Default("").String()
+	// CertificateProfilesFile is a path to JSON file with certificate profiles
+	CertificateProfilesFile = app.Flag("certificate_profiles", "Path to JSON file with certificate profiles which could be selected via 'CertificateProfile' cookie.").Default("").String()
+	// FakeARM is an address the in-memory fake of Azure is started on, the plugin sends all requests to the fake if it is set
+	FakeARM = app.Flag("fake_arm", "Start in-memory fake of Azure on the given address, e.g. 'localhost:8081', and send all requests to it. Development environment only.").Default("").String()
+	// RecordDir is a directory requests to Azure and responses are recorded to
+	RecordDir = app.Flag("record", "Record requests to Azure and responses with tokens and secrets redacted into cassette files in the given directory.").Default("").String()
+	// ReplayDir is a directory recorded requests to Azure are served from instead of Azure
+	ReplayDir = app.Flag("replay", "Serve requests to Azure from cassette files recorded into the given directory.").Default("").String()
+	// CATHost is a host of the plugin used in the service of CAT namespace, the 'listen' address is used if it is empty
+	CATHost = app.Flag("cat_host", "Host of the plugin used in CAT generated by 'generate-cat' command, e.g. 'https://selfservice.example.com'.").Default("").String()
+	// CATPathParams are values of path params used in paths of CAT namespace types
+	CATPathParams = app.Flag("cat_path_params", "Values of path params used in CAT generated by 'generate-cat' command, e.g. 'group_name=Group-1,network_id=net1'.").Default("group_name=Group-1").String()
+	// CATOutput is a path to file CAT is written to by 'generate-cat' command, CAT is printed to stdout if it is empty
+	CATOutput = app.Flag("cat_output", "Path to file CAT generated by 'generate-cat' command is written to, stdout is used by default.").Default("").String()
+	// CATOperationTimeout is a period RCL definitions of generated CAT wait for async operation before failing
+	CATOperationTimeout = app.Flag("cat_operation_timeout", "Period RCL definitions of CAT generated by 'generate-cat' command wait for async operations, e.g. '30m'.").Default("30m").Duration()
 	// ClientIDCred is the client id of the application that is registered in Azure Active Directory.
 	ClientIDCred = app.Arg("client", "The client id of the application that is registered in Azure Active Directory.").String()
 	// ClientSecretCred is the client key of the application that is registered in Azure Active Directory.
@@ -49,15 +123,18 @@ var (
 	// RefreshTokenCred is the token used for refreshing access token.
 	RefreshTokenCred = app.Arg("refresh_token", "The token used for refreshing access token.").String()
 	// BaseURL is Azure cloud endpoint...set base url as variable to be able to modify it in the specs
-	BaseURL = "https://management.azure.com"
+	// endpoints are set according to the cloud selected by 'cloud' flag
+	BaseURL string
 	// GraphURL is the endpoint to Graph Azure service
-	GraphURL = "https://graph.windows.net"
+	GraphURL string
 	// AuthHost is endpoint to authentication Azure service
-	AuthHost = "https://login.windows.net"
+	AuthHost string
 	// Logger is Global syslog logger
 	Logger log15.Logger
 	// DebugMode is used to manage debug mode
 	DebugMode = false
+	// GenerateCAT is set if the plugin is started with 'generate-cat' command
+	GenerateCAT = false
 )
 
 // Copy/pasted from log15/handler.go so we can specify local0 facility
@@ -101,7 +178,13 @@ func newSyslogHandler(fmtr log15.Format, sysWr *syslog.Writer, err error) (log15
 func init() {
 	// Parse command line
 	app.Version(version)
-	app.Parse(os.Args[1:])
+	args := os.Args[1:]
+	// kingpin doesn't allow to mix commands with top-level args, so the command is taken out before parsing
+	if len(args) > 0 && args[0] == GenerateCATCommand {
+		GenerateCAT = true
+		args = args[1:]
+	}
+	app.Parse(args)
 
 	Logger = log15.New()
 	var handler log.Handler
@@ -122,6 +205,52 @@ func init() {
 
 	Logger.SetHandler(handler)
 
+	if err := setupEnvironment(); err != nil {
+		kingpin.Fatalf("Unable to setup Azure cloud: %v", err)
+	}
+
+	if *CertificatePath != "" && (*CertificateTenantID == "" || *CertificateClientID == "") {
+		kingpin.Fatalf("Flags 'certificate_tenant_id' and 'certificate_client_id' are required along with 'certificate' flag")
+	}
+
+	if *CertificateProfilesFile != "" {
+		if err := loadCertificateProfiles(*CertificateProfilesFile); err != nil {
+			kingpin.Fatalf("Unable to load certificate profiles: %v", err)
+		}
+	}
+
+	if *SessionStore != "memory" && *SessionStore != "file" {
+		kingpin.Fatalf("Unknown session store: %s", *SessionStore)
+	}
+
+	if *CacheBackend != "memory" && *CacheBackend != "redis" && *CacheBackend != "none" {
+		kingpin.Fatalf("Unknown cache backend: %s", *CacheBackend)
+	}
+
+	if *CacheSize < 1 {
+		kingpin.Fatalf("Flag 'cache_size' should be positive")
+	}
+
+	switch *AuditSink {
+	case "none", "file", "syslog":
+	case "webhook":
+		if *AuditWebhook == "" {
+			kingpin.Fatalf("Flag 'audit_webhook' is required by 'webhook' audit sink")
+		}
+	default:
+		kingpin.Fatalf("Unknown audit sink: %s", *AuditSink)
+	}
+
+	if err := parseCacheTTLs(*CacheTTLs); err != nil {
+		kingpin.Fatalf("Unable to parse cache TTLs: %v", err)
+	}
+
+	if *APIVersionsFile != "" {
+		if err := loadAPIVersions(*APIVersionsFile); err != nil {
+			kingpin.Fatalf("Unable to load API versions: %v", err)
+		}
+	}
+
 	switch *Env {
 	case "development":
 		// add development specific settings here
@@ -133,4 +262,20 @@ func init() {
 		panic("Unknown environmental name: " + *Env)
 	}
 
+	if *FanOutConcurrency < 1 {
+		kingpin.Fatalf("Flag 'fan_out_concurrency' should be positive")
+	}
+
+	if *ImageCrawlConcurrency < 1 {
+		kingpin.Fatalf("Flag 'image_crawl_concurrency' should be positive")
+	}
+
+	if *RecordDir != "" && *ReplayDir != "" {
+		kingpin.Fatalf("Flags 'record' and 'replay' could not be used together")
+	}
+
+	if *FakeARM != "" && *Env != "development" {
+		kingpin.Fatalf("Fake of Azure could be used in development environment only")
+	}
+
 }
@@ -1,8 +1,10 @@
 package errorHandler
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-errors/errors"
 	"github.com/labstack/echo"
@@ -11,7 +13,26 @@ import (
 type genericError struct {
 	Code       int
 	Message    string
-	StackTrace string `json:"StackTrace,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	AzureError *AzureError  `json:"error,omitempty"`
+	ErrorCodes []int        `json:"error_codes,omitempty"`
+	RequestID  string       `json:"x-ms-request-id,omitempty"`
+	StackTrace string       `json:"StackTrace,omitempty"`
+}
+
+// FieldError describes invalid value of the request param
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// AzureError represents error returned by Azure Resource Manager
+// https://github.com/Azure/azure-resource-manager-rpc/blob/master/v1.0/common-api-details.md#error-response-content
+type AzureError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Target  string       `json:"target,omitempty"`
+	Details []AzureError `json:"details,omitempty"`
 }
 
 func (e *genericError) Error() string {
@@ -61,6 +82,22 @@ func RecordNotFound(resourceID string) error {
 	})
 }
 
+// UnauthorizedException represents error with status code 401
+func UnauthorizedException(message string) error {
+	return errors.New(&genericError{
+		Code:    401,
+		Message: message,
+	})
+}
+
+// UnprocessableEntityException represents error with status code 422
+func UnprocessableEntityException(message string) error {
+	return errors.New(&genericError{
+		Code:    422,
+		Message: message,
+	})
+}
+
 // InvalidParamException returns generic error massage for invalid value of paramName
 func InvalidParamException(paramName string) error {
 	message := fmt.Sprintf("You have specified an invalid '%s' parameter.", paramName)
@@ -69,3 +106,73 @@ func InvalidParamException(paramName string) error {
 		Message: message,
 	})
 }
+
+// ValidationException represents error with status code 422 listing all invalid params
+func ValidationException(fieldErrors []FieldError) error {
+	fields := make([]string, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		fields = append(fields, fe.Field)
+	}
+	return errors.New(&genericError{
+		Code:    422,
+		Message: fmt.Sprintf("You have specified invalid parameters: %s.", strings.Join(fields, ", ")),
+		Errors:  fieldErrors,
+	})
+}
+
+// AzureException represents error response gotten from Azure with the same status code,
+// ARM error is returned in the 'error' field to let clients branch on error codes
+func AzureException(message string, resp *http.Response, body []byte) error {
+	ge := &genericError{
+		Code:      resp.StatusCode,
+		RequestID: resp.Header.Get("x-ms-request-id"),
+	}
+	var envelope struct {
+		Error *AzureError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != nil {
+		ge.AzureError = envelope.Error
+	} else {
+		// some services return error without envelope
+		azureError := new(AzureError)
+		if err := json.Unmarshal(body, azureError); err == nil && azureError.Code != "" {
+			ge.AzureError = azureError
+		}
+	}
+	if ge.AzureError != nil {
+		ge.Message = fmt.Sprintf("%s: %s", message, ge.AzureError.Message)
+	} else {
+		ge.Message = fmt.Sprintf("%s: %s", message, string(body))
+	}
+	return errors.New(ge)
+}
+
+// AADException represents error response gotten from Azure Active Directory with the same status code,
+// AAD error and its description are returned in the 'error' field like ARM errors, AAD error codes in the 'error_codes' field
+func AADException(message string, resp *http.Response, body []byte) error {
+	var aadError struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+		ErrorCodes  []int  `json:"error_codes"`
+	}
+	if err := json.Unmarshal(body, &aadError); err != nil || aadError.Error == "" {
+		return AzureException(message, resp, body)
+	}
+	return errors.New(&genericError{
+		Code:       resp.StatusCode,
+		Message:    fmt.Sprintf("%s: %s", message, aadError.Description),
+		AzureError: &AzureError{Code: aadError.Error, Message: aadError.Description},
+		ErrorCodes: aadError.ErrorCodes,
+		RequestID:  resp.Header.Get("x-ms-request-id"),
+	})
+}
+
+// StatusCode returns HTTP status code of the error, 500 is returned for unexpected errors
+func StatusCode(err error) int {
+	if e, ok := err.(*errors.Error); ok {
+		if ge, ok := e.Err.(*genericError); ok {
+			return ge.Code
+		}
+	}
+	return http.StatusInternalServerError
+}
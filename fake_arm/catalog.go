@@ -0,0 +1,188 @@
+package fakeARM
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// provider is a resource provider with registration state
+type provider struct {
+	Namespace         string
+	RegistrationState string
+	ResourceTypes     []string
+}
+
+func (p *provider) render(subscription string) map[string]interface{} {
+	var types []interface{}
+	for _, t := range p.ResourceTypes {
+		types = append(types, map[string]interface{}{"resourceType": t, "locations": locationNames})
+	}
+	return map[string]interface{}{
+		"id":                "/subscriptions/" + subscription + "/providers/" + p.Namespace,
+		"namespace":         p.Namespace,
+		"registrationState": p.RegistrationState,
+		"resourceTypes":     types,
+	}
+}
+
+var defaultProviders = []provider{
+	{"Microsoft.Authorization", "Registered", []string{"roleAssignments", "roleDefinitions"}},
+	{"Microsoft.Compute", "Registered", []string{"availabilitySets", "virtualMachines", "locations/vmSizes", "locations/publishers"}},
+	{"Microsoft.Insights", "NotRegistered", []string{"eventTypes"}},
+	{"Microsoft.Network", "Registered", []string{"virtualNetworks", "networkInterfaces", "publicIPAddresses", "networkSecurityGroups", "routeTables", "virtualNetworkGateways"}},
+	{"Microsoft.Resources", "Registered", []string{"resourceGroups", "locations"}},
+	{"Microsoft.Storage", "Registered", []string{"storageAccounts"}},
+}
+
+var locationNames = []string{"East US", "West US", "West Europe"}
+
+func locations(subscription string) []interface{} {
+	var value []interface{}
+	for _, displayName := range locationNames {
+		name := strings.ToLower(strings.Replace(displayName, " ", "", -1))
+		value = append(value, map[string]string{
+			"id":          "/subscriptions/" + subscription + "/locations/" + name,
+			"name":        name,
+			"displayName": displayName,
+		})
+	}
+	return value
+}
+
+// images are available in every location: publisher -> offer -> sku -> versions
+var images = map[string]map[string]map[string][]string{
+	"Canonical": {
+		"UbuntuServer": {
+			"14.04.4-LTS": {"14.04.201604060"},
+			"16.04.0-LTS": {"16.04.201604203", "16.04.201611150"},
+		},
+	},
+	"MicrosoftWindowsServer": {
+		"WindowsServer": {
+			"2012-R2-Datacenter": {"4.0.20160430"},
+		},
+	},
+}
+
+var vmSizes = []map[string]interface{}{
+	{"name": "Standard_A0", "numberOfCores": 1, "osDiskSizeInMB": 1047552, "resourceDiskSizeInMB": 20480, "memoryInMB": 768, "maxDataDiskCount": 1},
+	{"name": "Standard_A1", "numberOfCores": 1, "osDiskSizeInMB": 1047552, "resourceDiskSizeInMB": 71680, "memoryInMB": 1792, "maxDataDiskCount": 2},
+	{"name": "Standard_D1_v2", "numberOfCores": 1, "osDiskSizeInMB": 1047552, "resourceDiskSizeInMB": 51200, "memoryInMB": 3584, "maxDataDiskCount": 2},
+	{"name": "Standard_D2_v2", "numberOfCores": 2, "osDiskSizeInMB": 1047552, "resourceDiskSizeInMB": 102400, "memoryInMB": 7168, "maxDataDiskCount": 4},
+}
+
+// handleProviderAction serves subscription level endpoints of providers which are not resources,
+// it returns false if the request should be served as a resource one
+func (s *Server) handleProviderAction(w http.ResponseWriter, r *http.Request, subscription string, namespace string, segments []string) bool {
+	switch {
+	case len(segments) == 4 && strings.EqualFold(segments[0], "locations") && strings.EqualFold(segments[2], "operations"):
+		s.handleOperationStatus(w, r, segments[3])
+	case len(segments) == 4 && strings.EqualFold(segments[0], "locations") && strings.EqualFold(segments[2], "operationResults"):
+		s.handleOperationResult(w, r, segments[3])
+	case len(segments) == 2 && strings.EqualFold(segments[0], "operations"):
+		s.handleOperationStatus(w, r, segments[1])
+	case len(segments) == 3 && strings.EqualFold(segments[0], "locations") && strings.EqualFold(segments[2], "vmSizes"):
+		writeJSON(w, 200, map[string]interface{}{"value": vmSizes})
+	case len(segments) >= 3 && strings.EqualFold(segments[0], "locations") && strings.EqualFold(segments[2], "publishers"):
+		s.handleImages(w, r, subscription, segments[1], segments[3:])
+	case len(segments) == 1 && strings.EqualFold(segments[0], "checkNameAvailability") && r.Method == "POST":
+		s.handleCheckNameAvailability(w, r, namespace)
+	case strings.EqualFold(namespace, "microsoft.insights"):
+		writeJSON(w, 200, map[string]interface{}{"value": []interface{}{}})
+	default:
+		return false
+	}
+	return true
+}
+
+// handleImages serves VM image catalog, segments follow 'publishers': [<publisher>, artifacttypes, vmimage, offers, <offer>, skus, <sku>, versions, <version>]
+func (s *Server) handleImages(w http.ResponseWriter, r *http.Request, subscription string, location string, segments []string) {
+	prefix := fmt.Sprintf("/Subscriptions/%s/Providers/Microsoft.Compute/Locations/%s/Publishers", subscription, location)
+	entry := func(id string, name string) map[string]string {
+		return map[string]string{"id": id, "name": name, "location": location}
+	}
+	var value []interface{}
+	switch len(segments) {
+	case 0:
+		for _, publisher := range sortedKeys(images) {
+			value = append(value, entry(prefix+"/"+publisher, publisher))
+		}
+	case 4:
+		for _, offer := range sortedKeys(images[segments[0]]) {
+			value = append(value, entry(fmt.Sprintf("%s/%s/ArtifactTypes/VMImage/Offers/%s", prefix, segments[0], offer), offer))
+		}
+	case 6:
+		for _, sku := range sortedKeys(images[segments[0]][segments[4]]) {
+			value = append(value, entry(fmt.Sprintf("%s/%s/ArtifactTypes/VMImage/Offers/%s/Skus/%s", prefix, segments[0], segments[4], sku), sku))
+		}
+	case 8:
+		for _, version := range images[segments[0]][segments[4]][segments[6]] {
+			value = append(value, entry(fmt.Sprintf("%s/%s/ArtifactTypes/VMImage/Offers/%s/Skus/%s/Versions/%s", prefix, segments[0], segments[4], segments[6], version), version))
+		}
+	case 9:
+		found := false
+		for _, version := range images[segments[0]][segments[4]][segments[6]] {
+			found = found || version == segments[8]
+		}
+		if !found {
+			writeError(w, 404, "NotFound", "Artifact: VMImage was not found.")
+			return
+		}
+		operatingSystem := "Linux"
+		if strings.HasPrefix(segments[0], "MicrosoftWindows") {
+			operatingSystem = "Windows"
+		}
+		writeJSON(w, 200, map[string]interface{}{
+			"id":       fmt.Sprintf("%s/%s/ArtifactTypes/VMImage/Offers/%s/Skus/%s/Versions/%s", prefix, segments[0], segments[4], segments[6], segments[8]),
+			"name":     segments[8],
+			"location": location,
+			"properties": map[string]interface{}{
+				"osDiskImage":    map[string]string{"operatingSystem": operatingSystem},
+				"dataDiskImages": []interface{}{},
+			},
+		})
+		return
+	default:
+		writeError(w, 404, "NotFound", fmt.Sprintf("The requested path '%s' is not supported by fake.", r.URL.Path))
+		return
+	}
+	if value == nil {
+		value = []interface{}{}
+	}
+	// image catalog is returned as a bare array unlike other collections
+	writeJSON(w, 200, value)
+}
+
+// handleCheckNameAvailability checks that there is no storage account with the name in any subscription
+func (s *Server) handleCheckNameAvailability(w http.ResponseWriter, r *http.Request, namespace string) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	name, _ := body["name"].(string)
+	resourceType := strings.ToLower(namespace + "/storageAccounts")
+	for _, resource := range s.resources {
+		if strings.ToLower(resource["type"].(string)) == resourceType && strings.EqualFold(resource["name"].(string), name) {
+			writeJSON(w, 200, map[string]interface{}{
+				"nameAvailable": false,
+				"reason":        "AlreadyExists",
+				"message":       fmt.Sprintf("The storage account named %s is already taken.", name),
+			})
+			return
+		}
+	}
+	writeJSON(w, 200, map[string]interface{}{"nameAvailable": true})
+}
+
+// sortedKeys returns keys of the map with string keys in alphabetical order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
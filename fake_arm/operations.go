@@ -0,0 +1,85 @@
+package fakeARM
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// operation is an async operation of Resource Manager, it succeeds after configured number of polls
+type operation struct {
+	ID     string
+	Polls  int
+	Status string
+	// onSucceeded applies result of the operation, ex: removes deleted resource
+	onSucceeded func()
+}
+
+// newOperation starts async operation, it is completed at once if AsyncPolls is 0
+func (s *Server) newOperation(onSucceeded func()) *operation {
+	s.seq++
+	op := &operation{
+		ID:          fmt.Sprintf("00000000-0000-0000-0000-%012d", s.seq),
+		Polls:       s.AsyncPolls,
+		Status:      "InProgress",
+		onSucceeded: onSucceeded,
+	}
+	s.operations[op.ID] = op
+	if op.Polls <= 0 {
+		op.finish()
+	}
+	return op
+}
+
+// poll returns status of the operation and moves it forward
+func (op *operation) poll() string {
+	if op.Status != "InProgress" {
+		return op.Status
+	}
+	if op.Polls > 0 {
+		op.Polls--
+		return op.Status
+	}
+	op.finish()
+	return op.Status
+}
+
+func (op *operation) finish() {
+	op.Status = "Succeeded"
+	if op.onSucceeded != nil {
+		op.onSucceeded()
+		op.onSucceeded = nil
+	}
+}
+
+// operationURL returns URL of the operation in the format used by Azure-AsyncOperation ("operations")
+// or Location ("operationResults") headers
+func (s *Server) operationURL(r *http.Request, subscription string, namespace string, location string, op *operation, kind string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/providers/%s/locations/%s/%s/%s?api-version=%s",
+		baseURL(r), subscription, namespace, location, kind, op.ID, r.URL.Query().Get("api-version"))
+}
+
+// handleOperationStatus serves Azure-AsyncOperation URLs: {"status": "InProgress|Succeeded"}
+func (s *Server) handleOperationStatus(w http.ResponseWriter, r *http.Request, id string) {
+	op, ok := s.operations[id]
+	if !ok {
+		writeError(w, 404, "OperationNotFound", fmt.Sprintf("Could not find operation with id '%s'.", id))
+		return
+	}
+	writeJSON(w, 200, map[string]string{"id": id, "name": id, "status": op.poll()})
+}
+
+// handleOperationResult serves Location URLs: 202 while operation is in progress and 204 after it
+func (s *Server) handleOperationResult(w http.ResponseWriter, r *http.Request, id string) {
+	op, ok := s.operations[id]
+	if !ok {
+		writeError(w, 404, "OperationNotFound", fmt.Sprintf("Could not find operation with id '%s'.", id))
+		return
+	}
+	if op.poll() == "InProgress" {
+		w.Header().Set("Location", baseURL(r)+r.URL.RequestURI())
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(202)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,509 @@
+package fakeARM
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// asyncProviders process PUT and DELETE requests asynchronously
+var asyncProviders = map[string]bool{
+	"microsoft.compute": true,
+	"microsoft.network": true,
+	"microsoft.storage": true,
+}
+
+// embeddedChildren are child resource types returned in the properties of their parent, ex: subnets of virtual network
+var embeddedChildren = map[string][]string{
+	"microsoft.network/virtualnetworks":       {"subnets"},
+	"microsoft.network/networksecuritygroups": {"securityRules", "defaultSecurityRules"},
+	"microsoft.network/routetables":           {"routes"},
+}
+
+// defaultSecurityRules are added to every network security group
+var defaultSecurityRules = []map[string]interface{}{
+	{
+		"name": "AllowVnetInBound",
+		"properties": map[string]interface{}{
+			"protocol": "*", "sourcePortRange": "*", "destinationPortRange": "*",
+			"sourceAddressPrefix": "VirtualNetwork", "destinationAddressPrefix": "VirtualNetwork",
+			"access": "Allow", "priority": 65000, "direction": "Inbound",
+		},
+	},
+	{
+		"name": "DenyAllInBound",
+		"properties": map[string]interface{}{
+			"protocol": "*", "sourcePortRange": "*", "destinationPortRange": "*",
+			"sourceAddressPrefix": "*", "destinationAddressPrefix": "*",
+			"access": "Deny", "priority": 65500, "direction": "Inbound",
+		},
+	},
+}
+
+func (s *Server) handleResourceGroups(w http.ResponseWriter, r *http.Request, subscription string, segments []string) {
+	base := "/subscriptions/" + subscription + "/resourceGroups"
+	switch {
+	case len(segments) == 0 && r.Method == "GET":
+		s.writeCollection(w, s.children(base))
+	case len(segments) == 1:
+		s.handleResourceGroup(w, r, subscription, base+"/"+segments[0], segments[0])
+	case len(segments) >= 3 && strings.EqualFold(segments[1], "providers"):
+		if s.resources[strings.ToLower(base+"/"+segments[0])] == nil {
+			writeError(w, 404, "ResourceGroupNotFound", fmt.Sprintf("Resource group '%s' could not be found.", segments[0]))
+			return
+		}
+		s.handleResource(w, r, subscription, segments[0], segments[2], segments[3:])
+	default:
+		writeError(w, 404, "NotFound", fmt.Sprintf("The requested path '%s' is not supported by fake.", r.URL.Path))
+	}
+}
+
+func (s *Server) handleResourceGroup(w http.ResponseWriter, r *http.Request, subscription string, id string, name string) {
+	key := strings.ToLower(id)
+	group := s.resources[key]
+	switch r.Method {
+	case "GET":
+		if group == nil {
+			writeError(w, 404, "ResourceGroupNotFound", fmt.Sprintf("Resource group '%s' could not be found.", name))
+			return
+		}
+		writeJSON(w, 200, group)
+	case "PUT", "PATCH":
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		status := 200
+		if group == nil {
+			if r.Method == "PATCH" {
+				writeError(w, 404, "ResourceGroupNotFound", fmt.Sprintf("Resource group '%s' could not be found.", name))
+				return
+			}
+			if body["location"] == nil {
+				writeError(w, 400, "LocationRequired", "The location property is required for this definition.")
+				return
+			}
+			status = 201
+			group = map[string]interface{}{"id": id, "name": name, "type": "Microsoft.Resources/resourceGroups", "location": body["location"]}
+			s.resources[key] = group
+		}
+		if body["tags"] != nil {
+			group["tags"] = body["tags"]
+		}
+		group["properties"] = map[string]interface{}{"provisioningState": "Succeeded"}
+		writeJSON(w, status, group)
+	case "DELETE":
+		if group == nil {
+			w.WriteHeader(204)
+			return
+		}
+		group["properties"] = map[string]interface{}{"provisioningState": "Deleting"}
+		op := s.newOperation(func() { s.deleteResource(id) })
+		w.Header().Set("Location", fmt.Sprintf("%s/subscriptions/%s/operationresults/%s?api-version=%s", baseURL(r), subscription, op.ID, r.URL.Query().Get("api-version")))
+		w.WriteHeader(202)
+	default:
+		writeError(w, 405, "MethodNotAllowed", fmt.Sprintf("The method '%s' is not supported.", r.Method))
+	}
+}
+
+// handleResource serves resources of providers, path segments after namespace are resource types and names:
+// odd number of segments points to collection, even one - to single resource
+func (s *Server) handleResource(w http.ResponseWriter, r *http.Request, subscription string, group string, namespace string, segments []string) {
+	if len(segments) == 0 {
+		writeError(w, 404, "NotFound", fmt.Sprintf("The requested path '%s' is not supported by fake.", r.URL.Path))
+		return
+	}
+	if group == "" && s.handleProviderAction(w, r, subscription, namespace, segments) {
+		return
+	}
+	base := "/subscriptions/" + subscription
+	if group != "" {
+		base += "/resourceGroups/" + group
+	}
+	base += "/providers/" + namespace
+	last := segments[len(segments)-1]
+	if len(segments)%2 == 1 && len(segments) > 1 {
+		if s.handleResourceAction(w, r, base+"/"+strings.Join(segments[:len(segments)-1], "/"), last) {
+			return
+		}
+	}
+	if len(segments)%2 == 1 {
+		s.handleCollection(w, r, subscription, group, namespace, base, segments)
+		return
+	}
+	id := base + "/" + strings.Join(segments, "/")
+	types := []string{namespace}
+	for i := 0; i < len(segments); i += 2 {
+		types = append(types, segments[i])
+	}
+	if len(segments) > 2 {
+		parentID := base + "/" + strings.Join(segments[:len(segments)-2], "/")
+		if s.resources[strings.ToLower(parentID)] == nil {
+			writeError(w, 404, "ParentResourceNotFound", fmt.Sprintf("Can not perform requested operation on nested resource. Parent resource '%s' not found.", segments[len(segments)-3]))
+			return
+		}
+	}
+	switch r.Method {
+	case "GET":
+		resource := s.resources[strings.ToLower(id)]
+		if resource == nil {
+			writeError(w, 404, "ResourceNotFound", fmt.Sprintf("The Resource '%s' under resource group '%s' was not found.", strings.Join(types, "/")+"/"+last, group))
+			return
+		}
+		writeJSON(w, 200, s.render(resource))
+	case "PUT":
+		s.putResource(w, r, subscription, group, namespace, id, strings.Join(types, "/"), last, len(segments) == 2)
+	case "PATCH":
+		s.patchResource(w, r, id)
+	case "DELETE":
+		s.deleteResourceRequest(w, r, subscription, namespace, id)
+	default:
+		writeError(w, 405, "MethodNotAllowed", fmt.Sprintf("The method '%s' is not supported.", r.Method))
+	}
+}
+
+func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request, subscription string, group string, namespace string, base string, segments []string) {
+	if r.Method != "GET" {
+		writeError(w, 405, "MethodNotAllowed", fmt.Sprintf("The method '%s' is not supported.", r.Method))
+		return
+	}
+	if group == "" && len(segments) == 1 {
+		// resources of the type from all resource groups of subscription
+		resourceType := strings.ToLower(namespace + "/" + segments[0])
+		prefix := strings.ToLower("/subscriptions/" + subscription + "/")
+		var resources []map[string]interface{}
+		for key, resource := range s.resources {
+			if strings.HasPrefix(key, prefix) && strings.ToLower(resource["type"].(string)) == resourceType {
+				resources = append(resources, resource)
+			}
+		}
+		s.writeCollection(w, resources)
+		return
+	}
+	if len(segments) > 1 {
+		parentID := base + "/" + strings.Join(segments[:len(segments)-1], "/")
+		if s.resources[strings.ToLower(parentID)] == nil {
+			writeError(w, 404, "ParentResourceNotFound", fmt.Sprintf("Can not perform requested operation on nested resource. Parent resource '%s' not found.", segments[len(segments)-2]))
+			return
+		}
+	}
+	s.writeCollection(w, s.children(base+"/"+strings.Join(segments, "/")))
+}
+
+// children returns direct children of the collection with the given ID
+func (s *Server) children(collectionID string) []map[string]interface{} {
+	prefix := strings.ToLower(collectionID) + "/"
+	var resources []map[string]interface{}
+	for key, resource := range s.resources {
+		if strings.HasPrefix(key, prefix) && !strings.Contains(key[len(prefix):], "/") {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func (s *Server) writeCollection(w http.ResponseWriter, resources []map[string]interface{}) {
+	sort.Sort(byID(resources))
+	value := make([]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		value = append(value, s.render(resource))
+	}
+	writeJSON(w, 200, map[string]interface{}{"value": value})
+}
+
+type byID []map[string]interface{}
+
+func (r byID) Len() int      { return len(r) }
+func (r byID) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byID) Less(i, j int) bool {
+	return strings.ToLower(r[i]["id"].(string)) < strings.ToLower(r[j]["id"].(string))
+}
+
+// render returns copy of the resource with embedded child resources
+func (s *Server) render(resource map[string]interface{}) map[string]interface{} {
+	childTypes := embeddedChildren[strings.ToLower(resource["type"].(string))]
+	if len(childTypes) == 0 {
+		return resource
+	}
+	result := make(map[string]interface{}, len(resource))
+	for k, v := range resource {
+		result[k] = v
+	}
+	properties := make(map[string]interface{})
+	if p, ok := resource["properties"].(map[string]interface{}); ok {
+		for k, v := range p {
+			properties[k] = v
+		}
+	}
+	for _, childType := range childTypes {
+		children := s.children(resource["id"].(string) + "/" + childType)
+		sort.Sort(byID(children))
+		value := make([]interface{}, 0, len(children))
+		for _, child := range children {
+			value = append(value, child)
+		}
+		properties[childType] = value
+	}
+	result["properties"] = properties
+	return result
+}
+
+func (s *Server) putResource(w http.ResponseWriter, r *http.Request, subscription string, group string, namespace string, id string, resourceType string, name string, topLevel bool) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	key := strings.ToLower(id)
+	existing := s.resources[key]
+	status, state := 201, "Creating"
+	if existing != nil {
+		status, state = 200, "Updating"
+		// keep casing of the ID used on creation
+		id = existing["id"].(string)
+		resourceType = existing["type"].(string)
+		name = existing["name"].(string)
+	}
+	resource := body
+	resource["id"] = id
+	resource["name"] = name
+	resource["type"] = resourceType
+	if location, _ := resource["location"].(string); topLevel && location == "" && group != "" {
+		resource["location"] = s.resources[strings.ToLower("/subscriptions/"+subscription+"/resourceGroups/"+group)]["location"]
+	}
+	if !topLevel {
+		delete(resource, "location")
+	}
+	s.seq++
+	resource["etag"] = fmt.Sprintf("W/\"%08d-0000-0000-0000-000000000000\"", s.seq)
+	properties, _ := resource["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = make(map[string]interface{})
+		resource["properties"] = properties
+	}
+	async := asyncProviders[strings.ToLower(namespace)]
+	if !async {
+		state = "Succeeded"
+	}
+	properties["provisioningState"] = state
+	s.resources[key] = resource
+	s.putEmbeddedChildren(resource, properties, state, existing == nil)
+
+	if async {
+		op := s.newOperation(func() { s.setProvisioningState(id, "Succeeded") })
+		w.Header().Set("Azure-AsyncOperation", s.operationURL(r, subscription, namespace, s.location(resource, subscription, group), op, "operations"))
+	}
+	writeJSON(w, status, s.render(resource))
+}
+
+// putEmbeddedChildren replaces child resources passed in the properties of the parent, ex: subnets of virtual network
+func (s *Server) putEmbeddedChildren(resource map[string]interface{}, properties map[string]interface{}, state string, created bool) {
+	id := resource["id"].(string)
+	for _, childType := range embeddedChildren[strings.ToLower(resource["type"].(string))] {
+		var children []interface{}
+		if childType == "defaultSecurityRules" {
+			delete(properties, childType)
+			if !created {
+				continue
+			}
+			for _, rule := range defaultSecurityRules {
+				children = append(children, rule)
+			}
+		} else {
+			value, ok := properties[childType].([]interface{})
+			delete(properties, childType)
+			if !ok {
+				continue
+			}
+			for _, child := range s.children(id + "/" + childType) {
+				delete(s.resources, strings.ToLower(child["id"].(string)))
+			}
+			children = value
+		}
+		for _, c := range children {
+			child, ok := c.(map[string]interface{})
+			if !ok || child["name"] == nil {
+				continue
+			}
+			childID := fmt.Sprintf("%s/%s/%v", id, childType, child["name"])
+			childProperties := make(map[string]interface{})
+			if p, ok := child["properties"].(map[string]interface{}); ok {
+				for k, v := range p {
+					childProperties[k] = v
+				}
+			}
+			childProperties["provisioningState"] = state
+			s.resources[strings.ToLower(childID)] = map[string]interface{}{
+				"id":         childID,
+				"name":       child["name"],
+				"type":       resource["type"].(string) + "/" + childType,
+				"etag":       resource["etag"],
+				"properties": childProperties,
+			}
+		}
+	}
+}
+
+func (s *Server) patchResource(w http.ResponseWriter, r *http.Request, id string) {
+	resource := s.resources[strings.ToLower(id)]
+	if resource == nil {
+		writeError(w, 404, "ResourceNotFound", fmt.Sprintf("The Resource '%s' was not found.", id))
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	for k, v := range body {
+		switch k {
+		case "id", "name", "type":
+		case "properties":
+			properties, _ := resource["properties"].(map[string]interface{})
+			patch, ok := v.(map[string]interface{})
+			if properties == nil || !ok {
+				continue
+			}
+			for pk, pv := range patch {
+				properties[pk] = pv
+			}
+		default:
+			resource[k] = v
+		}
+	}
+	writeJSON(w, 200, s.render(resource))
+}
+
+func (s *Server) deleteResourceRequest(w http.ResponseWriter, r *http.Request, subscription string, namespace string, id string) {
+	resource := s.resources[strings.ToLower(id)]
+	if resource == nil {
+		w.WriteHeader(204)
+		return
+	}
+	if !asyncProviders[strings.ToLower(namespace)] {
+		s.deleteResource(id)
+		w.WriteHeader(200)
+		return
+	}
+	s.setProvisioningState(id, "Deleting")
+	op := s.newOperation(func() { s.deleteResource(id) })
+	location := s.location(resource, subscription, "")
+	w.Header().Set("Azure-AsyncOperation", s.operationURL(r, subscription, namespace, location, op, "operations"))
+	w.Header().Set("Location", s.operationURL(r, subscription, namespace, location, op, "operationResults"))
+	w.WriteHeader(202)
+}
+
+// deleteResource removes resource with all its children
+func (s *Server) deleteResource(id string) {
+	key := strings.ToLower(id)
+	delete(s.resources, key)
+	delete(s.powerStates, key)
+	for k := range s.resources {
+		if strings.HasPrefix(k, key+"/") {
+			delete(s.resources, k)
+		}
+	}
+}
+
+// setProvisioningState sets state of resource and its embedded children
+func (s *Server) setProvisioningState(id string, state string) {
+	key := strings.ToLower(id)
+	for k, resource := range s.resources {
+		if k != key && !strings.HasPrefix(k, key+"/") {
+			continue
+		}
+		if properties, ok := resource["properties"].(map[string]interface{}); ok {
+			properties["provisioningState"] = state
+		}
+	}
+}
+
+// location returns location of the resource, location of its resource group is used for child resources
+func (s *Server) location(resource map[string]interface{}, subscription string, group string) string {
+	if location, ok := resource["location"].(string); ok && location != "" {
+		return location
+	}
+	if group != "" {
+		if location, ok := s.resources[strings.ToLower("/subscriptions/"+subscription+"/resourceGroups/"+group)]["location"].(string); ok {
+			return location
+		}
+	}
+	return "westus"
+}
+
+// handleResourceAction serves actions of existing resources, ex: listKeys of storage account
+func (s *Server) handleResourceAction(w http.ResponseWriter, r *http.Request, id string, action string) bool {
+	resource := s.resources[strings.ToLower(id)]
+	switch strings.ToLower(action) {
+	case "listkeys":
+		if r.Method != "POST" {
+			return false
+		}
+	case "instanceview":
+		if r.Method != "GET" {
+			return false
+		}
+	case "start", "restart", "poweroff", "deallocate":
+		if r.Method != "POST" {
+			return false
+		}
+	default:
+		return false
+	}
+	if resource == nil {
+		writeError(w, 404, "ResourceNotFound", fmt.Sprintf("The Resource '%s' was not found.", id))
+		return true
+	}
+	key := strings.ToLower(id)
+	switch strings.ToLower(action) {
+	case "listkeys":
+		var keys []interface{}
+		for _, name := range []string{"key1", "key2"} {
+			sum := sha256.Sum256([]byte(key + name))
+			keys = append(keys, map[string]string{"keyName": name, "value": base64.StdEncoding.EncodeToString(sum[:]), "permissions": "Full"})
+		}
+		writeJSON(w, 200, map[string]interface{}{"keys": keys})
+	case "instanceview":
+		powerState, ok := s.powerStates[key]
+		if !ok {
+			powerState = "running"
+		}
+		writeJSON(w, 200, map[string]interface{}{
+			"statuses": []interface{}{
+				map[string]string{"code": "ProvisioningState/succeeded", "level": "Info", "displayStatus": "Provisioning succeeded"},
+				map[string]string{"code": "PowerState/" + powerState, "level": "Info", "displayStatus": "VM " + powerState},
+			},
+		})
+	default:
+		states := map[string]string{"start": "running", "restart": "running", "poweroff": "stopped", "deallocate": "deallocated"}
+		state := states[strings.ToLower(action)]
+		segments := strings.Split(strings.Trim(id, "/"), "/")
+		op := s.newOperation(func() { s.powerStates[key] = state })
+		w.Header().Set("Azure-AsyncOperation", s.operationURL(r, segments[1], "Microsoft.Compute", s.location(resource, segments[1], ""), op, "operations"))
+		w.WriteHeader(202)
+	}
+	return true
+}
+
+// readBody decodes JSON body of the request, empty body is decoded as empty object
+func readBody(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	body := make(map[string]interface{})
+	if r.Body == nil {
+		return body, true
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&body); err != nil && err.Error() != "EOF" {
+		writeError(w, 400, "InvalidRequestContent", fmt.Sprintf("The request content was invalid and could not be deserialized: %v", err))
+		return nil, false
+	}
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+	return body, true
+}
+
+func baseURL(r *http.Request) string {
+	return "http://" + r.Host
+}
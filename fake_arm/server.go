@@ -0,0 +1,178 @@
+package fakeARM
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory fake of Azure Resource Manager, Azure Active Directory and Graph endpoints.
+// Point config.BaseURL, config.AuthHost and config.GraphURL at its URL to run the plugin without Azure subscription:
+//
+//	fake := httptest.NewServer(fakeARM.NewServer())
+//	config.BaseURL, config.AuthHost, config.GraphURL = fake.URL, fake.URL, fake.URL
+type Server struct {
+	// AsyncPolls is a number of polls async operations stay in progress for, operations complete at once if it is 0
+	AsyncPolls int
+
+	mu sync.Mutex
+	// resources are keyed by lower case resource ID since Azure doesn't keep casing of IDs
+	resources  map[string]map[string]interface{}
+	operations map[string]*operation
+	// providers keep registration state of resource providers keyed by lower case namespace
+	providers map[string]*provider
+	// powerStates of virtual machines keyed by lower case resource ID
+	powerStates map[string]string
+	seq         int
+}
+
+// NewServer creates fake with no resources, async operations stay in progress for one poll
+func NewServer() *Server {
+	s := &Server{
+		AsyncPolls:  1,
+		resources:   make(map[string]map[string]interface{}),
+		operations:  make(map[string]*operation),
+		providers:   make(map[string]*provider),
+		powerStates: make(map[string]string),
+	}
+	for _, p := range defaultProviders {
+		p := p
+		s.providers[strings.ToLower(p.Namespace)] = &p
+	}
+	return s
+}
+
+// ServeHTTP dispatches requests to token endpoint, Graph or Resource Manager fakes
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 3 && strings.EqualFold(segments[1], "oauth2") && strings.EqualFold(segments[2], "token"):
+		s.handleToken(w, r)
+	case !authorized(r):
+		writeError(w, 401, "AuthenticationFailed", "Authentication failed. The 'Authorization' header is missing.")
+	case len(segments) == 2 && strings.EqualFold(segments[1], "servicePrincipals"):
+		s.handleServicePrincipals(w, r)
+	case len(segments) >= 2 && strings.EqualFold(segments[0], "subscriptions"):
+		s.handleSubscription(w, r, segments[1], segments[2:])
+	default:
+		writeError(w, 404, "NotFound", fmt.Sprintf("The requested path '%s' is not supported by fake.", r.URL.Path))
+	}
+}
+
+// handleToken issues access tokens for client credentials, client assertions are not verified
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, 405, "MethodNotAllowed", "Only POST is supported by token endpoint.")
+		return
+	}
+	r.ParseForm()
+	if r.Form.Get("client_id") == "" || (r.Form.Get("client_secret") == "" && r.Form.Get("client_assertion") == "") {
+		writeJSON(w, 401, map[string]string{
+			"error":             "invalid_client",
+			"error_description": "AADSTS70002: The request body must contain client_secret or client_assertion.",
+		})
+		return
+	}
+	s.seq++
+	now := time.Now()
+	writeJSON(w, 200, map[string]string{
+		"token_type":    "Bearer",
+		"expires_in":    "3600",
+		"expires_on":    fmt.Sprintf("%d", now.Add(time.Hour).Unix()),
+		"not_before":    fmt.Sprintf("%d", now.Unix()),
+		"resource":      r.Form.Get("resource"),
+		"access_token":  fmt.Sprintf("fake-access-token-%d", s.seq),
+		"refresh_token": fmt.Sprintf("fake-refresh-token-%d", s.seq),
+	})
+}
+
+// handleServicePrincipals returns service principal of application filtered by "appId eq '<client id>'"
+func (s *Server) handleServicePrincipals(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("$filter")
+	parts := strings.Split(filter, "'")
+	if len(parts) < 2 {
+		writeJSON(w, 200, map[string]interface{}{"value": []interface{}{}})
+		return
+	}
+	appID := parts[1]
+	writeJSON(w, 200, map[string]interface{}{
+		"value": []interface{}{
+			map[string]string{"objectId": "fake-principal-" + appID, "appId": appID},
+		},
+	})
+}
+
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request, subscription string, segments []string) {
+	switch {
+	case len(segments) == 0:
+		writeJSON(w, 200, map[string]interface{}{
+			"id":             "/subscriptions/" + subscription,
+			"subscriptionId": subscription,
+			"displayName":    "Fake subscription",
+			"state":          "Enabled",
+		})
+	case len(segments) == 1 && strings.EqualFold(segments[0], "locations"):
+		writeJSON(w, 200, map[string]interface{}{"value": locations(subscription)})
+	case len(segments) == 2 && strings.EqualFold(segments[0], "operationresults"):
+		s.handleOperationResult(w, r, segments[1])
+	case strings.EqualFold(segments[0], "resourceGroups"):
+		s.handleResourceGroups(w, r, subscription, segments[1:])
+	case strings.EqualFold(segments[0], "providers"):
+		s.handleProviders(w, r, subscription, segments[1:])
+	default:
+		writeError(w, 404, "NotFound", fmt.Sprintf("The requested path '%s' is not supported by fake.", r.URL.Path))
+	}
+}
+
+func (s *Server) handleProviders(w http.ResponseWriter, r *http.Request, subscription string, segments []string) {
+	switch {
+	case len(segments) == 0:
+		var value []interface{}
+		for _, p := range defaultProviders {
+			value = append(value, s.providers[strings.ToLower(p.Namespace)].render(subscription))
+		}
+		writeJSON(w, 200, map[string]interface{}{"value": value})
+	case len(segments) == 1:
+		p, ok := s.providers[strings.ToLower(segments[0])]
+		if !ok {
+			writeError(w, 404, "InvalidResourceNamespace", fmt.Sprintf("The resource namespace '%s' is invalid.", segments[0]))
+			return
+		}
+		writeJSON(w, 200, p.render(subscription))
+	case len(segments) == 2 && strings.EqualFold(segments[1], "register") && r.Method == "POST":
+		p, ok := s.providers[strings.ToLower(segments[0])]
+		if !ok {
+			writeError(w, 404, "InvalidResourceNamespace", fmt.Sprintf("The resource namespace '%s' is invalid.", segments[0]))
+			return
+		}
+		p.RegistrationState = "Registered"
+		writeJSON(w, 200, p.render(subscription))
+	default:
+		s.handleResource(w, r, subscription, "", segments[0], segments[1:])
+	}
+}
+
+// authorized checks that bearer token is passed, tokens are not verified
+func authorized(r *http.Request) bool {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	return len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") && parts[1] != ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("x-ms-request-id", "fake-request")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError sends error in the ARM format: {"error": {"code": "...", "message": "..."}}
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
@@ -1,20 +1,53 @@
 package main
 
 import (
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
 
 	"github.com/labstack/echo"
 	em "github.com/labstack/echo/middleware"
 
 	// load app files
+	"github.com/rightscale/azure_arm_proxy/cassette"
 	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	fakeARM "github.com/rightscale/azure_arm_proxy/fake_arm"
 	am "github.com/rightscale/azure_arm_proxy/middleware"
 	"github.com/rightscale/azure_arm_proxy/resources"
 )
 
 func main() {
+	if config.GenerateCAT {
+		if err := generateCAT(*config.CATOutput); err != nil {
+			log.Fatalf("Unable to generate CAT: %v", err)
+		}
+		return
+	}
+	if *config.FakeARM != "" {
+		startFakeARM(*config.FakeARM)
+	}
+	if *config.RecordDir != "" {
+		recorder, err := cassette.NewRecorder(*config.RecordDir, am.UpstreamTransport)
+		if err != nil {
+			log.Fatalf("Unable to record requests to Azure: %v", err)
+		}
+		am.UpstreamTransport = recorder
+		log.Printf("Recording requests to Azure into %s\n", *config.RecordDir)
+	}
+	if *config.ReplayDir != "" {
+		replayer, err := cassette.NewReplayer(*config.ReplayDir)
+		if err != nil {
+			log.Fatalf("Unable to replay requests to Azure: %v", err)
+		}
+		am.UpstreamTransport = replayer
+		log.Printf("Replaying requests to Azure from %s\n", *config.ReplayDir)
+	}
+	if err := resources.OpenAuditLog(); err != nil {
+		log.Fatalf("Unable to open '%s' audit sink: %v", *config.AuditSink, err)
+	}
 	// Serve
 	s := httpServer()
 	log.Printf("Azure plugin - listening on %s under %s environment\n", *config.ListenFlag, *config.Env)
@@ -29,6 +62,7 @@ func httpServer() *echo.Echo {
 	e := echo.New()
 	e.Use(am.AzureClientInitializer())
 	e.Use(em.Recover())
+	e.Use(am.IdempotencyKeeper())
 
 	if config.DebugMode {
 		e.SetDebug(true)
@@ -39,30 +73,37 @@ func httpServer() *echo.Echo {
 	// Setup routes
 	e.Get("/health-check", healthCheck)
 	prefix := e.Group(*config.AppPrefix) // added prefix to use multiple nginx location on one SS box
-	resources.SetupSubscriptionRoutes(prefix)
-	resources.SetupInstanceRoutes(prefix)
-	resources.SetupGroupsRoutes(prefix)
-	resources.SetupStorageAccountsRoutes(prefix)
-	resources.SetupProviderRoutes(prefix)
-	resources.SetupNetworkRoutes(prefix)
-	resources.SetupSubnetsRoutes(prefix)
-	resources.SetupIPAddressesRoutes(prefix)
-	resources.SetupAuthRoutes(prefix)
-	resources.SetupNetworkInterfacesRoutes(prefix)
-	resources.SetupImageRoutes(prefix)
-	resources.SetupOperationRoutes(prefix)
-	resources.SetupAvailabilitySetRoutes(prefix)
-	resources.SetupNetworkSecurityGroupRoutes(prefix)
-	resources.SetupNetworkSecurityGroupRuleRoutes(prefix)
-	resources.SetupInstanceTypesRoutes(prefix)
-	resources.SetupRouteTablesRoutes(prefix)
-	resources.SetupRoutes(prefix)
-	resources.SetupVirtualNetworkGatewayRoutes(prefix)
-	resources.SetupEventsRoutes(prefix)
+	resources.SetupResourceRoutes(prefix)
 
 	return e
 }
 
+// startFakeARM serves in-memory fake of Azure and points the plugin to it
+func startFakeARM(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Unable to start fake of Azure: %v", err)
+	}
+	url := "http://" + listener.Addr().String()
+	config.BaseURL, config.AuthHost, config.GraphURL = url, url, url
+	go http.Serve(listener, fakeARM.NewServer())
+	log.Printf("Fake of Azure - listening on %s\n", listener.Addr())
+}
+
+// generateCAT writes CAT with namespace of the plugin resources to the given file or to stdout
+func generateCAT(path string) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return resources.GenerateCAT(w)
+}
+
 func healthCheck(c *echo.Context) error {
 	return c.String(http.StatusOK, "Ok")
 }
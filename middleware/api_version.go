@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/labstack/echo"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+// APIVersionHeader could be used instead of 'api_version' query param to override Azure API version,
+// the version is applied to requests for the resource handled by the plugin request only
+const APIVersionHeader = "X-Api-Version"
+
+var apiVersionRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(-[a-zA-Z]+)?$`)
+
+// APIVersionOverride returns API version passed via 'api_version' param or header, it is empty if versions are not overridden
+func APIVersionOverride(c *echo.Context) string {
+	apiVersion, _ := getAPIVersion(c)
+	return apiVersion
+}
+
+// getAPIVersion returns API version requested via 'api_version' query param or 'X-Api-Version' header,
+// empty string means that configured API versions should be used
+func getAPIVersion(c *echo.Context) (string, error) {
+	apiVersion := c.Query("api_version")
+	if apiVersion == "" {
+		apiVersion = c.Request().Header.Get(APIVersionHeader)
+	}
+	if apiVersion != "" && !apiVersionRegexp.MatchString(apiVersion) {
+		return "", eh.InvalidParamException("api_version")
+	}
+	return apiVersion, nil
+}
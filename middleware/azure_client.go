@@ -6,6 +6,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 
 	"code.google.com/p/goauth2/oauth"
 	"github.com/labstack/echo"
@@ -15,6 +17,22 @@ import (
 
 const tokenEndpoint = "oauth2/token"
 
+// credentialHeaders maps credential cookies to headers which could be used instead of them,
+// headers take precedence over cookies. Access token is passed in the 'Authorization: Bearer <token>' header.
+var credentialHeaders = map[string]string{
+	"SubscriptionID":     "X-Azure-Subscription-Id",
+	"TenantID":           "X-Azure-Tenant-Id",
+	"ClientID":           "X-Azure-Client-Id",
+	"ClientSecret":       "X-Azure-Client-Secret",
+	"RefreshToken":       "X-Azure-Refresh-Token",
+	"CertificateProfile": "X-Azure-Certificate-Profile",
+}
+
+// CredentialHeader returns header which could be used instead of the credential cookie, ex: 'X-Azure-Tenant-Id' for 'TenantID'
+func CredentialHeader(name string) string {
+	return credentialHeaders[name]
+}
+
 // Credentials represents set of creds required for Azure authentication
 type Credentials struct {
 	TenantID     string `json:"tenant"`
@@ -24,6 +42,10 @@ type Credentials struct {
 	GrantType    string
 	Resource     string
 	RefreshToken string
+	// AuthHost is authentication endpoint of the selected cloud, config.AuthHost is used if empty
+	AuthHost string `json:"-"`
+	// Certificate is used to sign client assertion instead of passing client secret
+	Certificate *Certificate `json:"-"`
 }
 
 // AuthResponse represents creds gotten from cloud
@@ -44,9 +66,21 @@ type AuthResponse struct {
 func AzureClientInitializer() echo.Middleware {
 	return func(h echo.HandlerFunc) echo.HandlerFunc {
 		return func(c *echo.Context) error {
-			if c.Request().RequestURI == "/health-check" {
+			if c.Request().RequestURI == "/health-check" || isPublicPath(c.Request().URL.Path) {
 				return h(c)
 			}
+			env, err := getEnvironment(c)
+			if err != nil {
+				return err
+			}
+			c.Set("environment", env)
+			session, err := getRequestSession(c)
+			if err != nil {
+				return err
+			}
+			if session != nil {
+				c.Set("session", session)
+			}
 			accessToken, err := getAccessToken(c)
 			if err != nil {
 				return err
@@ -76,14 +110,60 @@ func AzureClientInitializer() echo.Middleware {
 				c.Set("clientCreds", creds)
 			}
 
-			t := &oauth.Transport{Token: &oauth.Token{AccessToken: accessToken}}
+			// retry throttled and failed requests and pass Azure rate limits to the plugin response,
+			// requests could be sent concurrently, ex: to list child resources of all parents
+			var headersMu sync.Mutex
+			transport := newAzureTransport(env, func(resp *http.Response) {
+				headersMu.Lock()
+				defer headersMu.Unlock()
+				copyRateLimitHeaders(resp.Header, c.Response().Header())
+			})
+			// overridden API version is applied by handlers to requests for their resources
+			if _, err := getAPIVersion(c); err != nil {
+				return err
+			}
+			t := &oauth.Transport{Token: &oauth.Token{AccessToken: accessToken}, Transport: transport}
 			client := t.Client()
 			c.Set("azure", client)
+			c.Set("accessToken", accessToken)
 			return h(c)
 		}
 	}
 }
 
+// newAzureTransport sends requests to the selected Azure cloud and retries throttled and failed ones
+func newAzureTransport(env *config.Environment, onResponse func(*http.Response)) http.RoundTripper {
+	var transport http.RoundTripper = NewRetryTransport(onResponse)
+	if env.ResourceManagerURL != config.BaseURL {
+		transport = &environmentTransport{Transport: transport, Environment: env}
+	}
+	return transport
+}
+
+// NewDetachedClient creates Azure client which doesn't touch the plugin response,
+// it could be used after the plugin request is completed, ex: for background refresh of image index
+func NewDetachedClient(c *echo.Context) (*http.Client, error) {
+	env, _ := c.Get("environment").(*config.Environment)
+	accessToken, _ := c.Get("accessToken").(string)
+	if env == nil || accessToken == "" {
+		return nil, eh.GenericException("failed to retrieve Azure client, check middleware")
+	}
+	t := &oauth.Transport{Token: &oauth.Token{AccessToken: accessToken}, Transport: newAzureTransport(env, nil)}
+	return t.Client(), nil
+}
+
+// PublicPaths don't require Azure credentials
+var PublicPaths = []string{"/sessions", "/resource_types", "/openapi.json"}
+
+func isPublicPath(path string) bool {
+	for _, p := range PublicPaths {
+		if path == *config.AppPrefix+p || strings.HasPrefix(path, *config.AppPrefix+p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 func getCookie(c *echo.Context, name string) (string, error) {
 	cookie, err := c.Request().Cookie(name)
 	if err != nil {
@@ -92,61 +172,127 @@ func getCookie(c *echo.Context, name string) (string, error) {
 	return cookie.Value, nil
 }
 
+// getCredential returns credential passed in the header, stored in the session or passed in the cookie
+func getCredential(c *echo.Context, name string) (string, error) {
+	if value := c.Request().Header.Get(credentialHeaders[name]); value != "" {
+		return value, nil
+	}
+	if session, ok := c.Get("session").(*Session); ok {
+		if value := session.credential(name); value != "" {
+			return value, nil
+		}
+	}
+	return getCookie(c, name)
+}
+
+// hasCredentialHeaders reports whether credentials are passed in the headers rather than in the cookies
+func hasCredentialHeaders(c *echo.Context) bool {
+	for _, header := range credentialHeaders {
+		if c.Request().Header.Get(header) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// getBearerToken returns access token passed in the 'Authorization' header, it is empty if header is missing
+func getBearerToken(c *echo.Context) (string, error) {
+	authorization := c.Request().Header.Get("Authorization")
+	if authorization == "" {
+		return "", nil
+	}
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", eh.GenericException("Only 'Bearer' scheme is supported in the 'Authorization' header.")
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
+
 func getSubscriptionID(c *echo.Context) (string, error) {
-	subscriptionID, err := getCookie(c, "SubscriptionID")
+	subscriptionID, err := getCredential(c, "SubscriptionID")
 	if err != nil {
 		if *config.Env == "development" {
 			subscriptionID = *config.SubscriptionIDCred
 		}
 		if subscriptionID == "" {
-			return "", eh.GenericException("The 'SubscriptionID' cookie is required.")
+			return "", eh.GenericException("The 'X-Azure-Subscription-Id' header or 'SubscriptionID' cookie is required.")
 		}
 	}
 	return subscriptionID, nil
 }
 
+// getAccessToken returns access token passed in the 'Authorization' header or 'AccessToken' cookie
+// or requests new one using service principal credentials
 func getAccessToken(c *echo.Context) (string, error) {
-	token, err := getCookie(c, "AccessToken")
+	token, err := getBearerToken(c)
+	if err != nil || token != "" {
+		// token passed in the header is managed by the caller
+		return token, err
+	}
+	if c.Get("session") != nil {
+		// tokens of session credentials are cached on the plugin side
+		return refreshAccessToken(c)
+	}
+	token, err = getCookie(c, "AccessToken")
 	if err != nil {
 		return refreshAccessToken(c)
 	}
+	// refresh expired access token if credentials are passed as well
+	if expiresOn, err := getCookie(c, "ExpiresOn"); err == nil && tokenExpired(expiresOn) {
+		if _, err := getCredential(c, "ClientSecret"); err == nil {
+			return refreshAccessToken(c)
+		}
+		if _, err := getCredential(c, "CertificateProfile"); err == nil {
+			return refreshAccessToken(c)
+		}
+	}
 	// get access token from cookies
 	return token, nil
 }
 
 func refreshAccessToken(c *echo.Context) (string, error) {
+	env := c.Get("environment").(*config.Environment)
 	creds := new(Credentials)
 	var err error
-	creds.TenantID, err = getCookie(c, "TenantID")
+	creds.TenantID, err = getCredential(c, "TenantID")
 	if err != nil {
 		if *config.Env == "development" {
 			creds.TenantID = *config.TenantIDCred
 		}
 	}
 
-	creds.ClientID, err = getCookie(c, "ClientID")
+	creds.ClientID, err = getCredential(c, "ClientID")
 	if err != nil {
 		if *config.Env == "development" {
 			creds.ClientID = *config.ClientIDCred
 		}
 	}
 
-	creds.ClientSecret, err = getCookie(c, "ClientSecret")
+	creds.ClientSecret, err = getCredential(c, "ClientSecret")
 	if err != nil {
 		if *config.Env == "development" {
 			creds.ClientSecret = *config.ClientSecretCred
 		}
 	}
 
-	creds.RefreshToken, err = getCookie(c, "RefreshToken")
+	creds.RefreshToken, err = getCredential(c, "RefreshToken")
 	if err != nil {
 		if *config.Env == "development" {
 			creds.RefreshToken = *config.RefreshTokenCred
 		}
 	}
 
-	if creds.TenantID == "" || creds.ClientID == "" || creds.ClientSecret == "" || creds.RefreshToken == "" {
-		return "", eh.GenericException("The credentials are missing in the cookie. Please set 'AccessToken' or combination of 'TenantID', 'ClientID', 'ClientSecret', 'RefreshToken'.")
+	// certificate is used only if client secret is not passed, it is checked against the service principal
+	if creds.ClientSecret == "" && creds.TenantID != "" && creds.ClientID != "" {
+		profile, _ := getCredential(c, "CertificateProfile")
+		creds.Certificate, err = getCertificate(profile, creds.TenantID, creds.ClientID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if creds.TenantID == "" || creds.ClientID == "" || (creds.Certificate == nil && (creds.ClientSecret == "" || creds.RefreshToken == "")) {
+		return "", eh.GenericException("The credentials are missing. Please pass 'Authorization: Bearer' header, 'AccessToken' cookie or combination of 'TenantID', 'ClientID', 'ClientSecret', 'RefreshToken' or 'TenantID', 'ClientID', 'CertificateProfile'.")
 	}
 	// store creds for further usage
 	c.Set("clientCreds", creds)
@@ -157,30 +303,62 @@ func refreshAccessToken(c *echo.Context) (string, error) {
 		creds.Resource = ""
 	} else {
 		creds.GrantType = "client_credentials"
-		creds.Resource = "https://management.core.windows.net/"
+		creds.Resource = env.TokenAudience
 	}
-	authResponse, err := creds.RequestToken()
+	creds.AuthHost = env.AuthHost
+	authResponse, err := creds.GetToken()
 	if err != nil {
 		return "", err
 	}
+	// cookies are set only for callers passing credentials in cookies, tokens of sessions and header credentials are cached on the plugin side
+	if c.Get("session") != nil || hasCredentialHeaders(c) {
+		return authResponse.AccessToken, nil
+	}
 	// set Access Token in the cookie
 	http.SetCookie(c.Response().Writer(), &http.Cookie{
-		Name:  "AccessToken",
-		Value: authResponse.AccessToken,
+		Name:     "AccessToken",
+		Value:    authResponse.AccessToken,
+		HttpOnly: true,
 	})
 	// set ExpiresOn in the cookie
 	http.SetCookie(c.Response().Writer(), &http.Cookie{
-		Name:  "ExpiresOn",
-		Value: authResponse.ExpiresOn,
+		Name:     "ExpiresOn",
+		Value:    authResponse.ExpiresOn,
+		HttpOnly: true,
 	})
 	return authResponse.AccessToken, nil
 }
 
+// GetToken returns access token, tokens gotten via client credentials are cached until they are about to expire
+func (c *Credentials) GetToken() (*AuthResponse, error) {
+	if c.GrantType != "client_credentials" {
+		return c.RequestToken()
+	}
+	return tokens.get(tokenCacheKey(c.authHost(), c), c.RequestToken)
+}
+
+func (c *Credentials) authHost() string {
+	if c.AuthHost != "" {
+		return c.AuthHost
+	}
+	return config.AuthHost
+}
+
 // RequestToken builds request to redeem authorization code and get access token
 func (c *Credentials) RequestToken() (*AuthResponse, error) {
+	path := fmt.Sprintf("%s/%s/%s", c.authHost(), c.TenantID, tokenEndpoint)
 	data := url.Values{}
 	data.Set("client_id", c.ClientID)
-	data.Set("client_secret", c.ClientSecret)
+	if c.Certificate != nil {
+		assertion, err := c.Certificate.ClientAssertion(c.ClientID, path)
+		if err != nil {
+			return nil, eh.GenericException(fmt.Sprintf("Unable to sign client assertion: %v", err))
+		}
+		data.Set("client_assertion_type", ClientAssertionType)
+		data.Set("client_assertion", assertion)
+	} else {
+		data.Set("client_secret", c.ClientSecret)
+	}
 	data.Set("grant_type", c.GrantType)
 	message := c.GrantType
 	if c.Resource != "" {
@@ -190,20 +368,20 @@ func (c *Credentials) RequestToken() (*AuthResponse, error) {
 	if c.RefreshToken != "" {
 		data.Set("refresh_token", c.RefreshToken)
 	}
-	path := fmt.Sprintf("%s/%s/%s", config.AuthHost, c.TenantID, tokenEndpoint)
 	fmt.Printf("Requesting %s: %s\n", message, path)
-	resp, err := http.PostForm(path, data)
-	defer resp.Body.Close()
+	client := &http.Client{Transport: UpstreamTransport}
+	resp, err := client.PostForm(path, data)
 	if err != nil {
 		return nil, eh.GenericException(fmt.Sprintf("Access token refreshing failed: %v", err))
 	}
+	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
 	if resp.StatusCode >= 400 {
-		return nil, eh.GenericException(fmt.Sprintf("Access token refreshing failed: %s", string(body)))
+		return nil, eh.AADException("Access token refreshing failed", resp, body)
 	}
 	var response *AuthResponse
 
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	"golang.org/x/crypto/pkcs12"
+)
+
+// ClientAssertionType is a type of client assertion signed by certificate
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// assertionLifetime is a lifetime of client assertion, it is used only once to get access token
+const assertionLifetime = 10 * time.Minute
+
+// Certificate is used to sign client assertion instead of passing client secret to Azure Active Directory
+type Certificate struct {
+	Certificate *x509.Certificate
+	PrivateKey  *rsa.PrivateKey
+}
+
+// certificates keeps loaded certificates keyed by path, they are read only once
+var certificates = struct {
+	sync.Mutex
+	loaded map[string]*Certificate
+}{loaded: make(map[string]*Certificate)}
+
+// LoadCertificate reads certificate and RSA private key from PEM or PKCS#12 file
+func LoadCertificate(path string, password string) (*Certificate, error) {
+	certificates.Lock()
+	defer certificates.Unlock()
+	if cert, ok := certificates.loaded[path]; ok {
+		return cert, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cert *Certificate
+	if bytes.Contains(b, []byte("-----BEGIN")) {
+		cert, err = parsePEMCertificate(b)
+	} else {
+		cert, err = parsePKCS12Certificate(b, password)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate '%s': %v", path, err)
+	}
+	certificates.loaded[path] = cert
+	return cert, nil
+}
+
+func parsePEMCertificate(b []byte) (*Certificate, error) {
+	cert := new(Certificate)
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			// the first certificate is the client one, the rest is the chain
+			if cert.Certificate == nil {
+				c, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				cert.Certificate = c
+			}
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			cert.PrivateKey = key
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("only RSA private keys are supported")
+			}
+			cert.PrivateKey = rsaKey
+		}
+	}
+	if cert.Certificate == nil || cert.PrivateKey == nil {
+		return nil, fmt.Errorf("both certificate and private key are required")
+	}
+	return cert, nil
+}
+
+func parsePKCS12Certificate(b []byte, password string) (*Certificate, error) {
+	key, c, err := pkcs12.Decode(b, password)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("only RSA private keys are supported")
+	}
+	return &Certificate{Certificate: c, PrivateKey: rsaKey}, nil
+}
+
+// Thumbprint returns hex encoded SHA-1 hash of the certificate as shown in Azure portal
+func (c *Certificate) Thumbprint() string {
+	sum := sha1.Sum(c.Certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientAssertion builds JWT signed by the certificate which is sent to the token endpoint instead of client secret
+// https://azure.microsoft.com/en-us/documentation/articles/active-directory-certificate-credentials/
+func (c *Certificate) ClientAssertion(clientID string, tokenURL string) (string, error) {
+	thumbprint := sha1.Sum(c.Certificate.Raw)
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": tokenURL,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": uuid.New(),
+		"nbf": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.PrivateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// CheckCertificateProfile makes sure the profile exists and is bound to the given service principal
+func CheckCertificateProfile(profile string, tenantID string, clientID string) error {
+	_, err := getCertificate(profile, tenantID, clientID)
+	return err
+}
+
+// getCertificate returns certificate of the profile selected by 'CertificateProfile' cookie
+// or one passed via 'certificate' flag, nil is returned if there is no certificate.
+// Certificates are bound to service principals, so they could not be used to get tokens of other ones.
+func getCertificate(profile string, tenantID string, clientID string) (*Certificate, error) {
+	var path, password, boundTenantID, boundClientID string
+	if profile != "" {
+		p, ok := config.CertificateProfiles[profile]
+		if !ok {
+			return nil, eh.InvalidParamException("CertificateProfile")
+		}
+		path, password, boundTenantID, boundClientID = p.Path, p.Password, p.TenantID, p.ClientID
+	} else if *config.CertificatePath != "" {
+		path, password, boundTenantID, boundClientID = *config.CertificatePath, *config.CertificatePassword, *config.CertificateTenantID, *config.CertificateClientID
+	} else {
+		return nil, nil
+	}
+	if !strings.EqualFold(tenantID, boundTenantID) || !strings.EqualFold(clientID, boundClientID) {
+		config.Logger.Error("Certificate is requested by another service principal:", "profile", profile, "tenant", tenantID, "client", clientID)
+		return nil, eh.UnauthorizedException("The certificate could not be used for the passed 'TenantID' and 'ClientID'.")
+	}
+	cert, err := LoadCertificate(path, password)
+	if err != nil {
+		config.Logger.Error("Certificate loading failed:", "profile", profile, "error", err)
+		return nil, eh.GenericException("Unable to load certificate used for authentication.")
+	}
+	return cert, nil
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+// writeTestCertificate writes self-signed certificate and its private key to temporary PEM file
+func writeTestCertificate() (string, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "azure_arm_proxy"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	file, err := ioutil.TempFile("", "azure_arm_proxy_cert")
+	Expect(err).NotTo(HaveOccurred())
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(file, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	file.Close()
+	return file.Name(), key
+}
+
+var _ = Describe("certificate", func() {
+
+	var certFile string
+	var key *rsa.PrivateKey
+
+	BeforeEach(func() {
+		certFile, key = writeTestCertificate()
+		config.CertificateProfiles["test"] = config.CertificateProfile{Path: certFile, TenantID: "cert_tenant", ClientID: "cert_client"}
+	})
+
+	AfterEach(func() {
+		os.Remove(certFile)
+		delete(config.CertificateProfiles, "test")
+	})
+
+	Describe("selecting", func() {
+		var path, tenantID, clientID string
+
+		BeforeEach(func() {
+			path, tenantID, clientID = *config.CertificatePath, *config.CertificateTenantID, *config.CertificateClientID
+		})
+
+		AfterEach(func() {
+			*config.CertificatePath, *config.CertificateTenantID, *config.CertificateClientID = path, tenantID, clientID
+		})
+
+		It("returns certificate of the profile for its service principal", func() {
+			cert, err := getCertificate("test", "cert_tenant", "CERT_CLIENT")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(cert.PrivateKey.PublicKey).Should(Equal(key.PublicKey))
+		})
+
+		It("refuses certificate of the profile to another service principal", func() {
+			_, err := getCertificate("test", "cert_tenant", "another_client")
+			Ω(eh.StatusCode(err)).Should(Equal(401))
+			_, err = getCertificate("test", "another_tenant", "cert_client")
+			Ω(eh.StatusCode(err)).Should(Equal(401))
+		})
+
+		It("fails for unknown profile", func() {
+			_, err := getCertificate("unknown", "cert_tenant", "cert_client")
+			Ω(eh.StatusCode(err)).Should(Equal(400))
+		})
+
+		It("uses certificate passed via flag for its service principal only", func() {
+			*config.CertificatePath, *config.CertificateTenantID, *config.CertificateClientID = certFile, "cert_tenant", "cert_client"
+			cert, err := getCertificate("", "cert_tenant", "cert_client")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(cert).ShouldNot(BeNil())
+			_, err = getCertificate("", "cert_tenant", "another_client")
+			Ω(eh.StatusCode(err)).Should(Equal(401))
+		})
+
+		It("returns no certificate if neither profile nor flag is passed", func() {
+			*config.CertificatePath = ""
+			cert, err := getCertificate("", "cert_tenant", "cert_client")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(cert).Should(BeNil())
+		})
+	})
+
+	Describe("requesting access token", func() {
+		var do *ghttp.Server
+		var authHost string
+
+		BeforeEach(func() {
+			do = ghttp.NewServer()
+			authHost = config.AuthHost
+			config.AuthHost = do.URL()
+			tokens = newTokenCache()
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/cert_tenant/oauth2/token"),
+					func(w http.ResponseWriter, req *http.Request) {
+						req.ParseForm()
+						Ω(req.Form.Get("client_secret")).Should(BeEmpty())
+						Ω(req.Form.Get("client_assertion_type")).Should(Equal(ClientAssertionType))
+						parts := strings.Split(req.Form.Get("client_assertion"), ".")
+						Ω(parts).Should(HaveLen(3))
+						signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+						Expect(err).NotTo(HaveOccurred())
+						hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+						Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature)).To(Succeed())
+						payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+						Expect(err).NotTo(HaveOccurred())
+						var claims map[string]interface{}
+						Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+						Ω(claims["aud"]).Should(Equal(do.URL() + "/cert_tenant/oauth2/token"))
+						Ω(claims["iss"]).Should(Equal("cert_client"))
+						Ω(claims["sub"]).Should(Equal("cert_client"))
+					},
+					ghttp.RespondWith(http.StatusOK, `{"access_token": "cert_access_token", "expires_on": "`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`"}`),
+				),
+			)
+		})
+
+		AfterEach(func() {
+			config.AuthHost = authHost
+			tokens = newTokenCache()
+			do.Close()
+		})
+
+		It("sends signed client assertion and caches the token", func() {
+			cert, err := getCertificate("test", "cert_tenant", "cert_client")
+			Expect(err).NotTo(HaveOccurred())
+			creds := &Credentials{TenantID: "cert_tenant", ClientID: "cert_client", GrantType: "client_credentials", Certificate: cert}
+			for i := 0; i < 2; i++ {
+				response, err := creds.GetToken()
+				Expect(err).NotTo(HaveOccurred())
+				Ω(response.AccessToken).Should(Equal("cert_access_token"))
+			}
+			Ω(do.ReceivedRequests()).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+// CloudHeader could be used instead of 'Cloud' cookie to select Azure cloud
+const CloudHeader = "X-Azure-Cloud"
+
+// environmentTransport sends requests built for the default cloud to the endpoints of the selected one
+type environmentTransport struct {
+	Transport   http.RoundTripper
+	Environment *config.Environment
+}
+
+// RoundTrip replaces default Resource Manager and Graph endpoints by ones of the selected cloud
+func (t *environmentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := req.URL.String()
+	envPath := EnvironmentURL(t.Environment, path)
+	if envPath == path {
+		return t.Transport.RoundTrip(req)
+	}
+	u, err := url.Parse(envPath)
+	if err != nil {
+		return nil, err
+	}
+	r := *req
+	r.URL = u
+	r.Host = u.Host
+	return t.Transport.RoundTrip(&r)
+}
+
+// EnvironmentURL returns URL of the selected cloud for URL built for the default one, other URLs are returned as is
+func EnvironmentURL(env *config.Environment, path string) string {
+	switch {
+	case strings.HasPrefix(path, config.BaseURL):
+		return env.ResourceManagerURL + strings.TrimPrefix(path, config.BaseURL)
+	case strings.HasPrefix(path, config.GraphURL):
+		return env.GraphURL + strings.TrimPrefix(path, config.GraphURL)
+	}
+	return path
+}
+
+// getEnvironment returns Azure cloud selected via 'Cloud' cookie or 'X-Azure-Cloud' header
+func getEnvironment(c *echo.Context) (*config.Environment, error) {
+	name := c.Request().Header.Get(CloudHeader)
+	if cookie, err := c.Request().Cookie("Cloud"); err == nil && name == "" {
+		name = cookie.Value
+	}
+	env, err := config.GetEnvironment(name)
+	if err != nil {
+		return nil, eh.InvalidParamException("cloud")
+	}
+	return env, nil
+}
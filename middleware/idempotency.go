@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+const (
+	// IdempotencyKeyHeader identifies POST request, its retries with the same key get the outcome of the first one
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set if the response is a replay of the first outcome
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// DryRunHeader requests dry run of create, update or delete like 'dry_run=true' query param does
+	DryRunHeader = "X-Dry-Run"
+)
+
+// idempotentOutcome is the response of the first request with the key, it is nil while the request is in flight
+type idempotentOutcome struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+type idempotentEntry struct {
+	fingerprint string
+	done        chan struct{}
+	outcome     *idempotentOutcome
+	expiresAt   time.Time
+}
+
+// idempotencyStore keeps outcomes of POST requests in memory for the period set by 'idempotency_ttl' flag
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentEntry
+}
+
+var idempotentRequests = &idempotencyStore{entries: make(map[string]*idempotentEntry)}
+
+// IdempotencyKeeper is a middleware which replays the first outcome of POST request to its retries passing the same
+// 'Idempotency-Key' header, retries made while the first request is in flight wait for it. Keys are scoped by the access token
+// and path, so outcomes are replayed only to the caller authorized by Azure for the first request. Failed requests
+// (errors and 5xx responses) are not kept, so they could be retried with the same key. Public routes, ex: /sessions, and dry runs
+// are not handled, so a dry run doesn't take the key of the real request. The query is a part of the fingerprint with the body.
+// It should be used after AzureClientInitializer since it uses the access token and replaces the body decoder prepared by it.
+func IdempotencyKeeper() echo.Middleware {
+	return func(h echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			accessToken, _ := c.Get("accessToken").(string)
+			if c.Request().Method != "POST" || key == "" || accessToken == "" || IsDryRun(c) {
+				return h(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return eh.GenericException(fmt.Sprintf("'%s' header should not be longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength))
+			}
+			body, err := ioutil.ReadAll(c.Request().Body)
+			if err != nil {
+				return eh.GenericException(fmt.Sprintf("failed to load request body: %s", err))
+			}
+			c.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+			if _, ok := c.Get("bodyDecoder").(*json.Decoder); ok {
+				c.Set("bodyDecoder", json.NewDecoder(bytes.NewReader(body)))
+			}
+			sum := sha256.Sum256(append([]byte(c.Request().URL.RawQuery+"\n"), body...))
+			fingerprint := hex.EncodeToString(sum[:])
+			caller := sha256.Sum256([]byte(accessToken))
+			scopedKey := hex.EncodeToString(caller[:]) + ":" + c.Request().URL.Path + ":" + key
+
+			entry, outcome, err := idempotentRequests.begin(scopedKey, fingerprint)
+			if err != nil {
+				return err
+			}
+			if outcome != nil {
+				config.Logger.Info("Idempotent request replayed:", "key", key, "path", c.Request().URL.Path, "status", outcome.status)
+				return replayOutcome(c, outcome)
+			}
+			completed := false
+			// the key is released if the handler fails or panics, so waiting retries are not blocked
+			defer func() {
+				if !completed {
+					idempotentRequests.abort(scopedKey, entry)
+				}
+			}()
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer()}
+			c.Response().SetWriter(recorder)
+			err = h(c)
+			status := c.Response().Status()
+			if err != nil || !c.Response().Committed() || status >= 500 {
+				return err
+			}
+			idempotentRequests.complete(entry, &idempotentOutcome{
+				status:  status,
+				headers: copyHeader(c.Response().Header()),
+				body:    recorder.body.Bytes(),
+			})
+			completed = true
+			return nil
+		}
+	}
+}
+
+// IsDryRun reports whether request to Azure should be returned to the caller instead of being sent
+func IsDryRun(c *echo.Context) bool {
+	return c.Query("dry_run") == "true" || c.Request().Header.Get(DryRunHeader) == "true"
+}
+
+// begin returns outcome of the first request with the key or registers the request as the first one,
+// it waits for the first request if it is in flight
+func (s *idempotencyStore) begin(key string, fingerprint string) (*idempotentEntry, *idempotentOutcome, error) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		for k, e := range s.entries {
+			if e.outcome != nil && !now.Before(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		entry, ok := s.entries[key]
+		if !ok {
+			entry = &idempotentEntry{fingerprint: fingerprint, done: make(chan struct{})}
+			s.entries[key] = entry
+			s.mu.Unlock()
+			return entry, nil, nil
+		}
+		s.mu.Unlock()
+		if entry.fingerprint != fingerprint {
+			return nil, nil, eh.UnprocessableEntityException(fmt.Sprintf("'%s' header is already used by request with different body or query", IdempotencyKeyHeader))
+		}
+		<-entry.done
+		s.mu.Lock()
+		outcome := entry.outcome
+		s.mu.Unlock()
+		if outcome != nil {
+			return nil, outcome, nil
+		}
+		// the first request failed, so the key is free again
+	}
+}
+
+func (s *idempotencyStore) complete(entry *idempotentEntry, outcome *idempotentOutcome) {
+	s.mu.Lock()
+	entry.outcome = outcome
+	entry.expiresAt = time.Now().Add(*config.IdempotencyTTL)
+	s.mu.Unlock()
+	close(entry.done)
+}
+
+func (s *idempotencyStore) abort(key string, entry *idempotentEntry) {
+	s.mu.Lock()
+	if s.entries[key] == entry {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	close(entry.done)
+}
+
+func replayOutcome(c *echo.Context, outcome *idempotentOutcome) error {
+	header := c.Response().Header()
+	for name, values := range outcome.headers {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	c.Response().WriteHeader(outcome.status)
+	_, err := c.Response().Write(outcome.body)
+	return err
+}
+
+// responseRecorder keeps a copy of the response body
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// copyHeader copies headers of the outcome, cookies are dropped since they are issued to the first request only
+func copyHeader(header http.Header) http.Header {
+	result := make(http.Header, len(header))
+	for name, values := range header {
+		if http.CanonicalHeaderKey(name) == "Set-Cookie" {
+			continue
+		}
+		result[name] = append([]string(nil), values...)
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+var _ = Describe("idempotency keeper", func() {
+
+	var server *httptest.Server
+	var mu sync.Mutex
+	var calls int
+	var bodies []string
+	// release blocks the handler until it is closed, it is nil if the handler shouldn't wait
+	var arrived, release chan bool
+
+	BeforeEach(func() {
+		idempotentRequests = &idempotencyStore{entries: make(map[string]*idempotentEntry)}
+		calls, bodies, arrived, release = 0, nil, nil, nil
+		e := echo.New()
+		// access token is set by AzureClientInitializer in the plugin
+		e.Use(func(h echo.HandlerFunc) echo.HandlerFunc {
+			return func(c *echo.Context) error {
+				if token := c.Request().Header.Get("Authorization"); token != "" {
+					c.Set("accessToken", token)
+				}
+				return h(c)
+			}
+		})
+		e.Use(IdempotencyKeeper())
+		e.SetHTTPErrorHandler(eh.AzureErrorHandler(e))
+		handler := func(c *echo.Context) error {
+			b, _ := ioutil.ReadAll(c.Request().Body)
+			mu.Lock()
+			calls++
+			bodies = append(bodies, string(b))
+			mu.Unlock()
+			if release != nil {
+				arrived <- true
+				<-release
+			}
+			if strings.Contains(string(b), "conflict") {
+				return eh.GenericException("conflict")
+			}
+			c.Response().Header().Set("Location", "resource_groups/Group-1/networks/net1")
+			c.Response().Header().Add("Set-Cookie", "AccessToken=secret")
+			return c.JSON(201, map[string]string{"name": "net1"})
+		}
+		e.Post("/networks", handler)
+		e.Post("/sessions", handler)
+		server = httptest.NewServer(e)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	post := func(path, token, key, body string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		req.Header.Set(IdempotencyKeyHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		return resp
+	}
+
+	It("replays the first outcome to the retry without cookies", func() {
+		first := post("/networks", "token1", "key", `{"name": "net1"}`)
+		retry := post("/networks", "token1", "key", `{"name": "net1"}`)
+		Ω(calls).Should(Equal(1))
+		Ω(bodies).Should(Equal([]string{`{"name": "net1"}`}))
+		Ω(first.Header.Get(IdempotentReplayedHeader)).Should(BeEmpty())
+		Ω(first.Header.Get("Set-Cookie")).ShouldNot(BeEmpty())
+		Ω(retry.StatusCode).Should(Equal(201))
+		Ω(retry.Header.Get("Location")).Should(Equal("resource_groups/Group-1/networks/net1"))
+		Ω(retry.Header.Get(IdempotentReplayedHeader)).Should(Equal("true"))
+		Ω(retry.Header.Get("Set-Cookie")).Should(BeEmpty())
+	})
+
+	It("rejects the key used by request with different body", func() {
+		post("/networks", "token1", "key", `{"name": "net1"}`)
+		retry := post("/networks", "token1", "key", `{"name": "net2"}`)
+		Ω(calls).Should(Equal(1))
+		Ω(retry.StatusCode).Should(Equal(422))
+	})
+
+	It("doesn't replay dry run to the real request", func() {
+		dryRun := post("/networks?dry_run=true", "token1", "key", `{"name": "net1"}`)
+		created := post("/networks", "token1", "key", `{"name": "net1"}`)
+		Ω(calls).Should(Equal(2))
+		Ω(dryRun.Header.Get(IdempotentReplayedHeader)).Should(BeEmpty())
+		Ω(created.StatusCode).Should(Equal(201))
+		Ω(created.Header.Get(IdempotentReplayedHeader)).Should(BeEmpty())
+		retry := post("/networks", "token1", "key", `{"name": "net1"}`)
+		Ω(calls).Should(Equal(2))
+		Ω(retry.Header.Get(IdempotentReplayedHeader)).Should(Equal("true"))
+	})
+
+	It("rejects the key used by request with different query", func() {
+		post("/networks", "token1", "key", `{"name": "net1"}`)
+		retry := post("/networks?api_version=2016-09-01", "token1", "key", `{"name": "net1"}`)
+		Ω(calls).Should(Equal(1))
+		Ω(retry.StatusCode).Should(Equal(422))
+	})
+
+	It("scopes keys by the access token", func() {
+		post("/networks", "token1", "key", `{"name": "net1"}`)
+		another := post("/networks", "token2", "key", `{"name": "net1"}`)
+		Ω(calls).Should(Equal(2))
+		Ω(another.Header.Get(IdempotentReplayedHeader)).Should(BeEmpty())
+	})
+
+	It("doesn't keep failed outcomes", func() {
+		first := post("/networks", "token1", "key", `{"name": "conflict"}`)
+		Ω(first.StatusCode).Should(Equal(400))
+		retry := post("/networks", "token1", "key", `{"name": "conflict"}`)
+		Ω(calls).Should(Equal(2))
+		Ω(retry.Header.Get(IdempotentReplayedHeader)).Should(BeEmpty())
+	})
+
+	It("ignores the key on routes without access token", func() {
+		post("/sessions", "", "key", `{"tenant_id": "tenant"}`)
+		retry := post("/sessions", "", "key", `{"tenant_id": "tenant"}`)
+		Ω(calls).Should(Equal(2))
+		Ω(retry.Header.Get(IdempotentReplayedHeader)).Should(BeEmpty())
+	})
+
+	It("makes the retry wait for the first request in flight", func() {
+		arrived, release = make(chan bool), make(chan bool)
+		responses := make(chan *http.Response, 2)
+		go func() {
+			defer GinkgoRecover()
+			responses <- post("/networks", "token1", "key", `{"name": "net1"}`)
+		}()
+		<-arrived
+		go func() {
+			defer GinkgoRecover()
+			responses <- post("/networks", "token1", "key", `{"name": "net1"}`)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		first, second := <-responses, <-responses
+		Ω(calls).Should(Equal(1))
+		Ω(first.StatusCode).Should(Equal(201))
+		Ω(second.StatusCode).Should(Equal(201))
+		Ω(first.Header.Get(IdempotentReplayedHeader) + second.Header.Get(IdempotentReplayedHeader)).Should(Equal("true"))
+	})
+})
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+// RateLimitHeaderPrefix is a prefix of Azure headers which report the number of remaining requests
+// ex: x-ms-ratelimit-remaining-subscription-reads
+const RateLimitHeaderPrefix = "X-Ms-Ratelimit-Remaining-"
+
+// idempotentMethods could be retried safely on server errors and dropped connections
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// RetryTransport is a http.RoundTripper which retries throttled and failed requests to Azure.
+// Throttled (429) requests are retried for every verb since Azure doesn't process them,
+// server errors and dropped connections are retried for idempotent verbs only.
+// Waiting for the next attempt stops as soon as the request is canceled via its 'Cancel' channel.
+type RetryTransport struct {
+	// Transport is an underlying transport, http.DefaultTransport is used if nil
+	Transport http.RoundTripper
+	// MaxAttempts is a maximum number of attempts for every request
+	MaxAttempts int
+	// BaseDelay is a base delay of exponential backoff
+	BaseDelay time.Duration
+	// MaxDelay is a maximum delay between attempts including one requested by 'Retry-After' header
+	MaxDelay time.Duration
+	// OnResponse is called for every response gotten from Azure
+	OnResponse func(*http.Response)
+}
+
+// errRetryCanceled is returned if the request is canceled while waiting for the next attempt
+var errRetryCanceled = errors.New("request to Azure was canceled while waiting for retry")
+
+// UpstreamTransport sends requests to Azure, it is replaced to record or replay traffic
+var UpstreamTransport http.RoundTripper = http.DefaultTransport
+
+// NewRetryTransport creates RetryTransport configured by command line flags
+func NewRetryTransport(onResponse func(*http.Response)) *RetryTransport {
+	return &RetryTransport{
+		Transport:   UpstreamTransport,
+		MaxAttempts: *config.RetryMaxAttempts,
+		BaseDelay:   *config.RetryBaseDelay,
+		MaxDelay:    *config.RetryMaxDelay,
+		OnResponse:  onResponse,
+	}
+}
+
+// RoundTrip sends request and retries it if needed
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// keep body in memory in order to send it several times
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		r := *req
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.transport().RoundTrip(&r)
+		if err == nil && t.OnResponse != nil {
+			t.OnResponse(resp)
+		}
+		delay, retry := t.backoff(req.Method, resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		config.Logger.Info("Retrying request to Azure:", "method", req.Method, "path", req.URL.String(), "status", status, "error", err, "attempt", attempt, "delay", delay)
+		// the delay is cut by cancellation of the request, ex: by timeout of http.Client
+		select {
+		case <-time.After(delay):
+		case <-req.Cancel:
+			return nil, errRetryCanceled
+		}
+	}
+}
+
+func (t *RetryTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// backoff returns delay before the next attempt and false if request should not be retried
+func (t *RetryTransport) backoff(method string, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= t.MaxAttempts {
+		return 0, false
+	}
+	if err != nil {
+		return t.exponentialDelay(attempt), idempotentMethods[method]
+	}
+	switch resp.StatusCode {
+	case 429:
+	case 500, 502, 503, 504:
+		if !idempotentMethods[method] {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		if delay > t.MaxDelay {
+			delay = t.MaxDelay
+		}
+		return delay, true
+	}
+	return t.exponentialDelay(attempt), true
+}
+
+// exponentialDelay returns random delay between 0 and BaseDelay * 2^(attempt-1) limited by MaxDelay
+func (t *RetryTransport) exponentialDelay(attempt int) time.Duration {
+	delay := t.BaseDelay << uint(attempt-1)
+	if delay > t.MaxDelay || delay <= 0 {
+		delay = t.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+// parseRetryAfter parses value of 'Retry-After' header which could be either number of seconds or HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(time.Now())
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// copyRateLimitHeaders passes Azure rate limit headers to the plugin response
+func copyRateLimitHeaders(from http.Header, to http.Header) {
+	for name, values := range from {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), RateLimitHeaderPrefix) && len(values) > 0 {
+			to.Set(name, values[0])
+			config.Logger.Debug("Azure rate limit:", "header", name, "remaining", values[0])
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+// SessionStore keeps encrypted credential sessions, data passed to the store is already encrypted
+type SessionStore interface {
+	// Save stores session data until the given time
+	Save(id string, data []byte, expiresAt time.Time) error
+	// Load returns session data, nil is returned if session is missing or expired
+	Load(id string) ([]byte, error)
+	// Delete removes session
+	Delete(id string) error
+}
+
+type sessionRecord struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Data      []byte    `json:"data"`
+}
+
+// MemorySessionStore keeps sessions in memory, they are lost on restart of the plugin
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]sessionRecord
+}
+
+// NewMemorySessionStore creates empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]sessionRecord)}
+}
+
+// Save stores session and drops expired ones
+func (s *MemorySessionStore) Save(id string, data []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, record := range s.sessions {
+		if !now.Before(record.ExpiresAt) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[id] = sessionRecord{ExpiresAt: expiresAt, Data: data}
+	return nil
+}
+
+// Load returns session data if session is not expired
+func (s *MemorySessionStore) Load(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if !time.Now().Before(record.ExpiresAt) {
+		delete(s.sessions, id)
+		return nil, nil
+	}
+	return record.Data, nil
+}
+
+// Delete removes session
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// FileSessionStore keeps every session in a separate file of the directory,
+// so sessions survive restart of the plugin and could be shared by instances using the same key
+type FileSessionStore struct {
+	Dir string
+}
+
+// NewFileSessionStore creates session store in the given directory
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{Dir: dir}, nil
+}
+
+// PurgeEvery removes expired sessions in background with the given interval,
+// sessions which are never loaded again would stay on the disk otherwise
+func (s *FileSessionStore) PurgeEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := s.Purge(); err != nil {
+				config.Logger.Error("Expired sessions purging failed:", "error", err)
+			}
+		}
+	}()
+}
+
+// Purge removes files of expired sessions
+func (s *FileSessionStore) Purge() error {
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var record sessionRecord
+		// files which couldn't be decoded are left for investigation
+		if err := json.Unmarshal(b, &record); err != nil {
+			continue
+		}
+		if !now.Before(record.ExpiresAt) {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// path returns file name of the session, session ID is hashed to not expose valid IDs via file names
+func (s *FileSessionStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Save writes session to temporary file and renames it to not leave partially written sessions
+func (s *FileSessionStore) Save(id string, data []byte, expiresAt time.Time) error {
+	b, err := json.Marshal(sessionRecord{ExpiresAt: expiresAt, Data: data})
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(s.Dir, "session")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(b)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), s.path(id))
+}
+
+// Load returns session data if session is not expired, expired session file is removed
+func (s *FileSessionStore) Load(id string) ([]byte, error) {
+	b, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record sessionRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return nil, err
+	}
+	if !time.Now().Before(record.ExpiresAt) {
+		os.Remove(s.path(id))
+		return nil, nil
+	}
+	return record.Data, nil
+}
+
+// Delete removes session file
+func (s *FileSessionStore) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
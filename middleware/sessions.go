@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+const (
+	// SessionHeader could be used instead of 'Session' cookie to pass session ID
+	SessionHeader = "X-Azure-Session"
+	// sessionPurgeInterval is a period expired sessions are removed from the file store with
+	sessionPurgeInterval = 10 * time.Minute
+)
+
+// Session represents credentials stored on the plugin side
+type Session struct {
+	TenantID           string `json:"tenant_id"`
+	ClientID           string `json:"client_id"`
+	ClientSecret       string `json:"client_secret,omitempty"`
+	RefreshToken       string `json:"refresh_token,omitempty"`
+	CertificateProfile string `json:"certificate_profile,omitempty"`
+	SubscriptionID     string `json:"subscription_id,omitempty"`
+}
+
+// credential returns session value of the credential with the given cookie name
+func (s *Session) credential(name string) string {
+	switch name {
+	case "TenantID":
+		return s.TenantID
+	case "ClientID":
+		return s.ClientID
+	case "ClientSecret":
+		return s.ClientSecret
+	case "RefreshToken":
+		return s.RefreshToken
+	case "CertificateProfile":
+		return s.CertificateProfile
+	case "SubscriptionID":
+		return s.SubscriptionID
+	}
+	return ""
+}
+
+var (
+	sessionStore     SessionStore
+	sessionKey       []byte
+	sessionStoreOnce sync.Once
+	sessionStoreErr  error
+)
+
+// getSessionStore returns store selected by 'session_store' flag
+func getSessionStore() (SessionStore, error) {
+	sessionStoreOnce.Do(func() {
+		if *config.SessionKey != "" {
+			sessionKey = []byte(*config.SessionKey)
+		} else {
+			// sessions encrypted by random key become invalid after restart of the plugin
+			sessionKey = make([]byte, 32)
+			if _, err := rand.Read(sessionKey); err != nil {
+				panic(err)
+			}
+		}
+		if *config.SessionStore == "file" {
+			var store *FileSessionStore
+			store, sessionStoreErr = NewFileSessionStore(*config.SessionDir)
+			if sessionStoreErr == nil {
+				store.PurgeEvery(sessionPurgeInterval)
+				sessionStore = store
+			}
+		} else {
+			sessionStore = NewMemorySessionStore()
+		}
+	})
+	return sessionStore, sessionStoreErr
+}
+
+// deriveSessionKey derives separate keys for encryption and signing from the key passed via 'session_key' flag
+func deriveSessionKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// CreateSession stores credentials encrypted and returns signed session ID: "<id>.<signature>"
+func CreateSession(session *Session) (string, time.Time, error) {
+	store, err := getSessionStore()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	b, err := json.Marshal(session)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	data, err := encryptSession(id, b)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(*config.SessionTTL)
+	if err := store.Save(id, data, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return id + "." + signSessionID(id), expiresAt, nil
+}
+
+// GetSession returns credentials of the session, error is returned if session is invalid or expired
+func GetSession(token string) (*Session, error) {
+	id, err := parseSessionToken(token)
+	if err != nil {
+		return nil, err
+	}
+	store, err := getSessionStore()
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Unable to load session: %v", err))
+	}
+	data, err := store.Load(id)
+	if err != nil {
+		config.Logger.Error("Session loading failed:", "error", err)
+		return nil, eh.GenericException("Unable to load session.")
+	}
+	if data == nil {
+		return nil, eh.UnauthorizedException("The session is expired or does not exist.")
+	}
+	b, err := decryptSession(id, data)
+	if err != nil {
+		return nil, eh.UnauthorizedException("The session is invalid.")
+	}
+	session := new(Session)
+	if err := json.Unmarshal(b, session); err != nil {
+		return nil, eh.UnauthorizedException("The session is invalid.")
+	}
+	return session, nil
+}
+
+// DeleteSession removes the session
+func DeleteSession(token string) error {
+	id, err := parseSessionToken(token)
+	if err != nil {
+		return err
+	}
+	store, err := getSessionStore()
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Unable to delete session: %v", err))
+	}
+	if err := store.Delete(id); err != nil {
+		return eh.GenericException(fmt.Sprintf("Unable to delete session: %v", err))
+	}
+	return nil
+}
+
+func parseSessionToken(token string) (string, error) {
+	if _, err := getSessionStore(); err != nil {
+		return "", eh.GenericException(fmt.Sprintf("Unable to load session: %v", err))
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signSessionID(parts[0]))) {
+		return "", eh.UnauthorizedException("The session is invalid.")
+	}
+	return parts[0], nil
+}
+
+func signSessionID(id string) string {
+	mac := hmac.New(sha256.New, deriveSessionKey("signature"))
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encryptSession encrypts session with AES-GCM, session ID is authenticated as well to not let records be swapped
+func encryptSession(id string, plaintext []byte) ([]byte, error) {
+	gcm, err := sessionCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(id)), nil
+}
+
+func decryptSession(id string, data []byte) ([]byte, error) {
+	gcm, err := sessionCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("session data is too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(id))
+}
+
+func sessionCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveSessionKey("encryption"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// getRequestSession returns session passed via 'X-Azure-Session' header or 'Session' cookie, it is nil if session is not passed
+func getRequestSession(c *echo.Context) (*Session, error) {
+	token := c.Request().Header.Get(SessionHeader)
+	if cookie, err := c.Request().Cookie("Session"); err == nil && token == "" {
+		token = cookie.Value
+	}
+	if token == "" {
+		return nil, nil
+	}
+	return GetSession(token)
+}
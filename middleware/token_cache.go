@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+// tokens is an in-process cache of access tokens gotten via client credentials
+var tokens = newTokenCache()
+
+// tokenCache keeps access tokens keyed by tenant/client/resource until they are about to expire.
+// Concurrent requests for the same token wait for a single request to Azure Active Directory,
+// they are counted as waits rather than hits. Expired tokens are evicted when new one is cached.
+type tokenCache struct {
+	mu      sync.Mutex
+	tokens  map[string]*cachedToken
+	flights map[string]*tokenFlight
+	hits    int64
+	misses  int64
+	waits   int64
+}
+
+type cachedToken struct {
+	response  *AuthResponse
+	expiresOn time.Time
+}
+
+// tokenFlight represents request for access token shared by concurrent callers
+type tokenFlight struct {
+	done     chan struct{}
+	response *AuthResponse
+	err      error
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{
+		tokens:  make(map[string]*cachedToken),
+		flights: make(map[string]*tokenFlight),
+	}
+}
+
+// get returns cached token or requests new one if token is missing or expires within 'token_refresh_margin'
+func (tc *tokenCache) get(key string, request func() (*AuthResponse, error)) (response *AuthResponse, err error) {
+	tc.mu.Lock()
+	if token, ok := tc.tokens[key]; ok && time.Now().Add(*config.TokenRefreshMargin).Before(token.expiresOn) {
+		tc.hits++
+		hits, misses, waits := tc.hits, tc.misses, tc.waits
+		tc.mu.Unlock()
+		config.Logger.Debug("Access token cache hit:", "hits", hits, "misses", misses, "waits", waits)
+		return token.response, nil
+	}
+	if flight, ok := tc.flights[key]; ok {
+		tc.waits++
+		tc.mu.Unlock()
+		// token is being requested by another caller
+		<-flight.done
+		return flight.response, flight.err
+	}
+	tc.misses++
+	hits, misses, waits := tc.hits, tc.misses, tc.waits
+	flight := &tokenFlight{done: make(chan struct{})}
+	tc.flights[key] = flight
+	tc.mu.Unlock()
+	config.Logger.Info("Access token cache miss:", "hits", hits, "misses", misses, "waits", waits)
+
+	// the flight is removed and waiters are released even if the request panics, the panic is returned as error
+	defer func() {
+		if r := recover(); r != nil {
+			config.Logger.Error("Access token request panicked:", "error", r)
+			flight.response, flight.err = nil, eh.GenericException(fmt.Sprintf("Access token request failed: %v", r))
+		}
+		tc.mu.Lock()
+		delete(tc.flights, key)
+		if flight.err == nil {
+			tc.evictExpired()
+			tc.tokens[key] = &cachedToken{response: flight.response, expiresOn: flight.response.expiresOn()}
+		}
+		tc.mu.Unlock()
+		close(flight.done)
+		response, err = flight.response, flight.err
+	}()
+	flight.response, flight.err = request()
+	return flight.response, flight.err
+}
+
+// evictExpired removes expired tokens, so tokens of callers which stopped using the plugin are not kept forever.
+// It should be called with the lock held.
+func (tc *tokenCache) evictExpired() {
+	now := time.Now()
+	for key, token := range tc.tokens {
+		if !now.Before(token.expiresOn) {
+			delete(tc.tokens, key)
+		}
+	}
+}
+
+// tokenCacheKey identifies access token, client secret is hashed to not issue the token to a caller with wrong secret
+func tokenCacheKey(authHost string, creds *Credentials) string {
+	if creds.Certificate != nil {
+		return authHost + "|" + creds.TenantID + "|" + creds.ClientID + "|" + creds.Resource + "|cert:" + creds.Certificate.Thumbprint()
+	}
+	secret := sha256.Sum256([]byte(creds.ClientSecret))
+	return authHost + "|" + creds.TenantID + "|" + creds.ClientID + "|" + creds.Resource + "|" + hex.EncodeToString(secret[:])
+}
+
+// expiresOn returns expiration time of access token, zero time is returned if it is unknown
+func (r *AuthResponse) expiresOn() time.Time {
+	if seconds, err := strconv.ParseInt(r.ExpiresOn, 10, 64); err == nil {
+		return time.Unix(seconds, 0)
+	}
+	if seconds, err := strconv.ParseInt(r.ExpiresIn, 10, 64); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return time.Time{}
+}
+
+// tokenExpired checks whether access token with the given 'ExpiresOn' cookie value should be refreshed
+func tokenExpired(expiresOn string) bool {
+	seconds, err := strconv.ParseInt(expiresOn, 10, 64)
+	if err != nil {
+		return false
+	}
+	return !time.Now().Add(*config.TokenRefreshMargin).Before(time.Unix(seconds, 0))
+}
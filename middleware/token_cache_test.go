@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("token cache", func() {
+
+	var tc *tokenCache
+
+	BeforeEach(func() {
+		tc = newTokenCache()
+	})
+
+	// respond returns token request which counts its calls
+	respond := func(calls *int, expiresOn time.Time) func() (*AuthResponse, error) {
+		return func() (*AuthResponse, error) {
+			*calls++
+			return &AuthResponse{AccessToken: "token_" + strconv.Itoa(*calls), ExpiresOn: strconv.FormatInt(expiresOn.Unix(), 10)}, nil
+		}
+	}
+
+	It("requests access token once", func() {
+		calls := 0
+		for i := 0; i < 3; i++ {
+			response, err := tc.get("key", respond(&calls, time.Now().Add(time.Hour)))
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.AccessToken).Should(Equal("token_1"))
+		}
+		Ω(calls).Should(Equal(1))
+		Ω(tc.hits).Should(BeEquivalentTo(2))
+		Ω(tc.misses).Should(BeEquivalentTo(1))
+	})
+
+	It("refreshes access token which expires within the margin", func() {
+		calls := 0
+		_, err := tc.get("key", respond(&calls, time.Now().Add(*config.TokenRefreshMargin/2)))
+		Expect(err).NotTo(HaveOccurred())
+		response, err := tc.get("key", respond(&calls, time.Now().Add(time.Hour)))
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.AccessToken).Should(Equal("token_2"))
+	})
+
+	It("counts callers waiting for the request in flight as waits", func() {
+		release := make(chan struct{})
+		calls := 0
+		request := func() (*AuthResponse, error) {
+			<-release
+			return respond(&calls, time.Now().Add(time.Hour))()
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				response, err := tc.get("key", request)
+				Expect(err).NotTo(HaveOccurred())
+				Ω(response.AccessToken).Should(Equal("token_1"))
+			}()
+		}
+		Eventually(func() int64 {
+			tc.mu.Lock()
+			defer tc.mu.Unlock()
+			return tc.waits
+		}).Should(BeEquivalentTo(2))
+		close(release)
+		wg.Wait()
+		Ω(calls).Should(Equal(1))
+		Ω(tc.hits).Should(BeZero())
+		Ω(tc.misses).Should(BeEquivalentTo(1))
+	})
+
+	It("releases callers waiting for the request which panicked", func() {
+		release := make(chan struct{})
+		request := func() (*AuthResponse, error) {
+			<-release
+			panic("connection reset")
+		}
+		done := make(chan error)
+		for i := 0; i < 2; i++ {
+			go func() {
+				_, err := tc.get("key", request)
+				done <- err
+			}()
+		}
+		Eventually(func() int64 {
+			tc.mu.Lock()
+			defer tc.mu.Unlock()
+			return tc.waits
+		}).Should(BeEquivalentTo(1))
+		close(release)
+		for i := 0; i < 2; i++ {
+			var err error
+			Eventually(done).Should(Receive(&err))
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).Should(ContainSubstring("connection reset"))
+		}
+		Ω(tc.flights).Should(BeEmpty())
+		Ω(tc.tokens).Should(BeEmpty())
+		calls := 0
+		response, err := tc.get("key", respond(&calls, time.Now().Add(time.Hour)))
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.AccessToken).Should(Equal("token_1"))
+	})
+
+	It("evicts expired tokens when new one is cached", func() {
+		tc.tokens["expired"] = &cachedToken{response: &AuthResponse{AccessToken: "expired"}, expiresOn: time.Now().Add(-time.Minute)}
+		tc.tokens["valid"] = &cachedToken{response: &AuthResponse{AccessToken: "valid"}, expiresOn: time.Now().Add(time.Hour)}
+		calls := 0
+		_, err := tc.get("key", respond(&calls, time.Now().Add(time.Hour)))
+		Expect(err).NotTo(HaveOccurred())
+		Ω(tc.tokens).ShouldNot(HaveKey("expired"))
+		Ω(tc.tokens).Should(HaveKey("valid"))
+		Ω(tc.tokens).Should(HaveKey("key"))
+	})
+
+	Describe("requesting access token with client credentials", func() {
+		var do *ghttp.Server
+		var authHost string
+
+		BeforeEach(func() {
+			do = ghttp.NewServer()
+			authHost = config.AuthHost
+			config.AuthHost = do.URL()
+			tokens = newTokenCache()
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/test_tenant/oauth2/token"),
+					ghttp.RespondWith(http.StatusOK, `{"access_token": "cached_access_token", "expires_on": "`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`"}`),
+				),
+			)
+		})
+
+		AfterEach(func() {
+			config.AuthHost = authHost
+			tokens = newTokenCache()
+			do.Close()
+		})
+
+		It("requests access token once", func() {
+			creds := &Credentials{TenantID: "test_tenant", ClientID: "test_client", ClientSecret: "test_secret", RefreshToken: "test_token", GrantType: "client_credentials"}
+			for i := 0; i < 2; i++ {
+				response, err := creds.GetToken()
+				Expect(err).NotTo(HaveOccurred())
+				Ω(response.AccessToken).Should(Equal("cached_access_token"))
+			}
+			Ω(do.ReceivedRequests()).Should(HaveLen(1))
+		})
+
+		It("doesn't issue the token to a caller with another secret", func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/test_tenant/oauth2/token"),
+					ghttp.RespondWith(http.StatusUnauthorized, `{"error": "invalid_client"}`),
+				),
+			)
+			creds := &Credentials{TenantID: "test_tenant", ClientID: "test_client", ClientSecret: "test_secret", GrantType: "client_credentials"}
+			_, err := creds.GetToken()
+			Expect(err).NotTo(HaveOccurred())
+			creds.ClientSecret = "wrong_secret"
+			_, err = creds.GetToken()
+			Expect(err).To(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+		})
+	})
+})
@@ -0,0 +1,118 @@
+package resourceID
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourceID represents Azure Resource Manager resource ID:
+// /subscriptions/{subscription}/resourceGroups/{group}/providers/{namespace}/{type}/{name}[/{child type}/{child name}]
+// Keywords and resource types are matched case-insensitively since Azure doesn't keep their casing.
+type ResourceID struct {
+	SubscriptionID string
+	ResourceGroup  string
+	// Provider is a namespace of resource provider, ex: Microsoft.Network
+	Provider string
+	// Types is a chain of resource types, ex: virtualNetworks, subnets
+	Types []string
+	// Names is a chain of resource names, one per resource type
+	Names []string
+}
+
+// Parse parses resource ID
+func Parse(id string) (*ResourceID, error) {
+	// ignore query string if ID is taken from URL
+	id = strings.SplitN(id, "?", 2)[0]
+	segments := strings.Split(strings.Trim(id, "/"), "/")
+	r := new(ResourceID)
+	i := 0
+	next := func() (string, error) {
+		i++
+		if i >= len(segments) || segments[i] == "" {
+			return "", fmt.Errorf("invalid resource ID '%s': value of '%s' is missing", id, segments[i-1])
+		}
+		return segments[i], nil
+	}
+	var err error
+	for ; i < len(segments); i++ {
+		switch {
+		case strings.EqualFold(segments[i], "subscriptions") && r.SubscriptionID == "" && r.Provider == "":
+			r.SubscriptionID, err = next()
+		case strings.EqualFold(segments[i], "resourceGroups") && r.ResourceGroup == "" && r.Provider == "":
+			r.ResourceGroup, err = next()
+		case strings.EqualFold(segments[i], "providers") && r.Provider == "":
+			r.Provider, err = next()
+		case r.Provider != "":
+			var name string
+			resourceType := segments[i]
+			name, err = next()
+			r.Types = append(r.Types, resourceType)
+			r.Names = append(r.Names, name)
+		default:
+			err = fmt.Errorf("invalid resource ID '%s': unexpected segment '%s'", id, segments[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.SubscriptionID == "" {
+		return nil, fmt.Errorf("invalid resource ID '%s': subscription is missing", id)
+	}
+	return r, nil
+}
+
+// New builds resource ID, typesAndNames is a chain of resource type and name pairs
+func New(subscriptionID string, resourceGroup string, provider string, typesAndNames ...string) *ResourceID {
+	r := &ResourceID{SubscriptionID: subscriptionID, ResourceGroup: resourceGroup, Provider: provider}
+	for i := 0; i+1 < len(typesAndNames); i += 2 {
+		r.Types = append(r.Types, typesAndNames[i])
+		r.Names = append(r.Names, typesAndNames[i+1])
+	}
+	return r
+}
+
+// String returns resource ID in the form used by Azure
+func (r *ResourceID) String() string {
+	id := "/subscriptions/" + r.SubscriptionID
+	if r.ResourceGroup != "" {
+		id += "/resourceGroups/" + r.ResourceGroup
+	}
+	if r.Provider != "" {
+		id += "/providers/" + r.Provider
+		for i, resourceType := range r.Types {
+			id += "/" + resourceType + "/" + r.Names[i]
+		}
+	}
+	return id
+}
+
+// Name returns name of the resource, it is resource group name for resource group ID
+func (r *ResourceID) Name() string {
+	if len(r.Names) == 0 {
+		return r.ResourceGroup
+	}
+	return r.Names[len(r.Names)-1]
+}
+
+// Type returns full resource type, ex: Microsoft.Network/virtualNetworks/subnets
+func (r *ResourceID) Type() string {
+	if r.Provider == "" {
+		return ""
+	}
+	return strings.Join(append([]string{r.Provider}, r.Types...), "/")
+}
+
+// IsType checks whether resource has the given full type ignoring case
+func (r *ResourceID) IsType(resourceType string) bool {
+	return strings.EqualFold(r.Type(), resourceType)
+}
+
+// NameOf returns name of the resource of the given type in the chain, ex: NameOf("virtualNetworks") for subnet ID
+func (r *ResourceID) NameOf(resourceType string) string {
+	for i, t := range r.Types {
+		if strings.EqualFold(t, resourceType) {
+			return r.Names[i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+package resourceID
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestResourceID(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Resource ID Suite")
+}
@@ -0,0 +1,148 @@
+package resourceID
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("resource ID", func() {
+
+	Describe("parsing", func() {
+		examples := []struct {
+			id           string
+			parsed       ResourceID
+			name         string
+			resourceType string
+			// canonical is an ID built back by String, it equals to id if empty
+			canonical string
+		}{
+			{
+				id:           "/subscriptions/sub1/resourceGroups/Group-1",
+				parsed:       ResourceID{SubscriptionID: "sub1", ResourceGroup: "Group-1"},
+				name:         "Group-1",
+				resourceType: "",
+			},
+			{
+				id:           "/subscriptions/sub1/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1",
+				parsed:       ResourceID{SubscriptionID: "sub1", ResourceGroup: "Group-1", Provider: "Microsoft.Network", Types: []string{"virtualNetworks"}, Names: []string{"net1"}},
+				name:         "net1",
+				resourceType: "Microsoft.Network/virtualNetworks",
+			},
+			{
+				id:           "/subscriptions/sub1/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1/subnets/sub-1",
+				parsed:       ResourceID{SubscriptionID: "sub1", ResourceGroup: "Group-1", Provider: "Microsoft.Network", Types: []string{"virtualNetworks", "subnets"}, Names: []string{"net1", "sub-1"}},
+				name:         "sub-1",
+				resourceType: "Microsoft.Network/virtualNetworks/subnets",
+			},
+			{
+				id:           "/SUBSCRIPTIONS/sub1/RESOURCEGROUPS/group-1/PROVIDERS/microsoft.network/VirtualNetworks/Net1",
+				parsed:       ResourceID{SubscriptionID: "sub1", ResourceGroup: "group-1", Provider: "microsoft.network", Types: []string{"VirtualNetworks"}, Names: []string{"Net1"}},
+				name:         "Net1",
+				resourceType: "microsoft.network/VirtualNetworks",
+				canonical:    "/subscriptions/sub1/resourceGroups/group-1/providers/microsoft.network/VirtualNetworks/Net1",
+			},
+			{
+				id:           "/subscriptions/sub1/providers/Microsoft.Compute/locations/westus/operations/op1",
+				parsed:       ResourceID{SubscriptionID: "sub1", Provider: "Microsoft.Compute", Types: []string{"locations", "operations"}, Names: []string{"westus", "op1"}},
+				name:         "op1",
+				resourceType: "Microsoft.Compute/locations/operations",
+			},
+			{
+				id:           "subscriptions/sub1/resourceGroups/Group-1/providers/Microsoft.Compute/virtualMachines/vm1/?api-version=2016-03-30",
+				parsed:       ResourceID{SubscriptionID: "sub1", ResourceGroup: "Group-1", Provider: "Microsoft.Compute", Types: []string{"virtualMachines"}, Names: []string{"vm1"}},
+				name:         "vm1",
+				resourceType: "Microsoft.Compute/virtualMachines",
+				canonical:    "/subscriptions/sub1/resourceGroups/Group-1/providers/Microsoft.Compute/virtualMachines/vm1",
+			},
+		}
+
+		for _, example := range examples {
+			example := example
+			It("parses "+example.id, func() {
+				id, err := Parse(example.id)
+				Expect(err).NotTo(HaveOccurred())
+				Ω(*id).Should(Equal(example.parsed))
+				Ω(id.Name()).Should(Equal(example.name))
+				Ω(id.Type()).Should(Equal(example.resourceType))
+				canonical := example.canonical
+				if canonical == "" {
+					canonical = example.id
+				}
+				Ω(id.String()).Should(Equal(canonical))
+			})
+		}
+	})
+
+	Describe("parsing malformed ID", func() {
+		examples := [][2]string{
+			{"", "unexpected segment ''"},
+			{"/", "unexpected segment ''"},
+			{"/subscriptions", "value of 'subscriptions' is missing"},
+			{"/subscriptions//resourceGroups/Group-1", "value of 'subscriptions' is missing"},
+			{"/subscriptions/sub1/resourceGroups", "value of 'resourceGroups' is missing"},
+			{"/subscriptions/sub1/resourceGroups/Group-1/providers", "value of 'providers' is missing"},
+			{"/subscriptions/sub1/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks", "value of 'virtualNetworks' is missing"},
+			{"/subscriptions/sub1/resourceGroups/Group-1/virtualNetworks/net1", "unexpected segment 'virtualNetworks'"},
+			{"/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1", "subscription is missing"},
+			{"/subscriptions/sub1/subscriptions/sub2", "unexpected segment 'subscriptions'"},
+		}
+
+		for _, example := range examples {
+			id, message := example[0], example[1]
+			It("fails to parse '"+id+"'", func() {
+				_, err := Parse(id)
+				Ω(err).Should(HaveOccurred())
+				Ω(err.Error()).Should(ContainSubstring(message))
+			})
+		}
+	})
+
+	Describe("checking type", func() {
+		examples := []struct {
+			resourceType string
+			matches      bool
+		}{
+			{"Microsoft.Network/virtualNetworks/subnets", true},
+			{"microsoft.network/VIRTUALNETWORKS/Subnets", true},
+			{"Microsoft.Network/virtualNetworks", false},
+			{"subnets", false},
+			{"Microsoft.Compute/virtualNetworks/subnets", false},
+			{"", false},
+		}
+		id := New("sub1", "Group-1", "Microsoft.Network", "virtualNetworks", "net1", "subnets", "sub-1")
+
+		for _, example := range examples {
+			example := example
+			It("matches '"+example.resourceType+"' ignoring case", func() {
+				Ω(id.IsType(example.resourceType)).Should(Equal(example.matches))
+			})
+		}
+
+		It("matches empty type of resource group", func() {
+			Ω(New("sub1", "Group-1", "").IsType("")).Should(BeTrue())
+		})
+	})
+
+	Describe("getting name of the type in the chain", func() {
+		examples := [][2]string{
+			{"virtualNetworks", "net1"},
+			{"VIRTUALNETWORKS", "net1"},
+			{"subnets", "sub-1"},
+			{"networkInterfaces", ""},
+			{"", ""},
+		}
+		id := New("sub1", "Group-1", "Microsoft.Network", "virtualNetworks", "net1", "subnets", "sub-1")
+
+		for _, example := range examples {
+			resourceType, name := example[0], example[1]
+			It("returns '"+name+"' for '"+resourceType+"'", func() {
+				Ω(id.NameOf(resourceType)).Should(Equal(name))
+			})
+		}
+	})
+
+	It("builds ID with odd number of types and names ignoring the last type", func() {
+		id := New("sub1", "Group-1", "Microsoft.Network", "virtualNetworks", "net1", "subnets")
+		Ω(id.String()).Should(Equal("/subscriptions/sub1/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1"))
+	})
+})
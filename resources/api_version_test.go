@@ -0,0 +1,116 @@
+package resources
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+// verifyAPIVersion checks 'api-version' query param of the request sent to Azure
+func verifyAPIVersion(apiVersion string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		Ω(req.URL.Query().Get("api-version")).Should(Equal(apiVersion))
+	}
+}
+
+var _ = Describe("API version", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("listing with overridden API version", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath, "api-version=2017-03-01"),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks?api_version=2017-03-01")
+		})
+
+		It("sends requested API version to Azure", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(1))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+
+	Describe("listing with invalid API version", func() {
+		BeforeEach(func() {
+			response, err = client.Get("/resource_groups/Group-3/networks?api_version=latest")
+		})
+
+		It("returns validation error", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(BeEmpty())
+			Ω(response.Status).Should(Equal(400))
+			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'api_version' parameter.\"}"))
+		})
+	})
+
+	Describe("listing with overridden API version and next page", func() {
+		BeforeEach(func() {
+			nextLink := do.URL() + "/subscriptions/" + subscriptionID + "/resourceGroups/Group-3/" + networkPath + "?api-version=2016-03-30&$skiptoken=page2"
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					verifyAPIVersion("2017-03-01"),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net1","name":"net1"}],"nextLink":"`+nextLink+`"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					verifyAPIVersion("2016-03-30"),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2"}]}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks?api_version=2017-03-01")
+		})
+
+		It("follows the next page as it is returned by Azure", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+
+	Describe("listing child resources of all parents with overridden API version", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/"+networkPath),
+					verifyAPIVersion(config.APIVersion("Microsoft.Network/virtualNetworks")),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2"}]}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2/subnets"),
+					verifyAPIVersion("2017-03-01"),
+					ghttp.RespondWith(http.StatusOK, `{"value":[]}`),
+				),
+			)
+			response, err = client.Get("/subnets?api_version=2017-03-01")
+		})
+
+		It("applies the version to child resources only", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+})
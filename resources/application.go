@@ -26,6 +26,15 @@ type servicePrincipal struct {
 	ObjectID string `json:"objectId"`
 }
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:        "application",
+		ContentType: "application/json",
+		Actions:     []string{"register", "unregister"},
+		Setup:       SetupAuthRoutes,
+	})
+}
+
 // SetupAuthRoutes declares routes for Application resource
 func SetupAuthRoutes(e *echo.Group) {
 	e.Post("/application/register", assignRoleToApp)
@@ -33,7 +42,12 @@ func SetupAuthRoutes(e *echo.Group) {
 }
 
 //Assign RBAC role to Application
-func assignRoleToApp(c *echo.Context) error {
+func assignRoleToApp(c *echo.Context) (err error) {
+	if err := rejectDryRun(c); err != nil {
+		return err
+	}
+	event := startAudit(c, "assign_role")
+	defer func() { event.finish(c, err) }()
 	principalID, subscription, err := prepareParams(c)
 	if err != nil {
 		return err
@@ -46,7 +60,7 @@ func assignRoleToApp(c *echo.Context) error {
 		},
 	}
 
-	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.authorization/roleassignments/%s?api-version=%s", config.BaseURL, subscription, name, "2014-10-01-preview")
+	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.authorization/roleassignments/%s?api-version=%s", config.BaseURL, subscription, name, config.APIVersion("Microsoft.Authorization/roleAssignments"))
 	config.Logger.Info("Assign RBAC role to Application with params:", "properties", properties)
 	config.Logger.Info("Assign RBAC role to Application path: ", "path", path)
 
@@ -56,6 +70,7 @@ func assignRoleToApp(c *echo.Context) error {
 	}
 	var reader io.Reader
 	reader = bytes.NewBufferString(string(by))
+	event.request("PUT", path, properties)
 	request, _ := http.NewRequest("PUT", path, reader)
 	request.Header.Add("Content-Type", config.MediaType)
 	request.Header.Add("Accept", config.MediaType)
@@ -65,27 +80,31 @@ func assignRoleToApp(c *echo.Context) error {
 		return err
 	}
 	response, err := client.Do(request)
-	defer response.Body.Close()
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("Assign RBAC role to Application failed: %v", err))
 	}
+	defer response.Body.Close()
+	event.response(response)
 
 	b, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
 
-	if response.StatusCode >= 400 {
-		return eh.GenericException(fmt.Sprintf("Assign RBAC role to Application failed: %s", string(b)))
-	}
-	if response.StatusCode != 201 {
-		return eh.GenericException(fmt.Sprintf("Assign RBAC role to Application returned status %d with body: %s", response.StatusCode, string(b)))
+	// status of unexpected response is passed as is, like the one of Azure error
+	if response.StatusCode >= 300 {
+		return eh.AzureException("Assign RBAC role to Application failed", response, b)
 	}
 	return c.NoContent(201)
 }
 
 // Delete Role assignment in order to un-register application
-func unassignRoleFromApp(c *echo.Context) error {
+func unassignRoleFromApp(c *echo.Context) (err error) {
+	if err := rejectDryRun(c); err != nil {
+		return err
+	}
+	event := startAudit(c, "unassign_role")
+	defer func() { event.finish(c, err) }()
 	principalID, subscription, err := prepareParams(c)
 	if err != nil {
 		return err
@@ -94,9 +113,10 @@ func unassignRoleFromApp(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.authorization/roleassignments/%s?api-version=%s", config.BaseURL, subscription, name, "2014-10-01-preview")
+	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.authorization/roleassignments/%s?api-version=%s", config.BaseURL, subscription, name, config.APIVersion("Microsoft.Authorization/roleAssignments"))
 	config.Logger.Info("Unassign RBAC role from Application path: ", "path", path)
 
+	event.request("DELETE", path, nil)
 	req, err := http.NewRequest("DELETE", path, nil)
 	req.Header.Add("User-Agent", config.UserAgent)
 	client, err := GetAzureClient(c)
@@ -104,24 +124,25 @@ func unassignRoleFromApp(c *echo.Context) error {
 		return err
 	}
 	response, err := client.Do(req)
-	defer response.Body.Close()
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("Unassignment RBAC role from Application failed: %v", err))
 	}
+	defer response.Body.Close()
+	event.response(response)
 
 	b, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
 	if response.StatusCode >= 400 {
-		return eh.GenericException(fmt.Sprintf("Unassignment RBAC role from Application failed: %s", string(b)))
+		return eh.AzureException("Unassignment RBAC role from Application failed", response, b)
 	}
 	return c.NoContent(204)
 }
 
 func findRoleAssignmentID(c *echo.Context, principalID string, subscription string) (string, error) {
 	roleDefinitionID := fmt.Sprintf("/subscriptions/%s/%s/%s", subscription, authPath, roleContributorID)
-	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.authorization/roleassignments?api-version=%s", config.BaseURL, subscription, "2014-10-01-preview")
+	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.authorization/roleassignments?api-version=%s", config.BaseURL, subscription, config.APIVersion("Microsoft.Authorization/roleAssignments"))
 	roleAssignments, err := GetResources(c, path)
 	if err != nil {
 		return "", err
@@ -142,30 +163,35 @@ func prepareParams(c *echo.Context) (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
+	env, err := GetEnvironment(c)
+	if err != nil {
+		return "", "", err
+	}
 	creds.GrantType = "client_credentials"
-	creds.Resource = "https://graph.windows.net/"
-	authResponse, err := creds.RequestToken()
+	creds.Resource = env.GraphURL + "/"
+	creds.AuthHost = env.AuthHost
+	authResponse, err := creds.GetToken()
 	if err != nil {
 		return "", "", err
 	}
-	t := &oauth.Transport{Token: &oauth.Token{AccessToken: authResponse.AccessToken}}
+	t := &oauth.Transport{Token: &oauth.Token{AccessToken: authResponse.AccessToken}, Transport: am.NewRetryTransport(nil)}
 	graphClient := t.Client()
-	principalID, err := getServicePrincipal(graphClient, creds)
+	principalID, err := getServicePrincipal(graphClient, env.GraphURL, creds)
 	if err != nil {
 		return "", "", err
 	}
 	return principalID, creds.Subscription, nil
 }
 
-func getServicePrincipal(client *http.Client, creds *am.Credentials) (string, error) {
-	path := fmt.Sprintf("%s/%s/servicePrincipals?api-version=1.5", config.GraphURL, creds.TenantID)
+func getServicePrincipal(client *http.Client, graphURL string, creds *am.Credentials) (string, error) {
+	path := fmt.Sprintf("%s/%s/servicePrincipals?api-version=1.5", graphURL, creds.TenantID)
 	path = path + "&$filter=appId%20eq%20'" + creds.ClientID + "'"
 	config.Logger.Info("Get Service Principals request: ", "path", path)
 	resp, err := client.Get(path)
-	defer resp.Body.Close()
 	if err != nil {
 		return "", eh.GenericException(fmt.Sprintf("Error has occurred while sending request: %v", err))
 	}
+	defer resp.Body.Close()
 
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -173,7 +199,7 @@ func getServicePrincipal(client *http.Client, creds *am.Credentials) (string, er
 	}
 
 	if resp.StatusCode >= 400 {
-		return "", eh.GenericException(fmt.Sprintf("Get Service Principals failed: %s", string(b)))
+		return "", eh.AzureException("Get Service Principals failed", resp, b)
 	}
 	var response map[string][]*servicePrincipal
 
@@ -101,6 +101,84 @@ var _ = Describe("application", func() {
 		})
 	})
 
+	Describe("register with rejected credentials", func() {
+		BeforeEach(func() {
+			AccessTokenTest = ""
+			CredsTest = am.Credentials{
+				TenantID:     "test_tenant",
+				ClientID:     "test_client",
+				ClientSecret: "wrong_secret",
+				RefreshToken: "test_token",
+				Subscription: "test_subscription",
+			}
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/test_tenant/oauth2/token"),
+					ghttp.RespondWith(http.StatusUnauthorized, `{"error":"invalid_client","error_description":"AADSTS70002: Error validating credentials. AADSTS50012: Invalid client secret is provided.","error_codes":[70002,50012]}`),
+				),
+			)
+			response, err = client.Post("/application/register", "")
+		})
+
+		AfterEach(func() {
+			AccessTokenTest = "fake"
+			CredsTest = am.Credentials{
+				Subscription: subscriptionID,
+			}
+		})
+
+		It("returns status code and AAD error gotten from Azure Active Directory", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(401))
+			Ω(response.Body).Should(MatchJSON(`{"Code":401,"Message":"Access token refreshing failed: AADSTS70002: Error validating credentials. AADSTS50012: Invalid client secret is provided.","error":{"code":"invalid_client","message":"AADSTS70002: Error validating credentials. AADSTS50012: Invalid client secret is provided."},"error_codes":[70002,50012]}`))
+		})
+	})
+
+	Describe("register with unexpected status of role assignment", func() {
+		BeforeEach(func() {
+			AccessTokenTest = ""
+			CredsTest = am.Credentials{
+				TenantID:     "test_tenant",
+				ClientID:     "test_client",
+				ClientSecret: "test_secret",
+				RefreshToken: "test_token",
+				Subscription: "test_subscription",
+			}
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/test_tenant/oauth2/token"),
+					ghttp.RespondWith(http.StatusOK, authRsponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/test_tenant/oauth2/token"),
+					ghttp.RespondWith(http.StatusOK, authRsponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/test_tenant/servicePrincipals", "api-version=1.5&$filter=appId%20eq%20'test_client'"),
+					ghttp.RespondWith(http.StatusOK, servicePrincipalResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", MatchRegexp(`/subscriptions/test_subscription/providers/microsoft.authorization/roleassignments/\w`)),
+					ghttp.RespondWith(http.StatusNotModified, ""),
+				),
+			)
+			response, err = client.Post("/application/register", "")
+		})
+
+		AfterEach(func() {
+			AccessTokenTest = "fake"
+			CredsTest = am.Credentials{
+				Subscription: subscriptionID,
+			}
+		})
+
+		It("returns status code gotten from Azure", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(4))
+			Ω(response.Status).Should(Equal(304))
+		})
+	})
+
 	Describe("unregister", func() {
 		BeforeEach(func() {
 			// make empty access token and subscription in order to refresh access token
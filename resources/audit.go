@@ -0,0 +1,254 @@
+package resources
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+// auditWebhookQueueSize is a number of audit events waiting to be posted to the webhook, new events are dropped if the queue is full
+const auditWebhookQueueSize = 1000
+
+// auditEvent describes mutating call or call exposing secrets
+type auditEvent struct {
+	Time time.Time `json:"time"`
+	// Action is a name of the call, ex: create, delete, register_provider
+	Action string `json:"action"`
+	// ClientID and TokenSubject identify the caller, the token is not verified by the plugin (Azure does it)
+	ClientID     string `json:"client_id,omitempty"`
+	TokenSubject string `json:"token_subject,omitempty"`
+	Subscription string `json:"subscription,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	// Verb is a method of the request sent to Azure, it is empty if the request is not sent
+	Verb           string      `json:"verb,omitempty"`
+	Body           interface{} `json:"body,omitempty"`
+	Status         int         `json:"status"`
+	UpstreamStatus int         `json:"upstream_status,omitempty"`
+	OperationID    string      `json:"operation_id,omitempty"`
+	DurationMs     int64       `json:"duration_ms"`
+	Error          string      `json:"error,omitempty"`
+	started        time.Time
+}
+
+// auditSink writes encoded audit events
+type auditSink interface {
+	Write(event []byte) error
+}
+
+var (
+	auditLog     auditSink
+	auditLogOnce sync.Once
+)
+
+// OpenAuditLog opens sink selected by 'audit_sink' flag, it is called on start so mutating calls are not served without audit
+func OpenAuditLog() error {
+	var err error
+	auditLogOnce.Do(func() {
+		auditLog, err = openAuditSink()
+	})
+	return err
+}
+
+// getAuditLog returns sink selected by 'audit_sink' flag, nil is returned if audit is disabled or the sink could not be opened
+func getAuditLog() auditSink {
+	if err := OpenAuditLog(); err != nil {
+		config.Logger.Error("Unable to open audit sink:", "sink", *config.AuditSink, "error", err)
+	}
+	return auditLog
+}
+
+// openAuditSink returns nil sink on failure, so typed nil pointer is never kept as the sink
+func openAuditSink() (auditSink, error) {
+	switch *config.AuditSink {
+	case "file":
+		sink, err := newFileAuditSink(*config.AuditFile)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	case "syslog":
+		sink, err := newSyslogAuditSink(config.SyslogAddr)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	case "webhook":
+		return newWebhookAuditSink(*config.AuditWebhook), nil
+	}
+	return nil, nil
+}
+
+// startAudit begins audit event of the call, it is written by finish:
+//   event := startAudit(c, "create")
+//   defer func() { event.finish(c, err) }()
+func startAudit(c *echo.Context, action string) *auditEvent {
+	now := time.Now().UTC()
+	event := &auditEvent{Time: now, Action: action, started: now}
+	if creds, ok := c.Get("clientCreds").(*am.Credentials); ok {
+		event.ClientID = creds.ClientID
+		event.Subscription = creds.Subscription
+	}
+	if token, ok := c.Get("accessToken").(string); ok {
+		claims := tokenClaims(token)
+		event.TokenSubject, _ = claims["sub"].(string)
+		if event.ClientID == "" {
+			event.ClientID, _ = claims["appid"].(string)
+		}
+	}
+	return event
+}
+
+// request records the request sent to Azure, secrets of the body are masked,
+// resource ID is taken from the path, actions posted to the resource (ex: listKeys) are trimmed
+func (e *auditEvent) request(method string, path string, params interface{}) {
+	e.Verb = method
+	if u, err := url.Parse(path); err == nil {
+		e.ResourceID = u.Path
+		if method == "POST" {
+			e.ResourceID = e.ResourceID[:strings.LastIndex(e.ResourceID, "/")]
+		}
+	}
+	if params != nil {
+		e.Body, _ = redactParams(params)
+	}
+}
+
+// response records status of the Azure response and ID of async operation started by the request
+func (e *auditEvent) response(resp *http.Response) {
+	e.UpstreamStatus = resp.StatusCode
+	if resp.StatusCode < 400 {
+		if operationURL := getOperationURL(resp.Header); operationURL != "" {
+			e.OperationID = getOperationID(operationURL)
+		}
+	}
+}
+
+// finish completes the event with the outcome of the call and writes it to the audit sink
+func (e *auditEvent) finish(c *echo.Context, err error) {
+	sink := getAuditLog()
+	// nothing is sent to Azure in dry run
+	if sink == nil || (e.Verb == "" && isDryRun(c)) {
+		return
+	}
+	e.DurationMs = int64(time.Since(e.started) / time.Millisecond)
+	if err != nil {
+		e.Status = eh.StatusCode(err)
+		e.Error = err.Error()
+	} else {
+		e.Status = c.Response().Status()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		config.Logger.Error("Unable to encode audit event:", "action", e.Action, "error", err)
+		return
+	}
+	if err := sink.Write(b); err != nil {
+		config.Logger.Error("Unable to write audit event:", "error", err, "event", string(b))
+	}
+}
+
+// tokenClaims decodes claims of JWT access token without verification, empty claims are returned for opaque tokens
+func tokenClaims(token string) map[string]interface{} {
+	claims := make(map[string]interface{})
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims
+	}
+	json.Unmarshal(b, &claims)
+	return claims
+}
+
+// fileAuditSink appends events to JSON-lines file
+type fileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileAuditSink(path string) (*fileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{file: file}, nil
+}
+
+func (s *fileAuditSink) Write(event []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.file.Write(append(event, '\n'))
+	return err
+}
+
+// syslogAuditSink sends events to syslog with its own tag, so they could be routed apart from the plugin logs
+type syslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogAuditSink(addr string) (*syslogAuditSink, error) {
+	writer, err := syslog.Dial("tcp", addr, syslog.LOG_LOCAL0|syslog.LOG_NOTICE, config.ApplicationName+"_audit")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogAuditSink{writer: writer}, nil
+}
+
+func (s *syslogAuditSink) Write(event []byte) error {
+	return s.writer.Notice(string(event))
+}
+
+// webhookAuditSink posts events to the webhook one by one in background, so calls are not slowed down by the webhook
+type webhookAuditSink struct {
+	url    string
+	client *http.Client
+	events chan []byte
+}
+
+func newWebhookAuditSink(url string) *webhookAuditSink {
+	s := &webhookAuditSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan []byte, auditWebhookQueueSize),
+	}
+	go s.post()
+	return s
+}
+
+func (s *webhookAuditSink) Write(event []byte) error {
+	select {
+	case s.events <- event:
+		return nil
+	default:
+		return fmt.Errorf("queue of audit webhook is full")
+	}
+}
+
+func (s *webhookAuditSink) post() {
+	for event := range s.events {
+		resp, err := s.client.Post(s.url, config.MediaType, bytes.NewReader(event))
+		if err != nil {
+			config.Logger.Error("Unable to post audit event:", "error", err, "event", string(event))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			config.Logger.Error("Audit webhook rejected event:", "status", resp.StatusCode, "event", string(event))
+		}
+	}
+}
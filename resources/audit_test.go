@@ -0,0 +1,244 @@
+package resources
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+// recordingAuditSink keeps decoded audit events in memory
+type recordingAuditSink struct {
+	mu     sync.Mutex
+	events []map[string]interface{}
+}
+
+func (s *recordingAuditSink) Write(event []byte) error {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(event, &decoded); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, decoded)
+	return nil
+}
+
+func (s *recordingAuditSink) Events() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+var _ = Describe("audit log", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+	var sink *recordingAuditSink
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+		auditLogOnce.Do(func() {})
+		sink = new(recordingAuditSink)
+		auditLog = sink
+	})
+
+	AfterEach(func() {
+		auditLog = nil
+		do.Close()
+	})
+
+	Describe("creating", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2"),
+					ghttp.RespondWith(201, listOneNetworkResponse),
+				),
+			)
+			response, err = client.Post("/resource_groups/Group-3/networks", "{\"name\": \"net2\", \"location\": \"westus\", \"address_prefixes\": [\"10.0.0.0/16\"]}")
+		})
+
+		It("writes one event describing the call", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(201))
+			Ω(sink.Events()).Should(HaveLen(1))
+			event := sink.Events()[0]
+			Ω(event["action"]).Should(Equal("create"))
+			Ω(event["subscription"]).Should(Equal(subscriptionID))
+			Ω(event["resource_id"]).Should(Equal("/subscriptions/" + subscriptionID + "/resourceGroups/Group-3/" + networkPath + "/net2"))
+			Ω(event["verb"]).Should(Equal("PUT"))
+			Ω(event["status"]).Should(BeEquivalentTo(201))
+			Ω(event["upstream_status"]).Should(BeEquivalentTo(201))
+			Ω(event["body"]).Should(HaveKeyWithValue("name", "net2"))
+			Ω(event).Should(HaveKey("duration_ms"))
+		})
+	})
+
+	Describe("creating with error from Azure", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2"),
+					ghttp.RespondWith(http.StatusConflict, `{"error":{"code":"InUseSubnetCannotBeDeleted","message":"Subnet default is in use."}}`),
+				),
+			)
+			response, err = client.Post("/resource_groups/Group-3/networks", "{\"name\": \"net2\", \"location\": \"westus\", \"address_prefixes\": [\"10.0.0.0/16\"]}")
+		})
+
+		It("records the error", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(sink.Events()).Should(HaveLen(1))
+			event := sink.Events()[0]
+			Ω(event["status"]).Should(BeEquivalentTo(409))
+			Ω(event["upstream_status"]).Should(BeEquivalentTo(409))
+			Ω(event["error"]).Should(ContainSubstring("Subnet default is in use."))
+		})
+	})
+
+	Describe("creating in dry run", func() {
+		BeforeEach(func() {
+			response, err = client.Post("/resource_groups/Group-3/networks?dry_run=true", "{\"name\": \"net2\", \"location\": \"westus\", \"address_prefixes\": [\"10.0.0.0/16\"]}")
+		})
+
+		It("writes no event", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(sink.Events()).Should(BeEmpty())
+		})
+	})
+
+	Describe("deleting asynchronously", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net1"),
+					ghttp.RespondWith(202, "", http.Header{
+						"Azure-Asyncoperation": {do.URL() + "/subscriptions/" + subscriptionID + "/providers/Microsoft.Network/locations/westus/operations/8c1d1bc4?api-version=2016-03-30"},
+					}),
+				),
+			)
+			response, err = client.Delete("/resource_groups/Group-3/networks/net1")
+		})
+
+		It("records ID of the operation", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(sink.Events()).Should(HaveLen(1))
+			event := sink.Events()[0]
+			Ω(event["action"]).Should(Equal("delete"))
+			Ω(event["verb"]).Should(Equal("DELETE"))
+			Ω(event["status"]).Should(BeEquivalentTo(202))
+			Ω(event["operation_id"]).Should(Equal("8c1d1bc4"))
+			Ω(event).ShouldNot(HaveKey("body"))
+		})
+	})
+
+	Describe("listing storage account keys with JWT access token", func() {
+		BeforeEach(func() {
+			claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-subject","appid":"app-id"}`))
+			AccessTokenTest = "header." + claims + ".signature"
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/providers/Microsoft.Storage/storageAccounts/sa1/listKeys"),
+					ghttp.RespondWith(200, `{"keys":[{"keyName":"key1","value":"secret","permissions":"Full"}]}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-1/storage_accounts/sa1/keys")
+		})
+
+		AfterEach(func() {
+			AccessTokenTest = "fake"
+		})
+
+		It("identifies the caller by the token", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(sink.Events()).Should(HaveLen(1))
+			event := sink.Events()[0]
+			Ω(event["action"]).Should(Equal("list_keys"))
+			Ω(event["token_subject"]).Should(Equal("user-subject"))
+			Ω(event["client_id"]).Should(Equal("app-id"))
+			Ω(event["verb"]).Should(Equal("POST"))
+			Ω(event["resource_id"]).Should(Equal("/subscriptions/" + subscriptionID + "/resourceGroups/Group-1/providers/Microsoft.Storage/storageAccounts/sa1"))
+			Ω(event["status"]).Should(BeEquivalentTo(200))
+		})
+	})
+
+	It("masks secrets of the body", func() {
+		event := new(auditEvent)
+		event.request("PUT", do.URL()+"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Compute/virtualMachines/vm1?api-version=2016-03-30", map[string]interface{}{
+			"properties": map[string]interface{}{"osProfile": map[string]interface{}{"adminUsername": "admin", "adminPassword": "secret"}},
+		})
+		Ω(event.ResourceID).Should(Equal("/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Compute/virtualMachines/vm1"))
+		b, err := json.Marshal(event.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Ω(string(b)).Should(MatchJSON(`{"properties":{"osProfile":{"adminUsername":"admin","adminPassword":"REDACTED"}}}`))
+	})
+
+	Describe("file sink", func() {
+		It("appends events as JSON lines", func() {
+			dir, err := ioutil.TempDir("", "audit")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "audit.log")
+			fileSink, err := newFileAuditSink(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fileSink.Write([]byte(`{"action":"create"}`))).To(Succeed())
+			Expect(fileSink.Write([]byte(`{"action":"delete"}`))).To(Succeed())
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Ω(strings.Split(strings.TrimSpace(string(b)), "\n")).Should(Equal([]string{`{"action":"create"}`, `{"action":"delete"}`}))
+		})
+	})
+
+	Describe("opening file sink in missing directory", func() {
+		var sinkName, path string
+
+		BeforeEach(func() {
+			sinkName, path = *config.AuditSink, *config.AuditFile
+			*config.AuditSink, *config.AuditFile = "file", "/nonexistent/audit/audit.log"
+			auditLogOnce = sync.Once{}
+			auditLog = nil
+		})
+
+		AfterEach(func() {
+			*config.AuditSink, *config.AuditFile = sinkName, path
+		})
+
+		It("fails and keeps audit disabled", func() {
+			Ω(OpenAuditLog()).ShouldNot(Succeed())
+			Ω(getAuditLog() == nil).Should(BeTrue())
+			event := &auditEvent{Action: "create", Verb: "PUT"}
+			Ω(func() { event.finish(nil, nil) }).ShouldNot(Panic())
+		})
+	})
+
+	Describe("webhook sink", func() {
+		It("posts events to the webhook", func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/audit"),
+					ghttp.VerifyJSON(`{"action":"create"}`),
+					ghttp.RespondWith(204, ""),
+				),
+			)
+			webhookSink := newWebhookAuditSink(do.URL() + "/audit")
+			Expect(webhookSink.Write([]byte(`{"action":"create"}`))).To(Succeed())
+			Eventually(do.ReceivedRequests).Should(HaveLen(1))
+			close(webhookSink.events)
+		})
+	})
+})
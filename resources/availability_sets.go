@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -11,8 +10,7 @@ import (
 )
 
 const (
-	availabilitySetPath       = "providers/Microsoft.Compute/availabilitySets"
-	availabilitySetApiVersion = "2016-02-01"
+	availabilitySetPath = "providers/Microsoft.Compute/availabilitySets"
 )
 
 type (
@@ -27,13 +25,15 @@ type (
 	}
 
 	availabilitySetRequestParams struct {
-		Name     string `json:"name"`
-		Location string `json:"location"`
+		Name     string                 `json:"name"`
+		Location string                 `json:"location"`
+		Tags     map[string]interface{} `json:"tags,omitempty"`
 	}
 	availabilitySetCreateParams struct {
-		Name     string `json:"name,omitempty"`
-		Location string `json:"location,omitempty"`
-		Group    string `json:"group_name,omitempty"`
+		Name     string                 `json:"name,omitempty" validate:"required"`
+		Location string                 `json:"location,omitempty" validate:"required"`
+		Group    string                 `json:"group_name,omitempty"`
+		Tags     map[string]interface{} `json:"tags,omitempty"`
 	}
 	// AvailabilitySet is base struct for Azure Availability Set resource to store input create params,
 	// request create params and response params gotten from cloud.
@@ -44,6 +44,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "availability_set",
+		ContentType:    "vnd.rightscale.availability_set+json",
+		Actions:        crudActions,
+		Setup:          SetupAvailabilitySetRoutes,
+		CreateParams:   availabilitySetCreateParams{},
+		ResponseParams: availabilitySetResponseParams{},
+	})
+}
+
 // SetupAvailabilitySetRoutes declares routes for AvailabilitySet resource
 func SetupAvailabilitySetRoutes(e *echo.Group) {
 	e.Get("/availability_sets", listAllAvailabilitySets)
@@ -53,6 +64,8 @@ func SetupAvailabilitySetRoutes(e *echo.Group) {
 	group.Get("", listAvailabilitySets)
 	group.Get("/:id", listOneAvailabilitySet)
 	group.Post("", createAvailabilitySet)
+	group.Put("/:id", updateAvailabilitySet)
+	group.Patch("/:id", updateAvailabilitySet)
 	group.Delete("/:id", deleteAvailabilitySet)
 }
 
@@ -65,30 +78,25 @@ func listAllAvailabilitySets(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	var sets []map[string]interface{}
 	as := new(AvailabilitySet)
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups?api-version=%s", config.BaseURL, creds.Subscription, resourceGroupApiVersion)
+	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups?api-version=%s", config.BaseURL, creds.Subscription, config.APIVersion("Microsoft.Resources/resourceGroups"))
 	resourceGroups, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
+	listings := make([]childListing, 0, len(resourceGroups))
 	for _, group := range resourceGroups {
 		groupName := group["name"].(string)
-		path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, groupName, availabilitySetPath, microsoftComputeApiVersion)
-		resp, err := GetResources(c, path)
-		if err != nil {
-			return err
-		}
-
-		//add href for each resource
-		for _, resource := range resp {
-			resource["href"] = as.GetHref(resource["id"].(string))
-		}
-
-		sets = append(sets, resp...)
+		listings = append(listings, childListing{
+			Parent: fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", creds.Subscription, groupName),
+			Path:   fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, groupName, availabilitySetPath, config.APIVersion("Microsoft.Compute/availabilitySets")),
+			//add href for each resource
+			Prepare: func(resource map[string]interface{}) {
+				resource["href"] = as.GetHref(resource["id"].(string))
+			},
+		})
 	}
-
-	return Render(c, 200, sets, as.GetContentType()+";type=collection")
+	return renderChildren(c, listings, as.GetContentType())
 }
 
 func listOneAvailabilitySet(c *echo.Context) error {
@@ -106,6 +114,16 @@ func createAvailabilitySet(c *echo.Context) error {
 	return Create(c, availabilitySet)
 }
 
+func updateAvailabilitySet(c *echo.Context) error {
+	availabilitySet := AvailabilitySet{
+		createParams: availabilitySetCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &availabilitySet)
+}
+
 func deleteAvailabilitySet(c *echo.Context) error {
 	availabilitySet := AvailabilitySet{
 		createParams: availabilitySetCreateParams{
@@ -123,12 +141,30 @@ func (as *AvailabilitySet) GetRequestParams(c *echo.Context) (interface{}, error
 		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
 	}
 	as.createParams.Group = c.Param("group_name")
+
+	if err := validateParams(&as.createParams); err != nil {
+		return nil, err
+	}
+
 	as.requestParams.Name = as.createParams.Name
 	as.requestParams.Location = as.createParams.Location
+	as.requestParams.Tags = as.createParams.Tags
 
 	return as.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the availability set gotten from the cloud
+func (as *AvailabilitySet) GetUpdateParams(c *echo.Context, availabilitySet map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&as.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if as.createParams.Tags != nil {
+		availabilitySet["tags"] = as.createParams.Tags
+	}
+	return availabilitySet, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (as *AvailabilitySet) GetResponseParams() interface{} {
 	return as.responseParams
@@ -136,15 +172,15 @@ func (as *AvailabilitySet) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle availability set
 func (as *AvailabilitySet) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, as.createParams.Group, availabilitySetPath, as.createParams.Name, microsoftComputeApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, as.createParams.Group, availabilitySetPath, as.createParams.Name, config.APIVersion("Microsoft.Compute/availabilitySets"))
 }
 
 // GetCollectionPath returns full path to the collection of availability sets
 func (as *AvailabilitySet) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, availabilitySetPath, microsoftComputeApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, availabilitySetPath, config.APIVersion("Microsoft.Compute/availabilitySets"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, availabilitySetPath, microsoftComputeApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, availabilitySetPath, config.APIVersion("Microsoft.Compute/availabilitySets"))
 }
 
 // HandleResponse manage raw cloud response
@@ -155,7 +191,7 @@ func (as *AvailabilitySet) HandleResponse(c *echo.Context, body []byte, actionNa
 	href := as.GetHref(as.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		as.responseParams.Href = href
 	}
 	return nil
@@ -168,6 +204,5 @@ func (as *AvailabilitySet) GetContentType() string {
 
 // GetHref returns availability set href
 func (as *AvailabilitySet) GetHref(availabilitySetID string) string {
-	array := strings.Split(availabilitySetID, "/")
-	return fmt.Sprintf("resource_groups/%s/availability_sets/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(availabilitySetID, "availability_sets")
 }
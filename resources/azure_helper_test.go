@@ -44,6 +44,10 @@ var _ = BeforeSuite(func() {
 type AzureClient struct {
 	client *http.Client
 	port   string
+	// Headers are added to every request
+	Headers http.Header
+	// Cookies are added to every request
+	Cookies []*http.Cookie
 }
 
 // Read HTTP response
@@ -72,6 +76,16 @@ func (c *AzureClient) Post(url, body string) (*Response, error) {
 	return c.do("POST", url, body)
 }
 
+// Send PUT request to cloud
+func (c *AzureClient) Put(url, body string) (*Response, error) {
+	return c.do("PUT", url, body)
+}
+
+// Send PATCH request to cloud
+func (c *AzureClient) Patch(url, body string) (*Response, error) {
+	return c.do("PATCH", url, body)
+}
+
 // Send DELETE request to cloud
 func (c *AzureClient) Delete(url string) (*Response, error) {
 	return c.do("DELETE", url, "")
@@ -97,7 +111,15 @@ func (c *AzureClient) do(verb, url, body string) (*Response, error) {
 		req.AddCookie(&http.Cookie{Name: "RefreshToken", Value: CredsTest.RefreshToken})
 		req.AddCookie(&http.Cookie{Name: "SubscriptionID", Value: CredsTest.Subscription})
 	}
+	for _, cookie := range c.Cookies {
+		req.AddCookie(cookie)
+	}
 	req.Header.Add("Content-Type", "application/json")
+	for name, values := range c.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -116,7 +138,6 @@ func (c *AzureClient) do(verb, url, body string) (*Response, error) {
 
 // Factory method for application
 // Makes it possible to do integration testing.
-// TODO: code duplication...the same method is placed in the main package
 func httpServer() *echo.Echo {
 	// Setup middleware
 	e := echo.New()
@@ -124,24 +145,12 @@ func httpServer() *echo.Echo {
 	// e.Use(gm.HttpLogger(config.Logger)) // Log to syslog
 	e.Use(am.AzureClientInitializer())
 	e.Use(em.Recover())
+	e.Use(am.IdempotencyKeeper())
 
 	e.SetHTTPErrorHandler(eh.AzureErrorHandler(e)) // override default error handler
 	// Setup routes
 	prefix := e.Group(*config.AppPrefix)
-	SetupSubscriptionRoutes(prefix)
-	SetupInstanceRoutes(prefix)
-	SetupGroupsRoutes(prefix)
-	SetupStorageAccountsRoutes(prefix)
-	SetupProviderRoutes(prefix)
-	SetupNetworkRoutes(prefix)
-	SetupSubnetsRoutes(prefix)
-	SetupIPAddressesRoutes(prefix)
-	SetupAuthRoutes(prefix)
-	SetupNetworkInterfacesRoutes(prefix)
-	SetupOperationRoutes(prefix)
-	SetupAvailabilitySetRoutes(prefix)
-	SetupNetworkSecurityGroupRoutes(prefix)
-	SetupNetworkSecurityGroupRuleRoutes(prefix)
+	SetupResourceRoutes(prefix)
 
 	return e
 }
@@ -36,8 +36,22 @@ type AzureResource interface {
 	GetHref(string) string
 }
 
+// UpdatableResource is interface of resources which could be updated via generic function Update
+type UpdatableResource interface {
+	AzureResource
+	// GetUpdateParams should return params for updating the resource in the cloud.
+	// Decodes body params (the same as for create) and maps them onto the existing cloud object (second param).
+	// The cloud object is empty for PATCH requests so only changed params are sent.
+	GetUpdateParams(*echo.Context, map[string]interface{}) (interface{}, error)
+}
+
+// pluginFields are added by the plugin to resources gotten from the cloud, they are removed before the resource is sent back
+var pluginFields = []string{"href"}
+
 // Create new resource
-func Create(c *echo.Context, r AzureResource) error {
+func Create(c *echo.Context, r AzureResource) (err error) {
+	event := startAudit(c, "create")
+	defer func() { event.finish(c, err) }()
 	client, err := GetAzureClient(c)
 	if err != nil {
 		return err
@@ -57,7 +71,11 @@ func Create(c *echo.Context, r AzureResource) error {
 	if err != nil {
 		return err
 	}
-	path := r.GetPath(creds.Subscription)
+	path := primaryPath(c, r.GetPath(creds.Subscription))
+	if isDryRun(c) {
+		return renderDryRun(c, "PUT", path, requestParams)
+	}
+	event.request("PUT", path, requestParams)
 	request, err := http.NewRequest("PUT", path, reader)
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("Error has occurred while creating resource: %v", err))
@@ -70,20 +88,18 @@ func Create(c *echo.Context, r AzureResource) error {
 		return eh.GenericException(fmt.Sprintf("Error has occurred while creating resource: %v", err))
 	}
 	defer response.Body.Close()
+	event.response(response)
 	b, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
 	if response.StatusCode >= 400 {
-		return eh.GenericException(fmt.Sprintf("Error has occurred while creating resource: %s", string(b)))
+		return eh.AzureException("Error has occurred while creating resource", response, b)
 	}
 
 	//https://msdn.microsoft.com/en-us/library/azure/mt163601.aspx
-	if response.Header.Get("Location") != "" {
-		array := strings.Split(response.Header.Get("Location"), "/")
-		operationId := strings.Split(array[len(array)-1], "?")[0]
-		c.Response().Header().Add("OperationId", operationId)
-		return c.NoContent(202)
+	if operationURL := getOperationURL(response.Header); operationURL != "" {
+		return renderAccepted(c, operationURL)
 	}
 
 	if err := r.HandleResponse(c, b, "create"); err != nil {
@@ -94,7 +110,9 @@ func Create(c *echo.Context, r AzureResource) error {
 }
 
 // Delete resource
-func Delete(c *echo.Context, r AzureResource) error {
+func Delete(c *echo.Context, r AzureResource) (err error) {
+	event := startAudit(c, "delete")
+	defer func() { event.finish(c, err) }()
 	client, err := GetAzureClient(c)
 	if err != nil {
 		return err
@@ -103,8 +121,12 @@ func Delete(c *echo.Context, r AzureResource) error {
 	if err != nil {
 		return err
 	}
-	path := r.GetPath(creds.Subscription)
+	path := primaryPath(c, r.GetPath(creds.Subscription))
+	if isDryRun(c) {
+		return renderDryRun(c, "DELETE", path, nil)
+	}
 	config.Logger.Info("Delete request:", "path", path)
+	event.request("DELETE", path, nil)
 
 	req, err := http.NewRequest("DELETE", path, nil)
 	if err != nil {
@@ -115,34 +137,139 @@ func Delete(c *echo.Context, r AzureResource) error {
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("Error has occurred while deleting resource: %v", err))
 	}
+	event.response(resp)
 
 	if resp.StatusCode >= 400 {
 		b, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 		}
-		return eh.GenericException(fmt.Sprintf("Error has occurred while deleting resource: %v", string(b)))
+		return eh.AzureException("Error has occurred while deleting resource", resp, b)
 	}
 
 	//https://msdn.microsoft.com/en-us/library/azure/mt163601.aspx
-	if resp.Header.Get("Location") != "" {
-		config.Logger.Info("Header:", "Location", resp.Header.Get("Location"))
-		array := strings.Split(resp.Header.Get("Location"), "/")
-		operationId := strings.Split(array[len(array)-1], "?")[0]
-		c.Response().Header().Add("OperationId", operationId)
-		return c.NoContent(202)
+	if operationURL := getOperationURL(resp.Header); operationURL != "" {
+		config.Logger.Info("Header:", "Operation", operationURL)
+		return renderAccepted(c, operationURL)
 	}
 
 	return c.NoContent(204)
 }
 
+// Update resource
+// PUT request gets the resource from the cloud, modifies it with passed params and sends it back,
+// PATCH request sends passed params only.
+func Update(c *echo.Context, r UpdatableResource) (err error) {
+	event := startAudit(c, "update")
+	defer func() { event.finish(c, err) }()
+	client, err := GetAzureClient(c)
+	if err != nil {
+		return err
+	}
+	creds, err := GetClientCredentials(c)
+	if err != nil {
+		return err
+	}
+	path := primaryPath(c, r.GetPath(creds.Subscription))
+	method := c.Request().Method
+	object := make(map[string]interface{})
+	// the resource is not read in dry run, so passed params are applied to empty one
+	if method == "PUT" && !isDryRun(c) {
+		body, err := GetResource(c, path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, &object); err != nil {
+			return eh.GenericException(fmt.Sprintf("got bad response from server: %s", string(body)))
+		}
+		for _, field := range pluginFields {
+			delete(object, field)
+		}
+	}
+	requestParams, err := r.GetUpdateParams(c, object)
+	if err != nil {
+		return err
+	}
+	if isDryRun(c) {
+		var warnings []string
+		if method == "PUT" {
+			warnings = append(warnings, "the resource is not read from Azure in dry run, so the body contains passed params only")
+		}
+		return renderDryRun(c, method, path, requestParams, warnings...)
+	}
+
+	by, err := json.Marshal(requestParams)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while marshaling data: %v", err))
+	}
+	config.Logger.Info("Update request:", "method", method, "path", path)
+	event.request(method, path, requestParams)
+	request, err := http.NewRequest(method, path, bytes.NewReader(by))
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while updating resource: %v", err))
+	}
+	request.Header.Add("Content-Type", config.MediaType)
+	request.Header.Add("Accept", config.MediaType)
+	request.Header.Add("User-Agent", config.UserAgent)
+	// make sure the resource has not been changed since it was read
+	if etag, ok := object["etag"].(string); ok && etag != "" {
+		request.Header.Add("If-Match", etag)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while updating resource: %v", err))
+	}
+	defer response.Body.Close()
+	event.response(response)
+	b, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
+	}
+	if response.StatusCode >= 400 {
+		return eh.AzureException("Error has occurred while updating resource", response, b)
+	}
+
+	if operationURL := getOperationURL(response.Header); operationURL != "" {
+		return renderAccepted(c, operationURL)
+	}
+
+	if err := r.HandleResponse(c, b, "update"); err != nil {
+		return err
+	}
+	return Render(c, 200, r.GetResponseParams(), r.GetContentType())
+}
+
+// getOperationURL returns URL of async operation, 'Azure-AsyncOperation' header is preferred over 'Location'
+// since it points to the operation status rather than to the operation result
+func getOperationURL(header http.Header) string {
+	if operationURL := header.Get("Azure-AsyncOperation"); operationURL != "" {
+		return operationURL
+	}
+	return header.Get("Location")
+}
+
+// renderAccepted responds with 202 status code and passes async operation details in the headers:
+// 'OperationToken' could be polled via 'operations/:token' route,
+// 'OperationId' is kept for 'locations/:location/services/:service/operations/:id' route
+func renderAccepted(c *echo.Context, operationURL string) error {
+	c.Response().Header().Add("OperationId", getOperationID(operationURL))
+	c.Response().Header().Add("OperationToken", newOperationToken(operationURL))
+	return c.NoContent(202)
+}
+
+// getOperationID returns id of async operation from its URL
+func getOperationID(location string) string {
+	array := strings.Split(location, "/")
+	return strings.Split(array[len(array)-1], "?")[0]
+}
+
 // Get resource
 func Get(c *echo.Context, r AzureResource) error {
 	creds, err := GetClientCredentials(c)
 	if err != nil {
 		return err
 	}
-	path := r.GetPath(creds.Subscription)
+	path := primaryPath(c, r.GetPath(creds.Subscription))
 	body, err := GetResource(c, path)
 	if err != nil {
 		return err
@@ -161,7 +288,7 @@ func List(c *echo.Context, r AzureResource) error {
 	if err != nil {
 		return err
 	}
-	resourcePath := r.GetCollectionPath(groupName, creds.Subscription)
+	resourcePath := primaryPath(c, r.GetCollectionPath(groupName, creds.Subscription))
 	resources, err := GetResources(c, resourcePath)
 	if err != nil {
 		return err
@@ -170,45 +297,72 @@ func List(c *echo.Context, r AzureResource) error {
 	for _, resource := range resources {
 		resource["href"] = r.GetHref(resource["id"].(string))
 	}
-	return Render(c, 200, resources, r.GetContentType()+";type=collection")
+	return RenderCollection(c, resources, r.GetContentType())
 }
 
 // GetResources makes a call to cloud to get all resources
+// It follows 'nextLink' until the last page is received.
 func GetResources(c *echo.Context, path string) ([]map[string]interface{}, error) {
 	client, err := GetAzureClient(c)
 	if err != nil {
 		return nil, err
 	}
+	return fetchResources(client, path)
+}
+
+// maxResourcePages is a maximum number of pages followed via 'nextLink' while getting resources
+const maxResourcePages = 1000
+
+// fetchResources gets all resources using the given client, it could be used outside of the plugin request
+func fetchResources(client *http.Client, path string) ([]map[string]interface{}, error) {
+	resources := make([]map[string]interface{}, 0)
+	// links already requested, so a repeated or cyclic 'nextLink' doesn't loop forever
+	seen := make(map[string]bool)
+	for path != "" {
+		if seen[path] || len(seen) >= maxResourcePages {
+			return nil, eh.GenericException(fmt.Sprintf("got bad response from server: 'nextLink' repeats or exceeds %d pages: %s", maxResourcePages, path))
+		}
+		seen[path] = true
+		page, nextLink, err := getResourcesPage(client, path)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, page...)
+		path = nextLink
+	}
+	return resources, nil
+}
+
+// getResourcesPage makes a call to cloud to get one page of resources and a link to the next one
+func getResourcesPage(client *http.Client, path string) ([]map[string]interface{}, string, error) {
 	config.Logger.Debug("Get Resources request:", "path", path)
 	resp, err := client.Get(path)
-	defer resp.Body.Close()
 	if err != nil {
-		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while requesting resources: %v", err))
+		return nil, "", eh.GenericException(fmt.Sprintf("Error has occurred while requesting resources: %v", err))
 	}
+	defer resp.Body.Close()
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
+		return nil, "", eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
 	if resp.StatusCode >= 400 {
-		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while requesting resources: %s", string(b)))
+		return nil, "", eh.AzureException("Error has occurred while requesting resources", resp, b)
 	}
 
-	var m map[string][]map[string]interface{}
-	if err := json.Unmarshal(b, &m); err != nil {
-		if m["value"] != nil {
-			// return resources if unmarshaling is success for 'value' key
-			// error occurs if value of the hash is not a []map[string]interface{}
-			return m["value"], nil
-		}
+	var page struct {
+		Value    []map[string]interface{} `json:"value"`
+		NextLink string                   `json:"nextLink"`
+	}
+	if err := json.Unmarshal(b, &page); err != nil {
 		var array []map[string]interface{}
 		if err := json.Unmarshal(b, &array); err == nil {
 			// return resources if unmarshaling is success for array struct
 			// error occurs if body contains array of resources "[]map[string]interface{}"
-			return array, nil
+			return array, "", nil
 		}
-		return nil, eh.GenericException(fmt.Sprintf("got bad response from server: %s", string(b)))
+		return nil, "", eh.GenericException(fmt.Sprintf("got bad response from server: %s", string(b)))
 	}
-	return m["value"], nil
+	return page.Value, page.NextLink, nil
 }
 
 // GetResource sends requests to the clouds to get resource
@@ -219,10 +373,10 @@ func GetResource(c *echo.Context, path string) ([]byte, error) {
 	}
 	config.Logger.Info("Get Resource request:", "path", path)
 	resp, err := client.Get(path)
-	defer resp.Body.Close()
 	if err != nil {
 		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while requesting resource: %v", err))
 	}
+	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
@@ -231,7 +385,7 @@ func GetResource(c *echo.Context, path string) ([]byte, error) {
 		return nil, eh.RecordNotFound(c.Param("id"))
 	}
 	if resp.StatusCode >= 400 {
-		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while requesting resource: %s", string(body)))
+		return nil, eh.AzureException("Error has occurred while requesting resource", resp, body)
 	}
 
 	return body, nil
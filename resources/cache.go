@@ -0,0 +1,327 @@
+package resources
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+const (
+	// CacheHeader reports whether response is served from cache: 'hit' or 'miss'
+	CacheHeader = "X-Cache"
+	// AdminKeyHeader passes key which allows to invalidate cached responses of all subscriptions
+	AdminKeyHeader = "X-Admin-Key"
+)
+
+// cacheBackend keeps cached responses of Azure
+type cacheBackend interface {
+	// Get returns cached value, false is returned if value is missing or expired
+	Get(key string) ([]byte, bool, error)
+	// Set stores value for the given period
+	Set(key string, value []byte, ttl time.Duration) error
+	// DeletePrefix removes values with keys starting with the prefix and returns their number
+	DeletePrefix(prefix string) (int, error)
+}
+
+var (
+	responseCache     cacheBackend
+	responseCacheOnce sync.Once
+)
+
+// getResponseCache returns cache selected by 'cache_backend' flag, nil is returned if caching is disabled
+func getResponseCache() cacheBackend {
+	responseCacheOnce.Do(func() {
+		switch *config.CacheBackend {
+		case "memory":
+			responseCache = newLRUCache(*config.CacheSize)
+		case "redis":
+			responseCache = newRedisCache(*config.CacheRedisAddr)
+		}
+	})
+	return responseCache
+}
+
+func init() {
+	registerResourceType(&ResourceType{
+		Name:        "cache",
+		ContentType: "application/json",
+		Actions:     []string{ActionDelete},
+		Setup:       SetupCacheRoutes,
+	})
+}
+
+// SetupCacheRoutes declares routes for invalidation of cached responses
+func SetupCacheRoutes(e *echo.Group) {
+	e.Delete("/cache", invalidateCache)
+}
+
+// invalidateCache removes cached responses of the current subscription,
+// 'endpoint' param limits invalidation to one endpoint, ex: 'providers',
+// responses of all subscriptions are removed if 'all=true' is passed along with the key set by 'cache_admin_key' flag
+func invalidateCache(c *echo.Context) error {
+	endpoint := c.Query("endpoint")
+	if endpoint != "" && !contains(config.CacheEndpoints(), endpoint) {
+		return eh.InvalidParamException("endpoint")
+	}
+	var prefixes []string
+	if c.Query("all") == "true" {
+		key := c.Request().Header.Get(AdminKeyHeader)
+		if *config.CacheAdminKey == "" || key != *config.CacheAdminKey {
+			return eh.UnauthorizedException(fmt.Sprintf("valid '%s' header is required to invalidate cache of all subscriptions", AdminKeyHeader))
+		}
+		if endpoint != "" {
+			return eh.GenericException("'endpoint' param could not be used along with 'all' one")
+		}
+		prefixes = []string{""}
+	} else {
+		// the caller could invalidate only responses cached for its own access token
+		creds, err := GetClientCredentials(c)
+		if err != nil {
+			return err
+		}
+		endpoints := config.CacheEndpoints()
+		if endpoint != "" {
+			endpoints = []string{endpoint}
+		}
+		for _, e := range endpoints {
+			prefixes = append(prefixes, creds.Subscription+":"+e+":"+callerFingerprint(c)+":")
+		}
+	}
+	deleted := 0
+	if cache := getResponseCache(); cache != nil {
+		for _, prefix := range prefixes {
+			n, err := cache.DeletePrefix(prefix)
+			if err != nil {
+				return eh.GenericException(fmt.Sprintf("Error has occurred while invalidating cache: %v", err))
+			}
+			deleted += n
+		}
+	}
+	config.Logger.Info("Cache invalidated:", "prefixes", strings.Join(prefixes, ","), "deleted", deleted)
+	return c.JSON(200, map[string]int{"deleted": deleted})
+}
+
+// cacheKey identifies response of the endpoint: "<subscription>:<endpoint>:<caller>:<cloud>:<path>",
+// responses are cached per access token since Azure authorizes the caller only when the response is gotten,
+// the cloud is identified by its endpoint since clouds could be customized
+func cacheKey(c *echo.Context, endpoint string, path string) (string, error) {
+	creds, err := GetClientCredentials(c)
+	if err != nil {
+		return "", err
+	}
+	env, err := GetEnvironment(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(env.ResourceManagerURL))
+	return fmt.Sprintf("%s:%s:%s:%s_%s:%s", creds.Subscription, endpoint, callerFingerprint(c), strings.ToLower(env.Name), hex.EncodeToString(sum[:4]), strings.TrimPrefix(path, config.BaseURL)), nil
+}
+
+// callerFingerprint identifies access token of the caller without exposing it in cache keys
+func callerFingerprint(c *echo.Context) string {
+	accessToken, _ := c.Get("accessToken").(string)
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+// getCached returns cached response of the endpoint or gets it via 'fetch' and caches it.
+// Cache failures are logged only and the response is gotten from Azure.
+func getCached(c *echo.Context, endpoint string, path string, fetch func() ([]byte, error)) ([]byte, error) {
+	cache := getResponseCache()
+	ttl := config.CacheTTL(endpoint)
+	// responses of overridden API version differ from ones of the configured version
+	if cache == nil || ttl == 0 || am.APIVersionOverride(c) != "" {
+		return fetch()
+	}
+	key, err := cacheKey(c, endpoint, path)
+	if err != nil {
+		return nil, err
+	}
+	value, ok, err := cache.Get(key)
+	if err != nil {
+		config.Logger.Error("Unable to get cached response:", "key", key, "error", err)
+	}
+	if ok {
+		setCacheHeader(c, "hit")
+		return value, nil
+	}
+	setCacheHeader(c, "miss")
+	value, err = fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.Set(key, value, ttl); err != nil {
+		config.Logger.Error("Unable to cache response:", "key", key, "error", err)
+	}
+	return value, nil
+}
+
+// setCacheHeader reports 'hit' only if all responses used by the plugin request are cached
+func setCacheHeader(c *echo.Context, value string) {
+	header := c.Response().Header()
+	if header.Get(CacheHeader) != "miss" {
+		header.Set(CacheHeader, value)
+	}
+}
+
+// GetCachedResources gets all resources like GetResources does but keeps them in cache for the period configured for the endpoint
+func GetCachedResources(c *echo.Context, endpoint string, path string) ([]map[string]interface{}, error) {
+	b, err := getCached(c, endpoint, path, func() ([]byte, error) {
+		resources, err := GetResources(c, path)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resources)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resources []map[string]interface{}
+	if err := json.Unmarshal(b, &resources); err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("got bad cached response: %v", err))
+	}
+	return resources, nil
+}
+
+// GetCachedResource gets resource like GetResource does but keeps it in cache for the period configured for the endpoint
+func GetCachedResource(c *echo.Context, endpoint string, path string) ([]byte, error) {
+	return getCached(c, endpoint, path, func() ([]byte, error) {
+		return GetResource(c, path)
+	})
+}
+
+// GetCached gets resource like Get does but keeps it in cache for the period configured for the endpoint
+func GetCached(c *echo.Context, endpoint string, r AzureResource) error {
+	creds, err := GetClientCredentials(c)
+	if err != nil {
+		return err
+	}
+	body, err := GetCachedResource(c, endpoint, primaryPath(c, r.GetPath(creds.Subscription)))
+	if err != nil {
+		return err
+	}
+	if err := r.HandleResponse(c, body, "get"); err != nil {
+		return err
+	}
+	return Render(c, 200, r.GetResponseParams(), r.GetContentType())
+}
+
+// ListCached gets resources like List does but keeps them in cache for the period configured for the endpoint
+func ListCached(c *echo.Context, endpoint string, r AzureResource) error {
+	creds, err := GetClientCredentials(c)
+	if err != nil {
+		return err
+	}
+	resources, err := GetCachedResources(c, endpoint, primaryPath(c, r.GetCollectionPath(c.Param("group_name"), creds.Subscription)))
+	if err != nil {
+		return err
+	}
+	//add href for each resource
+	for _, resource := range resources {
+		resource["href"] = r.GetHref(resource["id"].(string))
+	}
+	return RenderCollection(c, resources, r.GetContentType())
+}
+
+// invalidateCachedEndpoint removes cached responses of the endpoint for the current subscription, ex: after changes made by the plugin,
+// responses of all callers are removed since the change is authorized by Azure
+func invalidateCachedEndpoint(c *echo.Context, endpoint string) {
+	cache := getResponseCache()
+	creds, err := GetClientCredentials(c)
+	if cache == nil || err != nil {
+		return
+	}
+	if _, err := cache.DeletePrefix(creds.Subscription + ":" + endpoint + ":"); err != nil {
+		config.Logger.Error("Unable to invalidate cache:", "endpoint", endpoint, "error", err)
+	}
+}
+
+// lruCache keeps at most 'size' values in memory, least recently used ones are evicted
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get returns value if it is not expired and marks it as recently used
+func (l *lruCache) Get(key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		l.remove(element)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set stores value and evicts least recently used ones if the cache is full
+func (l *lruCache) Set(key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry := &lruEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if element, ok := l.entries[key]; ok {
+		element.Value = entry
+		l.order.MoveToFront(element)
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+	return nil
+}
+
+// DeletePrefix removes values with keys starting with the prefix
+func (l *lruCache) DeletePrefix(prefix string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	deleted := 0
+	for key, element := range l.entries {
+		if strings.HasPrefix(key, prefix) {
+			l.remove(element)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (l *lruCache) remove(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.entries, element.Value.(*lruEntry).key)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
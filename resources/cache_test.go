@@ -0,0 +1,262 @@
+package resources
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+const listLocationsResponse = `{"value":[{"id":"/subscriptions/test/locations/westus","name":"westus","displayName":"West US"}]}`
+
+// redisStandIn is a Redis compatible server which supports commands used by the cache: GET, SET with PX, SCAN and DEL
+type redisStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	values   map[string]string
+	expires  map[string]time.Time
+}
+
+func newRedisStandIn() *redisStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	s := &redisStandIn{listener: listener, values: make(map[string]string), expires: make(map[string]time.Time)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *redisStandIn) Addr() string { return s.listener.Addr().String() }
+
+func (s *redisStandIn) Close() { s.listener.Close() }
+
+func (s *redisStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	for {
+		reply, err := readRedisReply(rd)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+		conn.Write([]byte(s.exec(args)))
+	}
+}
+
+func (s *redisStandIn) exec(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, expiresAt := range s.expires {
+		if !time.Now().Before(expiresAt) {
+			delete(s.values, key)
+			delete(s.expires, key)
+		}
+	}
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		s.values[args[1]] = args[2]
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "SCAN":
+		prefix := strings.Replace(strings.TrimSuffix(args[3], "*"), `\`, "", -1)
+		var keys []string
+		for key := range s.values {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, fmt.Sprintf("$%d\r\n%s\r\n", len(key), key))
+			}
+		}
+		return fmt.Sprintf("*2\r\n$1\r\n0\r\n*%d\r\n%s", len(keys), strings.Join(keys, ""))
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				delete(s.values, key)
+				delete(s.expires, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+var _ = Describe("cache", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+		getResponseCache()
+		responseCache = newLRUCache(*config.CacheSize)
+		do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/locations", ghttp.RespondWith(http.StatusOK, listLocationsResponse))
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	listLocations := func(cache string) {
+		response, err = client.Get("/locations")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(200))
+		Ω(response.Body).Should(ContainSubstring("westus"))
+		Ω(response.Headers.Get(CacheHeader)).Should(Equal(cache))
+	}
+
+	examples := func() {
+		It("serves responses from cache", func() {
+			listLocations("miss")
+			listLocations("hit")
+			Ω(do.ReceivedRequests()).Should(HaveLen(1))
+		})
+
+		It("invalidates cached responses of the subscription", func() {
+			listLocations("miss")
+			response, err = client.Delete("/cache?endpoint=locations")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`{"deleted": 1}`))
+			listLocations("miss")
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+		})
+	}
+
+	Describe("in memory", func() {
+		examples()
+
+		Describe("with another access token", func() {
+			AfterEach(func() {
+				AccessTokenTest = "fake"
+			})
+
+			It("does not serve responses cached for other callers", func() {
+				listLocations("miss")
+				AccessTokenTest = "other"
+				client = NewAzureClient()
+				listLocations("miss")
+				Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			})
+
+			It("does not invalidate responses cached for other callers", func() {
+				listLocations("miss")
+				AccessTokenTest = "other"
+				client = NewAzureClient()
+				response, err = client.Delete("/cache")
+				Expect(err).NotTo(HaveOccurred())
+				Ω(response.Status).Should(Equal(200))
+				Ω(response.Body).Should(MatchJSON(`{"deleted": 0}`))
+				AccessTokenTest = "fake"
+				client = NewAzureClient()
+				listLocations("hit")
+			})
+		})
+
+		It("bypasses cache if API version is overridden", func() {
+			listLocations("miss")
+			for i := 0; i < 2; i++ {
+				response, err = client.Get("/locations?api_version=2015-01-01")
+				Expect(err).NotTo(HaveOccurred())
+				Ω(response.Status).Should(Equal(200))
+				Ω(response.Headers.Get(CacheHeader)).Should(BeEmpty())
+			}
+			Ω(do.ReceivedRequests()).Should(HaveLen(3))
+			listLocations("hit")
+		})
+
+		It("fails to invalidate cache of unknown endpoint", func() {
+			response, err = client.Delete("/cache?endpoint=instances")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(400))
+		})
+
+		It("requires admin key to invalidate cache of all subscriptions", func() {
+			response, err = client.Delete("/cache?all=true")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(401))
+		})
+
+		It("evicts least recently used values", func() {
+			cache := newLRUCache(2)
+			cache.Set("a", []byte("1"), time.Hour)
+			cache.Set("b", []byte("2"), time.Hour)
+			cache.Get("a")
+			cache.Set("c", []byte("3"), time.Hour)
+			_, ok, _ := cache.Get("b")
+			Ω(ok).Should(BeFalse())
+			value, ok, _ := cache.Get("a")
+			Ω(ok).Should(BeTrue())
+			Ω(string(value)).Should(Equal("1"))
+			cache.Set("d", []byte("4"), -time.Second)
+			_, ok, _ = cache.Get("d")
+			Ω(ok).Should(BeFalse())
+		})
+	})
+
+	Describe("in Redis", func() {
+		var redis *redisStandIn
+
+		BeforeEach(func() {
+			redis = newRedisStandIn()
+			responseCache = newRedisCache(redis.Addr())
+		})
+
+		AfterEach(func() {
+			responseCache = newLRUCache(*config.CacheSize)
+			redis.Close()
+		})
+
+		examples()
+
+		It("keeps values under the plugin prefix", func() {
+			listLocations("miss")
+			redis.mu.Lock()
+			defer redis.mu.Unlock()
+			Ω(redis.values).Should(HaveLen(1))
+			for key := range redis.values {
+				Ω(key).Should(HavePrefix(redisKeyPrefix + subscriptionID + ":locations:"))
+			}
+		})
+
+		It("falls back to Azure if Redis is unavailable", func() {
+			redis.Close()
+			responseCache = newRedisCache(redis.Addr())
+			listLocations("miss")
+			listLocations("miss")
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+		})
+	})
+})
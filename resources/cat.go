@@ -0,0 +1,266 @@
+package resources
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+// catNamespace is a name of the namespace generated CAT declares, resource types are referred as 'azure.<type>'
+const catNamespace = "azure"
+
+// catPollInterval is a period between requests for status of async operation made by RCL definitions
+const catPollInterval = 10 * time.Second
+
+// catCredentials map credentials passed to the plugin in headers to RightScale credentials their values are taken from
+var catCredentials = []struct {
+	name       string
+	credential string
+}{
+	{"TenantID", "AZURE_TENANT_ID"},
+	{"ClientID", "AZURE_CLIENT_ID"},
+	{"ClientSecret", "AZURE_CLIENT_SECRET"},
+	{"SubscriptionID", "AZURE_SUBSCRIPTION_ID"},
+}
+
+// catType is a resource type which could be provisioned via CAT namespace
+type catType struct {
+	resourceType *ResourceType
+	// collection is a path of the collection with path params substituted, ex: resource_groups/Group-1/networks
+	collection string
+	// plural is a name of the collection used in RCL, ex: networks
+	plural string
+	// pathParams are names of params passed in the path rather than in fields, ex: group_name
+	pathParams []string
+}
+
+// GenerateCAT writes RightScale CAT with namespace of resource types which could be created via the plugin
+// and RCL definitions provisioning and deleting them. Namespace types and their fields are derived from
+// routes and create params of registered resource types, so CAT is regenerated rather than written by hand.
+func GenerateCAT(w io.Writer) error {
+	pathParams, err := parseCATPathParams(*config.CATPathParams)
+	if err != nil {
+		return err
+	}
+	var types []catType
+	var skipped []string
+	for _, resourceType := range ResourceTypes() {
+		// resource types kept on the plugin side, ex: sessions, are not provisioned by CAT
+		if resourceType.CreateParams == nil || !contains(resourceType.Actions, ActionUpdate) {
+			continue
+		}
+		for _, route := range resourceTypeRoutes(resourceType) {
+			if route.method != "POST" {
+				continue
+			}
+			collection, names, missing := substitutePathParams(route.path, pathParams)
+			if len(missing) > 0 {
+				skipped = append(skipped, fmt.Sprintf("%s: %s", resourceType.Name, strings.Join(missing, ", ")))
+				continue
+			}
+			types = append(types, catType{resourceType: resourceType, collection: collection, plural: lastSegment(route.path), pathParams: names})
+		}
+	}
+
+	var b bytes.Buffer
+	host := *config.CATHost
+	if host == "" {
+		host = "http://" + *config.ListenFlag
+	}
+	fmt.Fprintf(&b, "name \"Azure resources\"\n")
+	fmt.Fprintf(&b, "rs_ca_ver 20131202\n")
+	fmt.Fprintf(&b, "short_description \"Allows you to provision Azure resources via the plugin, generated by '%s' command\"\n\n", config.GenerateCATCommand)
+	fmt.Fprintf(&b, "namespace %q do\n", catNamespace)
+	fmt.Fprintf(&b, "  service do\n")
+	fmt.Fprintf(&b, "    host %q\n", host)
+	fmt.Fprintf(&b, "    path %q\n", *config.AppPrefix)
+	fmt.Fprintf(&b, "    headers do {\n")
+	fmt.Fprintf(&b, "      \"user-agent\" => \"self_service\"\n")
+	fmt.Fprintf(&b, "    } end\n")
+	fmt.Fprintf(&b, "  end\n")
+	for _, t := range types {
+		writeCATType(&b, t)
+	}
+	fmt.Fprintf(&b, "end\n")
+	if len(skipped) > 0 {
+		fmt.Fprintf(&b, "\n# Resource types skipped since values of their path params are not passed via 'cat_path_params' flag:\n")
+		for _, s := range skipped {
+			fmt.Fprintf(&b, "#   %s\n", s)
+		}
+	}
+	for _, t := range types {
+		writeCATDefinitions(&b, t)
+	}
+	writeCATHelpers(&b, host+*config.AppPrefix)
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+func writeCATType(b *bytes.Buffer, t catType) {
+	name := t.resourceType.Name
+	fmt.Fprintf(b, "  type %q do\n", name)
+	fmt.Fprintf(b, "    provision %q\n", "provision_"+name)
+	fmt.Fprintf(b, "    delete %q\n", "delete_"+name)
+	fmt.Fprintf(b, "    path %q\n", "/"+t.collection)
+	fmt.Fprintf(b, "    fields do\n")
+	for _, field := range catFields(reflect.TypeOf(t.resourceType.CreateParams), t.pathParams) {
+		fmt.Fprintf(b, "      field %q do\n", field.name)
+		fmt.Fprintf(b, "        type %q\n", field.kind)
+		if field.required {
+			fmt.Fprintf(b, "        required true\n")
+		}
+		fmt.Fprintf(b, "      end\n")
+	}
+	fmt.Fprintf(b, "    end\n")
+	fmt.Fprintf(b, "  end\n")
+}
+
+// writeCATDefinitions writes RCL definitions which create and delete resource via the plugin,
+// async operations started by Azure are polled via 'operations' route of the plugin
+func writeCATDefinitions(b *bytes.Buffer, t catType) {
+	name := t.resourceType.Name
+	fmt.Fprintf(b, "\ndefine provision_%s(@declaration) return @resource do\n", name)
+	fmt.Fprintf(b, "  $object = to_object(@declaration)\n")
+	fmt.Fprintf(b, "  $fields = $object[\"fields\"]\n")
+	fmt.Fprintf(b, "  call azure_request(\"post\", %q, $fields) retrieve $response\n", t.collection)
+	fmt.Fprintf(b, "  @resource = %s.%s.get(href: %q + $fields[\"name\"])\n", catNamespace, t.plural, t.collection+"/")
+	fmt.Fprintf(b, "end\n")
+	fmt.Fprintf(b, "\ndefine delete_%s(@resource) do\n", name)
+	fmt.Fprintf(b, "  call azure_request(\"delete\", @resource.href, {}) retrieve $response\n")
+	fmt.Fprintf(b, "end\n")
+}
+
+// writeCATHelpers writes RCL definitions sending requests to the plugin, Azure credentials are passed in the headers
+// since requests made via http_* functions don't go through the namespace service
+func writeCATHelpers(b *bytes.Buffer, url string) {
+	attempts := int(*config.CATOperationTimeout / catPollInterval)
+	if attempts < 1 {
+		attempts = 1
+	}
+	fmt.Fprintf(b, "\n# Sends request to the plugin and waits for completion of async operation if the request is accepted\n")
+	fmt.Fprintf(b, "define azure_request($verb, $href, $body) return $response do\n")
+	fmt.Fprintf(b, "  $url = %q + $href\n", url+"/")
+	fmt.Fprintf(b, "  $headers = {\n")
+	fmt.Fprintf(b, "    \"user-agent\": \"self_service\",\n")
+	for i, cred := range catCredentials {
+		separator := ","
+		if i == len(catCredentials)-1 {
+			separator = ""
+		}
+		fmt.Fprintf(b, "    %q: cred(%q)%s\n", am.CredentialHeader(cred.name), cred.credential, separator)
+	}
+	fmt.Fprintf(b, "  }\n")
+	fmt.Fprintf(b, "  if $verb == \"post\"\n")
+	fmt.Fprintf(b, "    $response = http_post(url: $url, body: $body, headers: $headers)\n")
+	fmt.Fprintf(b, "  else\n")
+	fmt.Fprintf(b, "    $response = http_delete(url: $url, headers: $headers)\n")
+	fmt.Fprintf(b, "  end\n")
+	fmt.Fprintf(b, "  call azure_check_response($response)\n")
+	fmt.Fprintf(b, "  if $response[\"code\"] == 202\n")
+	fmt.Fprintf(b, "    $status = \"in-progress\"\n")
+	fmt.Fprintf(b, "    $attempts = 0\n")
+	fmt.Fprintf(b, "    while $status == \"in-progress\" do\n")
+	fmt.Fprintf(b, "      if $attempts >= %d\n", attempts)
+	fmt.Fprintf(b, "        raise \"Azure operation is not completed in %s\"\n", *config.CATOperationTimeout)
+	fmt.Fprintf(b, "      end\n")
+	fmt.Fprintf(b, "      $attempts = $attempts + 1\n")
+	fmt.Fprintf(b, "      sleep(%d)\n", int(catPollInterval/time.Second))
+	fmt.Fprintf(b, "      $operation = http_get(url: %q + $response[\"headers\"][\"OperationToken\"], headers: $headers)\n", url+"/operations/")
+	fmt.Fprintf(b, "      call azure_check_response($operation)\n")
+	fmt.Fprintf(b, "      $status = $operation[\"body\"][\"status\"]\n")
+	fmt.Fprintf(b, "    end\n")
+	fmt.Fprintf(b, "    if $status != \"succeeded\"\n")
+	fmt.Fprintf(b, "      raise \"Azure operation is \" + $status + \": \" + to_s($operation[\"body\"][\"details\"])\n")
+	fmt.Fprintf(b, "    end\n")
+	fmt.Fprintf(b, "  end\n")
+	fmt.Fprintf(b, "end\n")
+	fmt.Fprintf(b, "\ndefine azure_check_response($response) do\n")
+	fmt.Fprintf(b, "  if $response[\"code\"] >= 400\n")
+	fmt.Fprintf(b, "    raise \"Azure plugin responded with \" + to_s($response[\"code\"]) + \": \" + to_s($response[\"body\"])\n")
+	fmt.Fprintf(b, "  end\n")
+	fmt.Fprintf(b, "end\n")
+}
+
+// catField is a field of CAT namespace type
+type catField struct {
+	name     string
+	kind     string
+	required bool
+}
+
+// catFields describes create params as fields of CAT namespace type, params passed in the path are skipped
+func catFields(t reflect.Type, pathParams []string) []catField {
+	var fields []catField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, catFields(field.Type, pathParams)...)
+			continue
+		}
+		name := paramName(field)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" || contains(pathParams, name) {
+			continue
+		}
+		required := contains(strings.Split(field.Tag.Get("validate"), ","), "required")
+		fields = append(fields, catField{name: name, kind: catFieldType(field.Type), required: required})
+	}
+	return fields
+}
+
+func catFieldType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return catFieldType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "composite"
+}
+
+// substitutePathParams replaces path params by their values: /resource_groups/:group_name/networks -> resource_groups/Group-1/networks,
+// names of all path params and of ones without values are returned as well
+func substitutePathParams(path string, values map[string]string) (string, []string, []string) {
+	var segments, names, missing []string
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if isParamSegment(segment) {
+			name := segment[1:]
+			value, ok := values[name]
+			if !ok {
+				missing = append(missing, name)
+			}
+			names = append(names, name)
+			segment = value
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/"), names, missing
+}
+
+// parseCATPathParams parses values of path params: "group_name=Group-1,network_id=net1"
+func parseCATPathParams(value string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("expected 'param=value', got '%s'", pair)
+		}
+		params[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return params, nil
+}
@@ -0,0 +1,135 @@
+package resources
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("CAT generation", func() {
+
+	var cat string
+	var pathParams string
+
+	BeforeEach(func() {
+		pathParams = *config.CATPathParams
+	})
+
+	AfterEach(func() {
+		*config.CATPathParams = pathParams
+	})
+
+	generate := func() {
+		var b bytes.Buffer
+		Expect(GenerateCAT(&b)).To(Succeed())
+		cat = b.String()
+	}
+
+	It("declares namespace types with fields of create params", func() {
+		generate()
+		Ω(cat).Should(ContainSubstring(`namespace "azure" do`))
+		Ω(cat).Should(ContainSubstring(`  type "network" do
+    provision "provision_network"
+    delete "delete_network"
+    path "/resource_groups/Group-1/networks"
+    fields do
+      field "name" do
+        type "string"
+        required true
+      end
+      field "location" do
+        type "string"
+        required true
+      end
+      field "address_prefixes" do
+        type "array"
+        required true
+      end
+      field "subnets" do
+        type "array"
+      end
+      field "dhcp_options" do
+        type "composite"
+      end
+    end
+  end`))
+		Ω(cat).Should(ContainSubstring(`path "/resource_groups"`))
+		Ω(cat).ShouldNot(ContainSubstring(`type "session"`))
+	})
+
+	It("defines RCL provisioning resources and polling async operations", func() {
+		generate()
+		Ω(cat).Should(ContainSubstring(`define provision_network(@declaration) return @resource do
+  $object = to_object(@declaration)
+  $fields = $object["fields"]
+  call azure_request("post", "resource_groups/Group-1/networks", $fields) retrieve $response
+  @resource = azure.networks.get(href: "resource_groups/Group-1/networks/" + $fields["name"])
+end`))
+		Ω(cat).Should(ContainSubstring(`define delete_network(@resource) do`))
+		Ω(cat).Should(ContainSubstring(`/operations/" + $response["headers"]["OperationToken"]`))
+	})
+
+	It("refers to namespace types and definitions declared in CAT", func() {
+		*config.CATPathParams = "group_name=Group-2,network_id=net1,security_group_name=nsg1,route_table_name=rt1"
+		generate()
+		typeRegexp := regexp.MustCompile(`(?m)^  type "(\w+)" do\n    provision "(\w+)"\n    delete "(\w+)"\n    path "/([^"]+)"`)
+		types := typeRegexp.FindAllStringSubmatch(cat, -1)
+		Ω(types).ShouldNot(BeEmpty())
+		plurals := make(map[string]bool)
+		for _, t := range types {
+			name, provision, del, collection := t[1], t[2], t[3], t[4]
+			Ω(provision).Should(Equal("provision_" + name))
+			Ω(del).Should(Equal("delete_" + name))
+			plurals[path.Base(collection)] = true
+			Ω(cat).Should(ContainSubstring(`define ` + provision + `(@declaration) return @resource do`))
+			Ω(cat).Should(ContainSubstring(`call azure_request("post", "` + collection + `", $fields) retrieve $response`))
+			Ω(cat).Should(ContainSubstring(`@resource = azure.` + path.Base(collection) + `.get(href: "` + collection + `/" + $fields["name"])`))
+			Ω(cat).Should(ContainSubstring(`define ` + del + `(@resource) do`))
+		}
+		for _, m := range regexp.MustCompile(`azure\.(\w+)\.`).FindAllStringSubmatch(cat, -1) {
+			Ω(plurals).Should(HaveKey(m[1]))
+		}
+		for _, m := range regexp.MustCompile(`call (\w+)\(`).FindAllStringSubmatch(cat, -1) {
+			Ω(cat).Should(MatchRegexp(`(?m)^define ` + m[1] + `\(`))
+		}
+	})
+
+	It("passes Azure credentials and limits waiting for async operations", func() {
+		timeout := *config.CATOperationTimeout
+		defer func() { *config.CATOperationTimeout = timeout }()
+		*config.CATOperationTimeout = 5 * time.Minute
+		generate()
+		Ω(cat).Should(ContainSubstring(`  $headers = {
+    "user-agent": "self_service",
+    "X-Azure-Tenant-Id": cred("AZURE_TENANT_ID"),
+    "X-Azure-Client-Id": cred("AZURE_CLIENT_ID"),
+    "X-Azure-Client-Secret": cred("AZURE_CLIENT_SECRET"),
+    "X-Azure-Subscription-Id": cred("AZURE_SUBSCRIPTION_ID")
+  }`))
+		Ω(cat).Should(ContainSubstring(`      if $attempts >= 30
+        raise "Azure operation is not completed in 5m0s"
+      end`))
+	})
+
+	It("skips resource types without values of path params", func() {
+		generate()
+		Ω(cat).Should(ContainSubstring("#   subnet: network_id"))
+		Ω(cat).ShouldNot(ContainSubstring(`type "subnet"`))
+
+		*config.CATPathParams = "group_name=Group-2,network_id=net1"
+		generate()
+		Ω(cat).Should(ContainSubstring(`path "/resource_groups/Group-2/networks/net1/subnets"`))
+		Ω(cat).ShouldNot(ContainSubstring(`field "network_id"`))
+	})
+
+	It("fails on malformed path params", func() {
+		*config.CATPathParams = "group_name"
+		Ω(GenerateCAT(new(bytes.Buffer))).Should(MatchError("expected 'param=value', got 'group_name'"))
+	})
+})
@@ -0,0 +1,77 @@
+package resources
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("clouds", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("listing in the selected cloud", func() {
+		var cloud *ghttp.Server
+
+		BeforeEach(func() {
+			cloud = ghttp.NewServer()
+			err = config.AddEnvironment(&config.Environment{
+				Name:               "azurestack",
+				ResourceManagerURL: cloud.URL(),
+				AuthHost:           cloud.URL(),
+				TokenAudience:      "https://management.local.azurestack.external/",
+				StorageSuffix:      "local.azurestack.external",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			cloud.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+				),
+			)
+			client.Headers = http.Header{"X-Azure-Cloud": {"azurestack"}}
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		AfterEach(func() {
+			cloud.Close()
+		})
+
+		It("sends requests to the endpoint of the selected cloud", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(BeEmpty())
+			Ω(cloud.ReceivedRequests()).Should(HaveLen(1))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+
+	Describe("listing in unknown cloud", func() {
+		BeforeEach(func() {
+			client.Headers = http.Header{"X-Azure-Cloud": {"mars"}}
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		It("returns validation error", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(400))
+			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'cloud' parameter.\"}"))
+		})
+	})
+})
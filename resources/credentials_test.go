@@ -0,0 +1,124 @@
+package resources
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+var _ = Describe("credentials in headers", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	It("prefers bearer token and subscription headers over cookies", func() {
+		do.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/subscriptions/header_subscription/resourceGroups/Group-3/"+networkPath),
+				ghttp.VerifyHeaderKV("Authorization", "Bearer header_access_token"),
+				ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+			),
+		)
+		client.Headers = http.Header{
+			"Authorization":           {"Bearer header_access_token"},
+			"X-Azure-Subscription-Id": {"header_subscription"},
+		}
+		response, err = client.Get("/resource_groups/Group-3/networks")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(HaveLen(1))
+		Ω(response.Status).Should(Equal(200))
+	})
+
+	It("rejects unsupported authorization scheme", func() {
+		client.Headers = http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}}
+		response, err = client.Get("/resource_groups/Group-3/networks")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(HaveLen(0))
+		Ω(response.Status).Should(Equal(400))
+	})
+
+	It("requests access token with service principal headers", func() {
+		config.AuthHost = do.URL()
+		AccessTokenTest = ""
+		defer func() { AccessTokenTest = "fake" }()
+		do.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/header_tenant/oauth2/token"),
+				ghttp.VerifyForm(url.Values{"client_id": {"header_client"}, "client_secret": {"header_secret"}}),
+				ghttp.RespondWith(http.StatusOK, `{"access_token": "header_sp_token", "expires_on": "`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`"}`),
+			),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+				ghttp.VerifyHeaderKV("Authorization", "Bearer header_sp_token"),
+				ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+			),
+		)
+		client.Headers = http.Header{
+			"X-Azure-Tenant-Id":       {"header_tenant"},
+			"X-Azure-Client-Id":       {"header_client"},
+			"X-Azure-Client-Secret":   {"header_secret"},
+			"X-Azure-Refresh-Token":   {"header_refresh_token"},
+			"X-Azure-Subscription-Id": {subscriptionID},
+		}
+		response, err = client.Get("/resource_groups/Group-3/networks")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(HaveLen(2))
+		Ω(response.Status).Should(Equal(200))
+		Ω(response.Cookies).Should(BeEmpty())
+	})
+
+	It("returns access token in the cookies for credentials passed in the cookies", func() {
+		config.AuthHost = do.URL()
+		AccessTokenTest = ""
+		CredsTest = am.Credentials{
+			TenantID:     "cookie_tenant",
+			ClientID:     "cookie_client",
+			ClientSecret: "cookie_secret",
+			RefreshToken: "cookie_refresh_token",
+			Subscription: subscriptionID,
+		}
+		defer func() {
+			AccessTokenTest = "fake"
+			CredsTest = am.Credentials{Subscription: subscriptionID}
+		}()
+		do.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/cookie_tenant/oauth2/token"),
+				ghttp.RespondWith(http.StatusOK, `{"access_token": "cookie_sp_token", "expires_on": "`+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+`"}`),
+			),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+				ghttp.VerifyHeaderKV("Authorization", "Bearer cookie_sp_token"),
+				ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+			),
+		)
+		response, err = client.Get("/resource_groups/Group-3/networks")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(200))
+		names := []string{}
+		for _, cookie := range response.Cookies {
+			names = append(names, cookie.Name)
+		}
+		Ω(names).Should(ConsistOf("AccessToken", "ExpiresOn"))
+	})
+})
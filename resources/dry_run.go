@@ -0,0 +1,77 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/cassette"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+// DryRunHeader requests dry run of create, update or delete like 'dry_run=true' query param does
+const DryRunHeader = am.DryRunHeader
+
+// dryRunResponseParams describes request which would be sent to Azure
+type dryRunResponseParams struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	APIVersion string      `json:"api_version"`
+	Body       interface{} `json:"body,omitempty"`
+	Warnings   []string    `json:"warnings,omitempty"`
+}
+
+// isDryRun reports whether request to Azure should be returned to the caller instead of being sent
+func isDryRun(c *echo.Context) bool {
+	return am.IsDryRun(c)
+}
+
+// rejectDryRun fails calls which could not be dry run, so they don't change anything if dry run is requested
+func rejectDryRun(c *echo.Context) error {
+	if isDryRun(c) {
+		return eh.GenericException(fmt.Sprintf("Dry run is not supported by '%s' route.", c.Request().URL.Path))
+	}
+	return nil
+}
+
+// renderDryRun responds with request which would be sent to Azure, secrets of the body are masked.
+// URL is reported as it is sent: to the selected cloud and with overridden API version if the path is built via primaryPath
+func renderDryRun(c *echo.Context, method string, path string, params interface{}, warnings ...string) error {
+	env, err := GetEnvironment(c)
+	if err != nil {
+		return err
+	}
+	path = am.EnvironmentURL(env, path)
+	u, err := url.Parse(path)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while parsing path: %v", err))
+	}
+	responseParams := dryRunResponseParams{
+		Method:     method,
+		URL:        path,
+		APIVersion: u.Query().Get("api-version"),
+		Warnings:   warnings,
+	}
+	if params != nil {
+		responseParams.Body, err = redactParams(params)
+		if err != nil {
+			return err
+		}
+	}
+	return Render(c, 200, responseParams, "vnd.rightscale.dry_run+json")
+}
+
+// redactParams returns params sent to Azure as decoded JSON with secrets masked
+func redactParams(params interface{}) (interface{}, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while marshaling data: %v", err))
+	}
+	var body interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while marshaling data: %v", err))
+	}
+	return cassette.RedactJSON(body), nil
+}
@@ -0,0 +1,69 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("dry run", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	It("reports URL of the selected cloud with overridden API version", func() {
+		Expect(config.AddEnvironment(&config.Environment{
+			Name:               "azurestack",
+			ResourceManagerURL: "https://management.local.azurestack.external",
+			AuthHost:           "https://login.local.azurestack.external",
+			TokenAudience:      "https://management.local.azurestack.external/",
+		})).To(Succeed())
+		client.Headers = http.Header{"X-Azure-Cloud": {"azurestack"}}
+		response, err = client.Delete("/resource_groups/Group-3/networks/net1?dry_run=true&api_version=2017-03-01")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(BeEmpty())
+		Ω(response.Status).Should(Equal(200))
+		var dryRun dryRunResponseParams
+		Expect(json.Unmarshal([]byte(response.Body), &dryRun)).To(Succeed())
+		Ω(dryRun.URL).Should(Equal("https://management.local.azurestack.external/subscriptions/" + subscriptionID + "/resourceGroups/Group-3/" + networkPath + "/net1?api-version=2017-03-01"))
+		Ω(dryRun.APIVersion).Should(Equal("2017-03-01"))
+	})
+
+	It("is rejected by registration of provider", func() {
+		response, err = client.Post("/providers/Microsoft.Network/register?dry_run=true", "")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(BeEmpty())
+		Ω(response.Status).Should(Equal(400))
+		Ω(response.Body).Should(ContainSubstring("Dry run is not supported"))
+	})
+
+	It("is rejected by registration of application", func() {
+		client.Headers = http.Header{DryRunHeader: {"true"}}
+		response, err = client.Post("/application/register", "")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(BeEmpty())
+		Ω(response.Status).Should(Equal(400))
+
+		response, err = client.Delete("/application/unregister")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(BeEmpty())
+		Ω(response.Status).Should(Equal(400))
+	})
+})
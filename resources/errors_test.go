@@ -0,0 +1,68 @@
+package resources
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("Azure errors", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("creating with error from Azure", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2"),
+					ghttp.RespondWith(http.StatusConflict, `{"error":{"code":"InUseSubnetCannotBeDeleted","message":"Subnet default is in use.","target":"subnets","details":[{"code":"InUseSubnet","message":"Subnet default is used by khrvi_ni."}]}}`, http.Header{"X-Ms-Request-Id": {"f2a3c1e0-0000-4000-8000-000000000001"}}),
+				),
+			)
+			response, err = client.Post("/resource_groups/Group-3/networks", "{\"name\": \"net2\", \"location\": \"westus\", \"address_prefixes\": [\"10.0.0.0/16\"]}")
+		})
+
+		It("returns status code gotten from Azure", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(409))
+		})
+
+		It("returns Azure error and request id in the body", func() {
+			Ω(response.Body).Should(MatchJSON(`{"Code":409,"Message":"Error has occurred while creating resource: Subnet default is in use.","error":{"code":"InUseSubnetCannotBeDeleted","message":"Subnet default is in use.","target":"subnets","details":[{"code":"InUseSubnet","message":"Subnet default is used by khrvi_ni."}]},"x-ms-request-id":"f2a3c1e0-0000-4000-8000-000000000001"}`))
+		})
+	})
+
+	Describe("deleting without permissions", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net1"),
+					ghttp.RespondWith(http.StatusForbidden, `{"error":{"code":"AuthorizationFailed","message":"The client does not have authorization to perform action."}}`),
+				),
+			)
+			response, err = client.Delete("/resource_groups/Group-3/networks/net1")
+		})
+
+		It("returns 403 status code with Azure error code", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(403))
+			Ω(response.Body).Should(MatchJSON(`{"Code":403,"Message":"Error has occurred while deleting resource: The client does not have authorization to perform action.","error":{"code":"AuthorizationFailed","message":"The client does not have authorization to perform action."}}`))
+		})
+	})
+})
@@ -18,6 +18,15 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:        "event",
+		ContentType: "application/json",
+		Actions:     []string{ActionList},
+		Setup:       SetupEventsRoutes,
+	})
+}
+
 // SetupEventsRoutes declares routes for event resource
 func SetupEventsRoutes(e *echo.Group) {
 	e.Get("/events", listEvents)
@@ -34,7 +43,7 @@ func listEvents(c *echo.Context) error {
 		return err
 	}
 	filter := requestParams.Filter
-	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.insights/eventtypes/management/values?api-version=%s&$filter=%s", config.BaseURL, creds.Subscription, "2014-04-01", filter)
+	path := fmt.Sprintf("%s/subscriptions/%s/providers/microsoft.insights/eventtypes/management/values?api-version=%s&$filter=%s", config.BaseURL, creds.Subscription, config.APIVersion("Microsoft.Insights/eventTypes"), filter)
 	if requestParams.Select != "" {
 		path = fmt.Sprintf("%s&$select=%s", path, requestParams.Select)
 	}
@@ -61,7 +70,7 @@ func listEvents(c *echo.Context) error {
 		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
 	if resp.StatusCode >= 400 {
-		return eh.GenericException(fmt.Sprintf("Error has occurred while getting resource: %s", string(b)))
+		return eh.AzureException("Error has occurred while getting resource", resp, b)
 	}
 
 	var m map[string][]map[string]interface{}
@@ -0,0 +1,100 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+	fakeARM "github.com/rightscale/azure_arm_proxy/fake_arm"
+)
+
+var _ = Describe("fake ARM", func() {
+
+	var fake *httptest.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		fake = httptest.NewServer(fakeARM.NewServer())
+		config.BaseURL, config.AuthHost, config.GraphURL = fake.URL, fake.URL, fake.URL
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		fake.Close()
+	})
+
+	waitOperation := func(token string) {
+		Ω(token).ShouldNot(BeEmpty())
+		var operation operationResponseParams
+		for _, status := range []string{"in-progress", "succeeded"} {
+			response, err = client.Get("/operations/" + token)
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Expect(json.Unmarshal([]byte(response.Body), &operation)).To(Succeed())
+			Ω(operation.Status).Should(Equal(status))
+		}
+	}
+
+	It("creates, lists and deletes resources", func() {
+		response, err = client.Post("/resource_groups", `{"name": "fake-group", "location": "westus"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(201))
+
+		response, err = client.Post("/resource_groups/fake-group/networks", `{"name": "net", "location": "westus", "address_prefixes": ["10.0.0.0/16"], "subnets": [{"name": "default", "address_prefix": "10.0.1.0/24"}]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(202))
+		waitOperation(response.Headers.Get("OperationToken"))
+
+		response, err = client.Get("/resource_groups/fake-group/networks/net")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(200))
+		var network networkResponseParams
+		Expect(json.Unmarshal([]byte(response.Body), &network)).To(Succeed())
+		Ω(network.Location).Should(Equal("westus"))
+		Ω(network.Properties).Should(HaveKeyWithValue("provisioningState", "Succeeded"))
+
+		response, err = client.Get("/resource_groups/fake-group/networks/net/subnets")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(200))
+		var subnets []subnetResponseParams
+		Expect(json.Unmarshal([]byte(response.Body), &subnets)).To(Succeed())
+		Ω(subnets).Should(HaveLen(1))
+		Ω(subnets[0].Name).Should(Equal("default"))
+		Ω(subnets[0].Href).Should(Equal("resource_groups/fake-group/networks/net/subnets/default"))
+
+		response, err = client.Delete("/resource_groups/fake-group/networks/net")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(202))
+		waitOperation(response.Headers.Get("OperationToken"))
+
+		response, err = client.Get("/resource_groups/fake-group/networks/net")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(404))
+	})
+
+	It("fails to create resource in missing resource group", func() {
+		response, err = client.Post("/resource_groups/missing/networks", `{"name": "net", "location": "westus", "address_prefixes": ["10.0.0.0/16"]}`)
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(404))
+		Ω(response.Body).Should(ContainSubstring("ResourceGroupNotFound"))
+	})
+
+	It("issues access tokens for client credentials", func() {
+		creds := CredsTest
+		AccessTokenTest = ""
+		CredsTest.TenantID, CredsTest.ClientID, CredsTest.ClientSecret, CredsTest.RefreshToken = "fake-tenant", "fake-client", "fake-secret", "fake-refresh-token"
+		defer func() {
+			AccessTokenTest = "fake"
+			CredsTest = creds
+		}()
+		response, err = client.Get("/resource_groups")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(200))
+		Ω(response.Body).Should(MatchJSON("[]"))
+	})
+})
@@ -0,0 +1,93 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+// PartialFailuresHeader lists parents whose child resources could not be listed
+const PartialFailuresHeader = "X-Partial-Failures"
+
+// childListing is a request for child resources of one parent
+type childListing struct {
+	// Parent is an ID of parent resource reported if listing fails
+	Parent string
+	Path   string
+	// Prepare is called for every child resource, ex: to add href
+	Prepare func(resource map[string]interface{})
+}
+
+// partialFailure describes failed listing of child resources
+type partialFailure struct {
+	Parent  string `json:"parent"`
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// listChildren gets child resources of all parents with at most 'fan_out_concurrency' concurrent requests,
+// every request is limited by 'fan_out_timeout'. Resources are returned in the order of listings,
+// failed listings are reported separately. Error is returned only if all listings fail.
+func listChildren(c *echo.Context, listings []childListing) ([]map[string]interface{}, []partialFailure, error) {
+	client, err := GetAzureClient(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	client = &http.Client{Transport: client.Transport, Timeout: *config.FanOutTimeout}
+
+	results := make([][]map[string]interface{}, len(listings))
+	errs := make([]error, len(listings))
+	slots := make(chan struct{}, *config.FanOutConcurrency)
+	var wg sync.WaitGroup
+	for i, listing := range listings {
+		wg.Add(1)
+		go func(i int, listing childListing) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i], errs[i] = fetchResources(client, listing.Path)
+		}(i, listing)
+	}
+	wg.Wait()
+
+	resources := make([]map[string]interface{}, 0)
+	var failures []partialFailure
+	for i, listing := range listings {
+		if errs[i] != nil {
+			config.Logger.Error("Unable to list child resources:", "parent", listing.Parent, "error", errs[i])
+			failures = append(failures, partialFailure{Parent: listing.Parent, Status: eh.StatusCode(errs[i]), Message: errs[i].Error()})
+			continue
+		}
+		for _, resource := range results[i] {
+			if listing.Prepare != nil {
+				listing.Prepare(resource)
+			}
+		}
+		resources = append(resources, results[i]...)
+	}
+	if len(failures) > 0 && len(failures) == len(listings) {
+		return nil, nil, errs[0]
+	}
+	return resources, failures, nil
+}
+
+// renderChildren renders child resources of all parents, failed listings are reported in 'X-Partial-Failures' header
+// as JSON array: [{"parent": "<parent ID>", "status": 403, "message": "..."}]
+func renderChildren(c *echo.Context, listings []childListing, contentType string) error {
+	resources, failures, err := listChildren(c, listings)
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		b, err := json.Marshal(failures)
+		if err != nil {
+			return eh.GenericException("Error has occurred while marshaling partial failures: " + err.Error())
+		}
+		c.Response().Header().Set(PartialFailuresHeader, string(b))
+	}
+	return RenderCollection(c, resources, contentType)
+}
@@ -3,10 +3,14 @@ package resources
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
 	"github.com/rightscale/azure_arm_proxy/middleware"
+	rid "github.com/rightscale/azure_arm_proxy/resource_id"
 )
 
 // GetAzureClient retrieves client initialized by middleware, send error response if not found
@@ -28,3 +32,98 @@ func GetClientCredentials(c *echo.Context) (*middleware.Credentials, error) {
 	}
 	return creds, nil
 }
+
+// primaryPath applies API version requested via 'api_version' param or header to the path of the resource handled by the request,
+// other requests sent to Azure (ex: lookups of parents, next pages, polling of operations) keep configured API versions
+func primaryPath(c *echo.Context, path string) string {
+	apiVersion := middleware.APIVersionOverride(c)
+	if apiVersion == "" {
+		return path
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	query := u.Query()
+	query.Set("api-version", apiVersion)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// setProperty sets value of the object property found by path of keys, nested objects are created if needed
+// ex: setProperty(object, "Standard_A1", "properties", "hardwareProfile", "vmSize")
+func setProperty(object map[string]interface{}, value interface{}, keys ...string) {
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := object[key].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			object[key] = nested
+		}
+		object = nested
+	}
+	object[keys[len(keys)-1]] = value
+}
+
+// GetEnvironment retrieves Azure cloud selected by middleware, send error response if not found
+func GetEnvironment(c *echo.Context) (*config.Environment, error) {
+	env, _ := c.Get("environment").(*config.Environment)
+	if env == nil {
+		return nil, eh.GenericException(fmt.Sprintf("failed to retrieve Azure cloud, check middleware"))
+	}
+	return env, nil
+}
+
+// hrefCollections maps plugin collections to Azure resource types they contain,
+// top level types are prefixed by the provider namespace, child types are not
+var hrefCollections = map[string][]string{
+	"availability_sets":                    {"Microsoft.Compute/availabilitySets"},
+	"instances":                            {"Microsoft.Compute/virtualMachines"},
+	"ip_addresses":                         {"Microsoft.Network/publicIPAddresses"},
+	"network_interfaces":                   {"Microsoft.Network/networkInterfaces"},
+	"network_security_groups":              {"Microsoft.Network/networkSecurityGroups"},
+	"network_security_group_rules":         {"securityRules"},
+	"default_network_security_group_rules": {"defaultSecurityRules"},
+	"networks":                             {"Microsoft.Network/virtualNetworks"},
+	"route_tables":                         {"Microsoft.Network/routeTables"},
+	"routes":                               {"routes"},
+	"storage_accounts":                     {"Microsoft.Storage/storageAccounts"},
+	"subnets":                              {"subnets"},
+	"virtual_network_gateways":             {"Microsoft.Network/virtualNetworkGateways"},
+}
+
+// buildHref builds href of the resource from its Azure ID, collections are plugin names of resource types
+// in the order they appear in the ID, ex: buildHref(subnetID, "networks", "subnets")
+func buildHref(resourceID string, collections ...string) string {
+	id, err := rid.Parse(resourceID)
+	if err == nil && len(id.Names) != len(collections) {
+		err = fmt.Errorf("expected %d resource types, got %d", len(collections), len(id.Names))
+	}
+	for i := 0; err == nil && i < len(collections); i++ {
+		resourceType := id.Types[i]
+		if i == 0 {
+			resourceType = id.Provider + "/" + resourceType
+		}
+		if !containsFold(hrefCollections[collections[i]], resourceType) {
+			err = fmt.Errorf("resource type '%s' doesn't match '%s' collection", resourceType, collections[i])
+		}
+	}
+	if err != nil {
+		config.Logger.Error("Unable to build href:", "id", resourceID, "error", err)
+		return ""
+	}
+	href := "resource_groups/" + id.ResourceGroup
+	for i, collection := range collections {
+		href += "/" + collection + "/" + id.Names[i]
+	}
+	return href
+}
+
+// containsFold checks whether the list contains the value ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,397 @@
+package resources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+// imageIndex is a catalog of VM images available in the location
+type imageIndex struct {
+	Location  string                   `json:"location"`
+	CrawledAt time.Time                `json:"crawled_at"`
+	Images    []map[string]interface{} `json:"images"`
+}
+
+// imageCrawl is a crawl in progress, requests waiting for missing index share it
+type imageCrawl struct {
+	done  chan struct{}
+	index *imageIndex
+	err   error
+}
+
+// imageIndexStore keeps crawled indexes in memory and on disk in 'image_index_dir'
+type imageIndexStore struct {
+	mu      sync.Mutex
+	indexes map[string]*imageIndex
+	crawls  map[string]*imageCrawl
+}
+
+var imageIndexes = newImageIndexStore()
+
+func newImageIndexStore() *imageIndexStore {
+	return &imageIndexStore{
+		indexes: make(map[string]*imageIndex),
+		crawls:  make(map[string]*imageCrawl),
+	}
+}
+
+// get returns index of the location, missing index is crawled while the caller waits,
+// stale one is returned at once and crawled again in background
+func (s *imageIndexStore) get(env *config.Environment, location string, crawler *imageCrawler) (*imageIndex, error) {
+	key := imageIndexKey(env, location)
+	s.mu.Lock()
+	index := s.indexes[key]
+	if index == nil {
+		index = loadImageIndex(key)
+		if index != nil {
+			s.indexes[key] = index
+		}
+	}
+	if index != nil {
+		if time.Since(index.CrawledAt) > *config.ImageIndexTTL {
+			s.startCrawl(key, location, crawler)
+		}
+		s.mu.Unlock()
+		return index, nil
+	}
+	crawl := s.startCrawl(key, location, crawler)
+	s.mu.Unlock()
+	<-crawl.done
+	return crawl.index, crawl.err
+}
+
+// startCrawl crawls the location unless it is already being crawled, it should be called under lock
+func (s *imageIndexStore) startCrawl(key string, location string, crawler *imageCrawler) *imageCrawl {
+	if crawl, ok := s.crawls[key]; ok {
+		return crawl
+	}
+	crawl := &imageCrawl{done: make(chan struct{})}
+	s.crawls[key] = crawl
+	go func() {
+		started := time.Now()
+		images, err := crawler.crawl()
+		s.mu.Lock()
+		if err == nil {
+			crawl.index = &imageIndex{Location: location, CrawledAt: started, Images: images}
+			s.indexes[key] = crawl.index
+			if err := saveImageIndex(key, crawl.index); err != nil {
+				config.Logger.Error("Unable to save image index:", "location", location, "error", err)
+			}
+			config.Logger.Info("Image index crawled:", "location", location, "images", len(images), "duration", time.Since(started))
+		} else {
+			crawl.err = err
+			config.Logger.Error("Unable to crawl image index:", "location", location, "error", err)
+		}
+		delete(s.crawls, key)
+		s.mu.Unlock()
+		close(crawl.done)
+	}()
+	return crawl
+}
+
+// imageIndexKey identifies location of the cloud, endpoint is used since clouds could be customized
+func imageIndexKey(env *config.Environment, location string) string {
+	sum := sha256.Sum256([]byte(env.ResourceManagerURL))
+	return fmt.Sprintf("%s_%s_%s", strings.ToLower(env.Name), hex.EncodeToString(sum[:4]), strings.ToLower(location))
+}
+
+func imageIndexPath(key string) string {
+	return filepath.Join(*config.ImageIndexDir, key+".json")
+}
+
+// loadImageIndex reads index from disk, nil is returned if it is missing or unreadable
+func loadImageIndex(key string) *imageIndex {
+	b, err := ioutil.ReadFile(imageIndexPath(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			config.Logger.Error("Unable to load image index:", "path", imageIndexPath(key), "error", err)
+		}
+		return nil
+	}
+	var index imageIndex
+	if err := json.Unmarshal(b, &index); err != nil {
+		config.Logger.Error("Unable to load image index:", "path", imageIndexPath(key), "error", err)
+		return nil
+	}
+	return &index
+}
+
+// saveImageIndex writes index to temporary file and renames it to not leave partially written index
+func saveImageIndex(key string, index *imageIndex) error {
+	if err := os.MkdirAll(*config.ImageIndexDir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(*config.ImageIndexDir, key)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), imageIndexPath(key))
+}
+
+// imageCrawler walks publishers, offers, SKUs and versions of the location with limited number of concurrent requests
+type imageCrawler struct {
+	client       *http.Client
+	subscription string
+	location     string
+	// slots limit number of concurrent requests
+	slots chan struct{}
+
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	images []map[string]interface{}
+	err    error
+}
+
+func newImageCrawler(client *http.Client, subscription string, location string) *imageCrawler {
+	return &imageCrawler{
+		client:       client,
+		subscription: subscription,
+		location:     location,
+		slots:        make(chan struct{}, *config.ImageCrawlConcurrency),
+	}
+}
+
+// crawl returns all images of the location sorted by publisher, offer, SKU and version,
+// the first error stops the crawl
+func (cr *imageCrawler) crawl() ([]map[string]interface{}, error) {
+	publishers, err := cr.list("")
+	if err != nil {
+		return nil, err
+	}
+	for _, publisher := range publishers {
+		publisher := publisher
+		cr.spawn(func() error { return cr.crawlPublisher(publisher) })
+	}
+	cr.wg.Wait()
+	if cr.err != nil {
+		return nil, cr.err
+	}
+	sort.Sort(byImageVersion(cr.images))
+	return cr.images, nil
+}
+
+func (cr *imageCrawler) crawlPublisher(publisher string) error {
+	offers, err := cr.list(fmt.Sprintf("/%s/artifacttypes/vmimage/offers", publisher))
+	if err != nil {
+		return err
+	}
+	for _, offer := range offers {
+		offer := offer
+		cr.spawn(func() error { return cr.crawlOffer(publisher, offer) })
+	}
+	return nil
+}
+
+func (cr *imageCrawler) crawlOffer(publisher string, offer string) error {
+	skus, err := cr.list(fmt.Sprintf("/%s/artifacttypes/vmimage/offers/%s/skus", publisher, offer))
+	if err != nil {
+		return err
+	}
+	for _, sku := range skus {
+		sku := sku
+		cr.spawn(func() error { return cr.crawlSku(publisher, offer, sku) })
+	}
+	return nil
+}
+
+func (cr *imageCrawler) crawlSku(publisher string, offer string, sku string) error {
+	versions, err := cr.list(fmt.Sprintf("/%s/artifacttypes/vmimage/offers/%s/skus/%s/versions", publisher, offer, sku))
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		version := version
+		cr.spawn(func() error { return cr.crawlVersion(publisher, offer, sku, version) })
+	}
+	return nil
+}
+
+func (cr *imageCrawler) crawlVersion(publisher string, offer string, sku string, version string) error {
+	path := cr.path(fmt.Sprintf("/%s/artifacttypes/vmimage/offers/%s/skus/%s/versions/%s", publisher, offer, sku, version))
+	cr.slots <- struct{}{}
+	resp, err := cr.client.Get(path)
+	<-cr.slots
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while requesting resource: %v", err))
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
+	}
+	// skip images with invalid version name, ex: "15.04.201511272055" of "15.04-Snappy" SKU is listed
+	// but its details are not available: {"error": {"code": "InvalidParameter", "target": "version", ...}}
+	if resp.StatusCode == 400 {
+		config.Logger.Info("Skip image with invalid version:", "path", path, "response", string(b))
+		return nil
+	}
+	if resp.StatusCode >= 400 {
+		return eh.AzureException("Error has occurred while requesting resource", resp, b)
+	}
+	var image map[string]interface{}
+	if err := json.Unmarshal(b, &image); err != nil {
+		return eh.GenericException(fmt.Sprintf("got bad response from server: %s", string(b)))
+	}
+	image["publisher"] = publisher
+	image["offer"] = offer
+	image["sku"] = sku
+	cr.mu.Lock()
+	cr.images = append(cr.images, image)
+	cr.mu.Unlock()
+	return nil
+}
+
+// list returns names of the catalog entries under the given path relative to publishers of the location
+func (cr *imageCrawler) list(path string) ([]string, error) {
+	cr.slots <- struct{}{}
+	entries, err := fetchResources(cr.client, cr.path(path))
+	<-cr.slots
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if name, ok := entry["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (cr *imageCrawler) path(path string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers%s?api-version=%s", config.BaseURL, cr.subscription, computePath, cr.location, path, config.APIVersion("Microsoft.Compute/locations/publishers"))
+}
+
+// spawn runs step of the crawl in its own goroutine, steps are skipped after the first error
+func (cr *imageCrawler) spawn(step func() error) {
+	cr.wg.Add(1)
+	go func() {
+		defer cr.wg.Done()
+		if cr.failed() {
+			return
+		}
+		if err := step(); err != nil {
+			cr.mu.Lock()
+			if cr.err == nil {
+				cr.err = err
+			}
+			cr.mu.Unlock()
+		}
+	}()
+}
+
+func (cr *imageCrawler) failed() bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.err != nil
+}
+
+// filterImages returns images matching 'publisher', 'offer', 'sku' and 'os_type' query params,
+// only the latest version of every SKU is returned if 'latest' is true
+func filterImages(images []map[string]interface{}, filters map[string]string, latest bool) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0)
+	for _, image := range images {
+		matched := true
+		for field, value := range filters {
+			if value != "" && !strings.EqualFold(imageField(image, field), value) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		// images are sorted, so the latest version of SKU is the last one
+		if n := len(result); latest && n > 0 && sameSku(result[n-1], image) {
+			result[n-1] = image
+			continue
+		}
+		result = append(result, image)
+	}
+	return result
+}
+
+// imageField returns value of filtered field, 'os_type' is taken from image properties
+func imageField(image map[string]interface{}, field string) string {
+	if field == "os_type" {
+		properties, _ := image["properties"].(map[string]interface{})
+		osDiskImage, _ := properties["osDiskImage"].(map[string]interface{})
+		osType, _ := osDiskImage["operatingSystem"].(string)
+		return osType
+	}
+	value, _ := image[field].(string)
+	return value
+}
+
+func sameSku(a map[string]interface{}, b map[string]interface{}) bool {
+	for _, field := range []string{"publisher", "offer", "sku"} {
+		if !strings.EqualFold(imageField(a, field), imageField(b, field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// byImageVersion sorts images by publisher, offer, SKU and version
+type byImageVersion []map[string]interface{}
+
+func (s byImageVersion) Len() int      { return len(s) }
+func (s byImageVersion) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byImageVersion) Less(i, j int) bool {
+	for _, field := range []string{"publisher", "offer", "sku"} {
+		a, b := strings.ToLower(imageField(s[i], field)), strings.ToLower(imageField(s[j], field))
+		if a != b {
+			return a < b
+		}
+	}
+	return compareVersions(imageField(s[i], "name"), imageField(s[j], "name")) < 0
+}
+
+// compareVersions compares dotted versions part by part, numeric parts are compared as numbers
+func compareVersions(a string, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseInt(as[i], 10, 64)
+		bn, bErr := strconv.ParseInt(bs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
@@ -3,16 +3,28 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
 )
 
 const (
-	computePath        = "providers/Microsoft.Compute"
-	locationApiVersion = "2016-02-01"
+	computePath = "providers/Microsoft.Compute"
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:        "image",
+		ContentType: "application/json",
+		Actions:     []string{ActionList, ActionGet},
+		Setup:       SetupImageRoutes,
+	})
+}
+
 // SetupImageRoutes declares routes for Image resource
 func SetupImageRoutes(e *echo.Group) {
 	e.Get("/locations", listLocations)
@@ -26,42 +38,42 @@ func SetupImageRoutes(e *echo.Group) {
 	e.Get("/locations/:location/publishers/:publisher/offers/:offer/skus/:sku/versions/:version", getVersionInfo)
 }
 
+// listImages answers from the index of VM images of the location, the index is crawled on the first request
+// and refreshed in background after 'image_index_ttl'. Images could be filtered by 'publisher', 'offer', 'sku'
+// and 'os_type' query params, 'latest=true' leaves only the latest version of every SKU.
 func listImages(c *echo.Context) error {
 	location := c.Param("location")
 	creds, err := GetClientCredentials(c)
 	if err != nil {
 		return err
 	}
-	publishers, err := getPublishers(c, creds.Subscription, location)
+	env, err := GetEnvironment(c)
 	if err != nil {
 		return err
 	}
-	var result []map[string]interface{}
-	for _, publisher := range publishers {
-		offers, _ := getOffers(c, creds.Subscription, location, publisher["name"].(string))
-		for _, offer := range offers {
-			skus, _ := getSkus(c, creds.Subscription, location, publisher["name"].(string), offer["name"].(string))
-			for _, sku := range skus {
-				versions, _ := getVersions(c, creds.Subscription, location, publisher["name"].(string), offer["name"].(string), sku["name"].(string))
-				for _, version := range versions {
-					version, _ := getVersion(c, creds.Subscription, location, publisher["name"].(string), offer["name"].(string), sku["name"].(string), version["name"].(string))
-					// skip images with invalid version name
-					// workaround for versions like - "/Subscriptions/2d2b2267-ff0a-46d3-9912-8577acb18a0a/Providers/Microsoft.Compute/Locations/westus/Publishers/Canonical/ArtifactTypes/VMImage/Offers/Ubuntu15.04Snappy/Skus/15.04-Snappy/Versions/15.04.201511272055"
-					// "error": {
-					//   "code": "InvalidParameter",
-					//   "target": "version",
-					//   "message": "The value of parameter 'version' is invalid."
-					// }
-					if version != nil {
-						result = append(result, version)
-					}
-				}
-			}
+	latest := false
+	if param := c.Query("latest"); param != "" {
+		latest, err = strconv.ParseBool(param)
+		if err != nil {
+			return eh.InvalidParamException("latest")
 		}
 	}
-
-	//TODO: add hrefs or use AzureResource interface
-	return c.JSON(200, result)
+	client, err := am.NewDetachedClient(c)
+	if err != nil {
+		return err
+	}
+	index, err := imageIndexes.get(env, location, newImageCrawler(client, creds.Subscription, location))
+	if err != nil {
+		return err
+	}
+	images := filterImages(index.Images, map[string]string{
+		"publisher": c.Query("publisher"),
+		"offer":     c.Query("offer"),
+		"sku":       c.Query("sku"),
+		"os_type":   c.Query("os_type"),
+	}, latest)
+	c.Response().Header().Set("X-Crawled-At", index.CrawledAt.UTC().Format(time.RFC3339))
+	return RenderCollection(c, images, "application/json")
 }
 
 func listLocations(c *echo.Context) error {
@@ -78,8 +90,8 @@ func listLocations(c *echo.Context) error {
 
 func getLocations(c *echo.Context, subscription string) ([]map[string]interface{}, error) {
 
-	path := fmt.Sprintf("%s/subscriptions/%s/locations?api-version=%s", config.BaseURL, subscription, locationApiVersion)
-	locations, err := GetResources(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/locations?api-version=%s", config.BaseURL, subscription, config.APIVersion("Microsoft.Resources/locations"))
+	locations, err := GetCachedResources(c, "locations", path)
 	if err != nil {
 		return nil, err
 	}
@@ -114,8 +126,8 @@ func listPublishers(c *echo.Context) error {
 }
 
 func getPublishers(c *echo.Context, subscription string, locationName string) ([]map[string]interface{}, error) {
-	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers?api-version=%s", config.BaseURL, subscription, computePath, locationName, microsoftComputeApiVersion)
-	publishers, err := GetResources(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers?api-version=%s", config.BaseURL, subscription, computePath, locationName, config.APIVersion("Microsoft.Compute/locations/publishers"))
+	publishers, err := GetCachedResources(c, "images", path)
 	if err != nil {
 		fmt.Printf("SKIP FOR %s because of error: %s\n", locationName, err)
 		emptyArray := make([]map[string]interface{}, 0)
@@ -140,8 +152,8 @@ func listOffers(c *echo.Context) error {
 }
 
 func getOffers(c *echo.Context, subscription string, locationName string, publisherName string) ([]map[string]interface{}, error) {
-	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, microsoftComputeApiVersion)
-	offers, err := GetResources(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, config.APIVersion("Microsoft.Compute/locations/publishers"))
+	offers, err := GetCachedResources(c, "images", path)
 	if err != nil {
 		return nil, err
 	}
@@ -164,8 +176,8 @@ func listSkus(c *echo.Context) error {
 }
 
 func getSkus(c *echo.Context, subscription string, locationName string, publisherName string, offerName string) ([]map[string]interface{}, error) {
-	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers/%s/skus?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, offerName, microsoftComputeApiVersion)
-	skus, err := GetResources(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers/%s/skus?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, offerName, config.APIVersion("Microsoft.Compute/locations/publishers"))
+	skus, err := GetCachedResources(c, "images", path)
 	if err != nil {
 		return nil, err
 	}
@@ -189,8 +201,8 @@ func listVersions(c *echo.Context) error {
 }
 
 func getVersions(c *echo.Context, subscription string, locationName string, publisherName string, offerName string, skuName string) ([]map[string]interface{}, error) {
-	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers/%s/skus/%s/versions?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, offerName, skuName, microsoftComputeApiVersion)
-	versions, err := GetResources(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers/%s/skus/%s/versions?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, offerName, skuName, config.APIVersion("Microsoft.Compute/locations/publishers"))
+	versions, err := GetCachedResources(c, "images", path)
 	if err != nil {
 		return nil, err
 	}
@@ -198,8 +210,8 @@ func getVersions(c *echo.Context, subscription string, locationName string, publ
 }
 
 func getVersion(c *echo.Context, subscription string, locationName string, publisherName string, offerName string, skuName string, versionName string) (map[string]interface{}, error) {
-	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers/%s/skus/%s/versions/%s?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, offerName, skuName, versionName, microsoftComputeApiVersion)
-	body, err := GetResource(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s/locations/%s/publishers/%s/artifacttypes/vmimage/offers/%s/skus/%s/versions/%s?api-version=%s", config.BaseURL, subscription, computePath, locationName, publisherName, offerName, skuName, versionName, config.APIVersion("Microsoft.Compute/locations/publishers"))
+	body, err := GetCachedResource(c, "images", path)
 	if err != nil {
 		return nil, err
 	}
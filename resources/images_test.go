@@ -0,0 +1,167 @@
+package resources
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+	fakeARM "github.com/rightscale/azure_arm_proxy/fake_arm"
+)
+
+var _ = Describe("images", func() {
+
+	var fake *httptest.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+	var dir string
+	var images []map[string]interface{}
+
+	BeforeEach(func() {
+		fake = httptest.NewServer(fakeARM.NewServer())
+		config.BaseURL, config.AuthHost, config.GraphURL = fake.URL, fake.URL, fake.URL
+		client = NewAzureClient()
+		dir, err = ioutil.TempDir("", "azure_arm_proxy_images")
+		Expect(err).NotTo(HaveOccurred())
+		*config.ImageIndexDir = dir
+		imageIndexes = newImageIndexStore()
+	})
+
+	AfterEach(func() {
+		fake.Close()
+		os.RemoveAll(dir)
+	})
+
+	listImages := func(query string) {
+		response, err = client.Get("/locations/westus/images" + query)
+		Expect(err).NotTo(HaveOccurred())
+		Ω(response.Status).Should(Equal(200))
+		images = nil
+		Expect(json.Unmarshal([]byte(response.Body), &images)).To(Succeed())
+	}
+
+	names := func() []string {
+		var result []string
+		for _, image := range images {
+			result = append(result, image["sku"].(string)+"/"+image["name"].(string))
+		}
+		return result
+	}
+
+	Describe("listing", func() {
+		It("crawls catalog of the location and keeps it on disk", func() {
+			listImages("")
+			Ω(names()).Should(Equal([]string{
+				"14.04.4-LTS/14.04.201604060",
+				"16.04.0-LTS/16.04.201604203",
+				"16.04.0-LTS/16.04.201611150",
+				"2012-R2-Datacenter/4.0.20160430",
+			}))
+			Ω(images[0]).Should(HaveKeyWithValue("publisher", "Canonical"))
+			Ω(images[0]).Should(HaveKeyWithValue("offer", "UbuntuServer"))
+			Ω(response.Headers.Get("X-Crawled-At")).ShouldNot(BeEmpty())
+			files, err := filepath.Glob(filepath.Join(dir, "*_westus.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Ω(files).Should(HaveLen(1))
+		})
+
+		It("answers from index on disk without Azure", func() {
+			listImages("")
+			fake.Close()
+			imageIndexes = newImageIndexStore()
+			listImages("")
+			Ω(images).Should(HaveLen(4))
+		})
+
+		It("filters images", func() {
+			listImages("?publisher=canonical&latest=true")
+			Ω(names()).Should(Equal([]string{"14.04.4-LTS/14.04.201604060", "16.04.0-LTS/16.04.201611150"}))
+			listImages("?os_type=windows")
+			Ω(names()).Should(Equal([]string{"2012-R2-Datacenter/4.0.20160430"}))
+			listImages("?offer=UbuntuServer&sku=16.04.0-LTS")
+			Ω(images).Should(HaveLen(2))
+		})
+
+		It("pages images", func() {
+			listImages("?page=2&per_page=3")
+			Ω(names()).Should(Equal([]string{"2012-R2-Datacenter/4.0.20160430"}))
+			Ω(response.Headers.Get("X-Total-Count")).Should(Equal("4"))
+		})
+
+		It("fails with invalid 'latest' param", func() {
+			response, err = client.Get("/locations/westus/images?latest=yes_please")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(400))
+		})
+	})
+
+	Describe("refreshing", func() {
+		var ttl time.Duration
+
+		BeforeEach(func() {
+			ttl = *config.ImageIndexTTL
+			*config.ImageIndexTTL = time.Hour
+		})
+
+		AfterEach(func() {
+			*config.ImageIndexTTL = ttl
+		})
+
+		It("returns stale index and crawls catalog again in background", func() {
+			listImages("")
+			env, err := config.GetEnvironment("")
+			Expect(err).NotTo(HaveOccurred())
+			key := imageIndexKey(env, "westus")
+			// the index is replaced under the lock since a crawl could update it
+			imageIndexes.mu.Lock()
+			index := *imageIndexes.indexes[key]
+			index.CrawledAt = time.Now().Add(-2 * time.Hour)
+			index.Images = index.Images[:1]
+			imageIndexes.indexes[key] = &index
+			imageIndexes.mu.Unlock()
+			listImages("")
+			Ω(images).Should(HaveLen(1))
+			Eventually(func() int {
+				listImages("")
+				return len(images)
+			}).Should(Equal(4))
+		})
+	})
+
+	Describe("crawling errors", func() {
+		var do *ghttp.Server
+
+		BeforeEach(func() {
+			do = ghttp.NewServer()
+			config.BaseURL = do.URL()
+		})
+
+		AfterEach(func() {
+			do.Close()
+		})
+
+		It("are returned instead of being dropped", func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/providers/Microsoft.Compute/locations/westus/publishers"),
+					ghttp.RespondWith(http.StatusForbidden, `{"error": {"code": "AuthorizationFailed", "message": "The client does not have authorization."}}`),
+				),
+			)
+			response, err = client.Get("/locations/westus/images")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(403))
+			Ω(response.Body).Should(ContainSubstring("AuthorizationFailed"))
+			files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+			Ω(files).Should(BeEmpty())
+		})
+	})
+})
@@ -7,6 +7,15 @@ import (
 	"github.com/rightscale/azure_arm_proxy/config"
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:        "instance_type",
+		ContentType: "application/json",
+		Actions:     []string{ActionList},
+		Setup:       SetupInstanceTypesRoutes,
+	})
+}
+
 // SetupGroupsRoutes declares routes for resource group resource
 func SetupInstanceTypesRoutes(e *echo.Group) {
 	e.Get("/locations/:location/instance_types", listInstanceTypes)
@@ -19,8 +28,8 @@ func listInstanceTypes(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/vmSizes?api-version=%s", config.BaseURL, creds.Subscription, location, microsoftComputeApiVersion)
-	its, err := GetResources(c, path)
+	path := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/vmSizes?api-version=%s", config.BaseURL, creds.Subscription, location, config.APIVersion("Microsoft.Compute/locations/vmSizes"))
+	its, err := GetCachedResources(c, "instance_types", path)
 	if err != nil {
 		return err
 	}
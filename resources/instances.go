@@ -1,25 +1,20 @@
 package resources
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	rid "github.com/rightscale/azure_arm_proxy/resource_id"
 )
 
 const (
-	virtualMachinesPath        = "providers/Microsoft.Compute/virtualMachines"
-	microsoftComputeApiVersion = "2016-03-30"
-	defaultAdminUserName       = "rsadministrator"
-	defaultAdminPassword       = "Pass1234@"
+	virtualMachinesPath  = "providers/Microsoft.Compute/virtualMachines"
+	defaultAdminUserName = "rsadministrator"
+	defaultAdminPassword = "Pass1234@"
 )
 
 type (
@@ -52,15 +47,15 @@ type (
 		Plan       map[string]interface{} `json:"plan,omitempty"`
 	}
 	createParams struct {
-		Name               string                 `json:"name,omitempty"`
-		Location           string                 `json:"location,omitempty"`
-		Size               string                 `json:"instance_type_uid,omitempty"`
+		Name               string                 `json:"name,omitempty" validate:"required"`
+		Location           string                 `json:"location,omitempty" validate:"required"`
+		Size               string                 `json:"instance_type_uid,omitempty" validate:"required"`
 		Group              string                 `json:"group_name,omitempty"`
 		NetworkInterfaceID []interface{}          `json:"network_interfaces_ids,omitempty"`
-		ImageID            string                 `json:"image_id,omitempty"`
-		PrivateImageOsType string                 `json:"private_image_os_platform,omitempty"`
+		ImageID            string                 `json:"image_id,omitempty" validate:"required"`
+		PrivateImageOsType string                 `json:"private_image_os_platform,omitempty" validate:"oneof=Linux|Windows"`
 		Plan               map[string]interface{} `json:"image_plan,omitempty"`
-		StorageAccountID   string                 `json:"storage_account_id,omitempty"`
+		StorageAccountID   string                 `json:"storage_account_id,omitempty" validate:"required,id=Microsoft.Storage/storageAccounts"`
 		HostName           string                 `json:"host_name,omitempty"`
 		AdminUserName      string                 `json:"admin_user_name,omitempty"`
 		AdminPassword      string                 `json:"admin_password,omitempty"`
@@ -83,6 +78,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "instance",
+		ContentType:    "vnd.rightscale.instance+json",
+		Actions:        crudActions,
+		Setup:          SetupInstanceRoutes,
+		CreateParams:   createParams{},
+		ResponseParams: responseParams{},
+	})
+}
+
 // SetupInstanceRoutes declares routes for Instance resource
 func SetupInstanceRoutes(e *echo.Group) {
 	//get all instances from all groups
@@ -97,9 +103,9 @@ func SetupInstanceRoutes(e *echo.Group) {
 	group.Get("/:id", listOneInstance)
 	group.Get("/:id/instance_view", listOneInstanceView)
 	group.Post("", createInstance)
-	group.Delete("/:id", deleteInstance)
-
 	group.Put("/:id", updateInstance)
+	group.Patch("/:id", updateInstance)
+	group.Delete("/:id", deleteInstance)
 }
 
 func listInstances(c *echo.Context) error {
@@ -151,27 +157,18 @@ func (i *Instance) GetRequestParams(c *echo.Context) (interface{}, error) {
 	}
 	i.createParams.Group = c.Param("group_name")
 
-	//TODO: make a func for validating createParams and return all errors at once
-	if i.createParams.Name == "" {
-		return nil, eh.InvalidParamException("name")
-	}
-
-	if i.createParams.Location == "" {
-		return nil, eh.InvalidParamException("location")
-	}
-
-	if i.createParams.StorageAccountID == "" {
-		return nil, eh.InvalidParamException("storage_account_id")
-	}
-
-	if i.createParams.Size == "" {
-		return nil, eh.InvalidParamException("instance_type_id")
+	if err := validateParams(&i.createParams); err != nil {
+		return nil, err
 	}
 
 	i.requestParams.Name = i.createParams.Name
 	i.requestParams.Location = i.createParams.Location
 
-	osProfile, err := i.prepareStorageProfile()
+	env, err := GetEnvironment(c)
+	if err != nil {
+		return nil, err
+	}
+	osProfile, err := i.prepareStorageProfile(env.StorageSuffix)
 	if err != nil {
 		return nil, err
 	}
@@ -239,12 +236,24 @@ func (i *Instance) prepareOSProfile() map[string]interface{} {
 	return osProfile
 }
 
-func (i *Instance) prepareStorageProfile() (map[string]interface{}, error) {
-	if i.createParams.ImageID == "" {
-		return nil, eh.GenericException("ImageID should be passed.")
+// validate checks image ID which is URI of VHD for private images and ID of marketplace image otherwise
+func (p *createParams) validate() []eh.FieldError {
+	if p.ImageID == "" || p.PrivateImageOsType != "" {
+		return nil
+	}
+	imageID, err := rid.Parse(p.ImageID)
+	if err != nil || !imageID.IsType("Microsoft.Compute/locations/publishers/artifactTypes/offers/skus/versions") {
+		return []eh.FieldError{{Field: "image_id", Message: fmt.Sprintf("should be ID of marketplace image version, got '%s'", p.ImageID)}}
 	}
-	array := strings.Split(i.createParams.StorageAccountID, "/")
-	storageName := array[len(array)-1]
+	return nil
+}
+
+func (i *Instance) prepareStorageProfile(storageSuffix string) (map[string]interface{}, error) {
+	storageAccountID, err := rid.Parse(i.createParams.StorageAccountID)
+	if err != nil || !storageAccountID.IsType("Microsoft.Storage/storageAccounts") {
+		return nil, eh.InvalidParamException("storage_account_id")
+	}
+	storageName := storageAccountID.Name()
 	diskName := i.createParams.OSDiskName
 
 	storageProfile := map[string]interface{}{
@@ -253,19 +262,20 @@ func (i *Instance) prepareStorageProfile() (map[string]interface{}, error) {
 			"caching":      "ReadWrite",
 			"createOption": "FromImage",
 			"vhd": map[string]interface{}{
-				"uri": "https://" + storageName + ".blob.core.windows.net/vhds/" + diskName + ".vhd",
+				"uri": "https://" + storageName + ".blob." + storageSuffix + "/vhds/" + diskName + ".vhd",
 			},
 		},
 	}
 	if i.createParams.PrivateImageOsType == "" {
-		array := strings.Split(i.createParams.ImageID, "/")
-		if len(array) != 17 {
+		// ex: /Subscriptions/{subscription}/Providers/Microsoft.Compute/Locations/{location}/Publishers/{publisher}/ArtifactTypes/VMImage/Offers/{offer}/Skus/{sku}/Versions/{version}
+		imageID, err := rid.Parse(i.createParams.ImageID)
+		if err != nil || !imageID.IsType("Microsoft.Compute/locations/publishers/artifactTypes/offers/skus/versions") {
 			return nil, eh.InvalidParamException("image_id")
 		}
-		publisher := array[8]
-		offer := array[12]
-		sku := array[14]
-		version := array[16]
+		publisher := imageID.NameOf("publishers")
+		offer := imageID.NameOf("offers")
+		sku := imageID.NameOf("skus")
+		version := imageID.NameOf("versions")
 
 		storageProfile["imageReference"] = map[string]interface{}{
 			"publisher": publisher, //"Canonical",
@@ -286,6 +296,46 @@ func (i *Instance) prepareStorageProfile() (map[string]interface{}, error) {
 	return storageProfile, nil
 }
 
+// GetUpdateParams maps passed params onto the instance gotten from the cloud,
+// params in the form of Azure response (with 'properties') are sent as is since the instance used to be updated this way
+func (i *Instance) GetUpdateParams(c *echo.Context, instance map[string]interface{}) (interface{}, error) {
+	var body json.RawMessage
+	if err := c.Get("bodyDecoder").(*json.Decoder).Decode(&body); err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if _, ok := fields["properties"]; ok {
+		var params responseParams
+		if err := json.Unmarshal(body, &params); err != nil {
+			return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+		}
+		params.Href = ""
+		return params, nil
+	}
+	if err := json.Unmarshal(body, &i.createParams); err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if i.createParams.Size != "" {
+		setProperty(instance, i.createParams.Size, "properties", "hardwareProfile", "vmSize")
+	}
+	if i.createParams.NetworkInterfaceID != nil {
+		setProperty(instance, i.createParams.NetworkInterfaceID, "properties", "networkProfile", "networkInterfaces")
+	}
+	if i.createParams.AvailabilitySet != "" {
+		setProperty(instance, i.createParams.AvailabilitySet, "properties", "availabilitySet", "id")
+	}
+	if i.createParams.Disks != nil {
+		setProperty(instance, i.createParams.Disks, "properties", "storageProfile", "dataDisks")
+	}
+	if i.createParams.Plan != nil {
+		instance["plan"] = i.createParams.Plan
+	}
+	return instance, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (i *Instance) GetResponseParams() interface{} {
 	if i.action == "getInstanceView" {
@@ -297,17 +347,17 @@ func (i *Instance) GetResponseParams() interface{} {
 // GetPath returns full path to the sigle instance
 func (i *Instance) GetPath(subscription string) string {
 	if i.action == "getInstanceView" {
-		return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/InstanceView?api-version=%s", config.BaseURL, subscription, i.createParams.Group, virtualMachinesPath, i.createParams.Name, microsoftComputeApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/InstanceView?api-version=%s", config.BaseURL, subscription, i.createParams.Group, virtualMachinesPath, i.createParams.Name, config.APIVersion("Microsoft.Compute/virtualMachines"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, i.createParams.Group, virtualMachinesPath, i.createParams.Name, microsoftComputeApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, i.createParams.Group, virtualMachinesPath, i.createParams.Name, config.APIVersion("Microsoft.Compute/virtualMachines"))
 }
 
 // GetCollectionPath returns full path to the collection of instances
 func (i *Instance) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, virtualMachinesPath, microsoftComputeApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, virtualMachinesPath, config.APIVersion("Microsoft.Compute/virtualMachines"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, virtualMachinesPath, microsoftComputeApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, virtualMachinesPath, config.APIVersion("Microsoft.Compute/virtualMachines"))
 }
 
 // HandleResponse manage raw cloud response
@@ -328,7 +378,7 @@ func (i *Instance) HandleResponse(c *echo.Context, body []byte, actionName strin
 	}
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		i.responseParams.Href = href
 	}
 	return nil
@@ -341,57 +391,15 @@ func (i *Instance) GetContentType() string {
 
 // GetHref returns instance href
 func (i *Instance) GetHref(instanceID string) string {
-	array := strings.Split(instanceID, "/")
-	return fmt.Sprintf("resource_groups/%s/instances/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(instanceID, "instances")
 }
 
 func updateInstance(c *echo.Context) error {
-	client, err := GetAzureClient(c)
-	if err != nil {
-		return err
-	}
-	creds, err := GetClientCredentials(c)
-	if err != nil {
-		return err
-	}
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, c.Param("group_name"), virtualMachinesPath, c.Param("id"), microsoftComputeApiVersion)
-	var bodyParams responseParams
-	err = c.Get("bodyDecoder").(*json.Decoder).Decode(&bodyParams)
-	if err != nil {
-		return eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
-	}
-	by, err := json.Marshal(bodyParams)
-	if err != nil {
-		eh.GenericException(fmt.Sprintf("Error has occurred while marshaling data: %v", err))
-	}
-
-	var reader io.Reader
-	reader = bytes.NewBufferString(string(by))
-	req, err := http.NewRequest("PUT", path, reader)
-	req.Header.Add("Content-Type", config.MediaType)
-	req.Header.Add("Accept", config.MediaType)
-	req.Header.Add("User-Agent", config.UserAgent)
-	if err != nil {
-		return err
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return eh.GenericException(fmt.Sprintf("Error has occurred while updating instance: %v", err))
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
-	}
-
-	if resp.StatusCode >= 400 {
-		return eh.GenericException(fmt.Sprintf("Error has occurred while updating instance: %s", string(body)))
-	}
-
-	var response responseParams
-	if err := json.Unmarshal(body, &response); err != nil {
-		return eh.GenericException(fmt.Sprintf("got bad response from server: %s", string(body)))
+	instance := Instance{
+		createParams: createParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
 	}
-	return Render(c, 200, response, "application/json")
+	return Update(c, &instance)
 }
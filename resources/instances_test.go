@@ -298,46 +298,156 @@ var _ = Describe("instances", func() {
 	})
 
 	Describe("creating with wrong params", func() {
-		It("returns validation error about missing 'name'", func() {
+		fieldErrors := func() map[string]string {
+			Ω(response.Status).Should(Equal(422))
+			var body struct {
+				Errors []struct {
+					Field   string `json:"field"`
+					Message string `json:"message"`
+				} `json:"errors"`
+			}
+			Expect(json.Unmarshal([]byte(response.Body), &body)).To(Succeed())
+			errors := make(map[string]string)
+			for _, e := range body.Errors {
+				errors[e.Field] = e.Message
+			}
+			return errors
+		}
+
+		It("returns validation errors about all missing params at once", func() {
 			response, err = client.Post("/resource_groups/Group-1/instances", "{}")
 			Expect(err).NotTo(HaveOccurred())
-			Ω(response.Status).Should(Equal(400))
-			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'name' parameter.\"}"))
+			Ω(response.Body).Should(ContainSubstring("You have specified invalid parameters: name, location, instance_type_uid, image_id, storage_account_id."))
+			Ω(fieldErrors()).Should(Equal(map[string]string{
+				"name":               "is required",
+				"location":           "is required",
+				"instance_type_uid":  "is required",
+				"image_id":           "is required",
+				"storage_account_id": "is required",
+			}))
+			Ω(do.ReceivedRequests()).Should(HaveLen(0))
 		})
 
 		It("returns validation error about missing 'location'", func() {
 			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"instance_type_uid\": \"Standard_G1\", \"network_interface_id\": \"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkInterfaces/khrvi_ni\", \"image_id\": \"/Subscriptions/test/Providers/Microsoft.Compute/Locations/westus/Publishers/a10networks/ArtifactTypes/VMImage/Offers/a10-vthunder-adc/Skus/vthunder_100mbps/Versions/1.0.0\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/group-1/providers/Microsoft.Storage/storageAccounts/khrvitestgo1\"}")
 			Expect(err).NotTo(HaveOccurred())
-			Ω(response.Status).Should(Equal(400))
-			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'location' parameter.\"}"))
+			Ω(fieldErrors()).Should(Equal(map[string]string{"location": "is required"}))
 		})
 
-		It("returns validation error about missing 'image_id'", func() {
-			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"location\": \"westus\", \"instance_type_uid\": \"Standard_G1\", \"network_interface_id\": \"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkInterfaces/khrvi_ni\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/group-1/providers/Microsoft.Storage/storageAccounts/khrvitestgo1\"}")
+		It("returns validation error about wrong 'image_id'", func() {
+			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"location\": \"westus\", \"image_id\": \"/Subscriptions/test/Providers/Microsoft.Compute/Locations/westus/Publishers/a10networks/ArtifactTypes/VMImage/Offers/a10-vthunder-adc/Skus/vthunder_100mbps\", \"instance_type_uid\": \"Standard_G1\", \"network_interface_id\": \"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkInterfaces/khrvi_ni\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/group-1/providers/Microsoft.Storage/storageAccounts/khrvitestgo1\"}")
 			Expect(err).NotTo(HaveOccurred())
-			Ω(response.Status).Should(Equal(400))
-			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"ImageID should be passed.\"}"))
+			Ω(fieldErrors()).Should(HaveKeyWithValue("image_id", ContainSubstring("should be ID of marketplace image version")))
 		})
 
-		It("returns validation error about wrong 'image_id'", func() {
-			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"location\": \"westus\", \"image_id\": \"/Subscriptions/test/Providers/Microsoft.Compute/Locations/westus/Publishers/a10networks/ArtifactTypes/VMImage/Offers/a10-vthunder-adc/Skus/vthunder_100mbps\", \"instance_type_uid\": \"Standard_G1\", \"network_interface_id\": \"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkInterfaces/khrvi_ni\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/group-1/providers/Microsoft.Storage/storageAccounts/khrvitestgo1\"}")
+		It("returns validation errors about wrong 'storage_account_id' and 'private_image_os_platform'", func() {
+			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"location\": \"westus\", \"instance_type_uid\": \"Standard_G1\", \"image_id\": \"https://khrvitestgo1.blob.core.windows.net/vhds/image.vhd\", \"private_image_os_platform\": \"Solaris\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkInterfaces/khrvi_ni\"}")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(fieldErrors()).Should(Equal(map[string]string{
+				"private_image_os_platform": "should be one of: Linux, Windows",
+				"storage_account_id":        "should be ID of Microsoft.Storage/storageAccounts resource, got '/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkInterfaces/khrvi_ni'",
+			}))
+		})
+	})
+
+	Describe("dry run", func() {
+		var dryRun struct {
+			Method     string                 `json:"method"`
+			URL        string                 `json:"url"`
+			APIVersion string                 `json:"api_version"`
+			Body       map[string]interface{} `json:"body"`
+		}
+
+		It("returns request of creation with secrets masked without sending it", func() {
+			response, err = client.Post("/resource_groups/Group-1/instances?dry_run=true", "{\"name\": \"khrvi\", \"user_data\":\"test_user_data\", \"admin_password\": \"Secret1234@\", \"instance_type_uid\": \"Standard_G1\", \"location\": \"westus\", \"image_id\": \"https://khrvitesttest1.blob.core.windows.net/vhds/os-khrvi-rs.vhd\", \"private_image_os_platform\": \"Linux\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/group-1/providers/Microsoft.Storage/storageAccounts/khrvitestgo1\", \"os_disk_name\": \"os-khrvi1-rs\"}")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(0))
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Headers.Get("Content-Type")).Should(Equal("vnd.rightscale.dry_run+json"))
+			Expect(json.Unmarshal([]byte(response.Body), &dryRun)).To(Succeed())
+			apiVersion := config.APIVersion("Microsoft.Compute/virtualMachines")
+			Ω(dryRun.Method).Should(Equal("PUT"))
+			Ω(dryRun.URL).Should(Equal(do.URL() + "/subscriptions/" + subscriptionID + "/resourceGroups/Group-1/" + virtualMachinesPath + "/khrvi?api-version=" + apiVersion))
+			Ω(dryRun.APIVersion).Should(Equal(apiVersion))
+			Ω(dryRun.Body["name"]).Should(Equal("khrvi"))
+			Ω(dryRun.Body["properties"]).Should(HaveKeyWithValue("osProfile", map[string]interface{}{
+				"adminPassword": "REDACTED",
+				"adminUsername": "rsadministrator",
+				"computerName":  "khrvi",
+				"customData":    "REDACTED",
+			}))
+			Ω(dryRun.Body["properties"]).Should(HaveKeyWithValue("hardwareProfile", map[string]interface{}{"vmSize": "Standard_G1"}))
+		})
+
+		It("validates params", func() {
+			response, err = client.Post("/resource_groups/Group-1/instances?dry_run=true", "{\"name\": \"khrvi\"}")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(0))
+			Ω(response.Status).Should(Equal(422))
+		})
+
+		It("returns request of update without reading the resource", func() {
+			response, err = client.Put("/resource_groups/Group-1/instances/khrvi?dry_run=true", "{\"instance_type_uid\": \"Standard_G2\"}")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(0))
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`{
+				"method": "PUT",
+				"url": "` + do.URL() + "/subscriptions/" + subscriptionID + "/resourceGroups/Group-1/" + virtualMachinesPath + "/khrvi?api-version=" + config.APIVersion("Microsoft.Compute/virtualMachines") + `",
+				"api_version": "` + config.APIVersion("Microsoft.Compute/virtualMachines") + `",
+				"body": {"properties": {"hardwareProfile": {"vmSize": "Standard_G2"}}},
+				"warnings": ["the resource is not read from Azure in dry run, so the body contains passed params only"]
+			}`))
+		})
+
+		It("returns request of deletion requested via header", func() {
+			client.Headers = http.Header{DryRunHeader: []string{"true"}}
+			response, err = client.Delete("/resource_groups/Group-1/instances/khrvi")
 			Expect(err).NotTo(HaveOccurred())
-			Ω(response.Status).Should(Equal(400))
-			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'image_id' parameter.\"}"))
+			Ω(do.ReceivedRequests()).Should(HaveLen(0))
+			Ω(response.Status).Should(Equal(200))
+			Expect(json.Unmarshal([]byte(response.Body), &dryRun)).To(Succeed())
+			Ω(dryRun.Method).Should(Equal("DELETE"))
+			Ω(dryRun.URL).Should(ContainSubstring("/resourceGroups/Group-1/" + virtualMachinesPath + "/khrvi?"))
 		})
+	})
+
+	Describe("updating", func() {
+		const getInstanceResponse = `{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Compute/virtualMachines/khrvi","location":"westus","name":"khrvi","properties":{"hardwareProfile":{"vmSize":"Standard_G1"}},"type":"Microsoft.Compute/virtualMachines"}`
 
-		It("returns validation error about missing 'storage_account_id'", func() {
-			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"location\": \"westus\", \"instance_type_uid\": \"Standard_G1\", \"image_id\": \"/Subscriptions/test/Providers/Microsoft.Compute/Locations/westus/Publishers/a10networks/ArtifactTypes/VMImage/Offers/a10-vthunder-adc/Skus/vthunder_100mbps/Versions/1.0.0\"}")
+		It("applies create params to the instance gotten from the cloud", func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualMachinesPath+"/khrvi"),
+					ghttp.RespondWith(http.StatusOK, getInstanceResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualMachinesPath+"/khrvi"),
+					ghttp.VerifyJSON(`{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Compute/virtualMachines/khrvi","location":"westus","name":"khrvi","properties":{"hardwareProfile":{"vmSize":"Standard_G2"}},"type":"Microsoft.Compute/virtualMachines"}`),
+					ghttp.RespondWith(http.StatusOK, getInstanceResponse),
+				),
+			)
+			response, err = client.Put("/resource_groups/Group-1/instances/khrvi", `{"instance_type_uid": "Standard_G2"}`)
 			Expect(err).NotTo(HaveOccurred())
-			Ω(response.Status).Should(Equal(400))
-			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'storage_account_id' parameter.\"}"))
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(ContainSubstring(`"href":"resource_groups/Group-1/instances/khrvi"`))
 		})
 
-		It("returns validation error about missing 'instance_type_id'", func() {
-			response, err = client.Post("/resource_groups/Group-1/instances", "{\"name\": \"khrvi\", \"location\": \"westus\", \"image_id\": \"/Subscriptions/test/Providers/Microsoft.Compute/Locations/westus/Publishers/a10networks/ArtifactTypes/VMImage/Offers/a10-vthunder-adc/Skus/vthunder_100mbps/Versions/1.0.0\", \"storage_account_id\": \"/subscriptions/test/resourceGroups/group-1/providers/Microsoft.Storage/storageAccounts/khrvitestgo1\"}")
+		It("sends params in the form of Azure response as is", func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualMachinesPath+"/khrvi"),
+					ghttp.RespondWith(http.StatusOK, getInstanceResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualMachinesPath+"/khrvi"),
+					ghttp.VerifyJSON(`{"name":"khrvi","location":"westus","properties":{"hardwareProfile":{"vmSize":"Standard_G3"}}}`),
+					ghttp.RespondWith(http.StatusOK, getInstanceResponse),
+				),
+			)
+			response, err = client.Put("/resource_groups/Group-1/instances/khrvi", `{"name":"khrvi","location":"westus","properties":{"hardwareProfile":{"vmSize":"Standard_G3"}},"href":"resource_groups/Group-1/instances/khrvi"}`)
 			Expect(err).NotTo(HaveOccurred())
-			Ω(response.Status).Should(Equal(400))
-			Ω(response.Body).Should(Equal("{\"Code\":400,\"Message\":\"You have specified an invalid 'instance_type_id' parameter.\"}"))
+			Ω(response.Status).Should(Equal(200))
 		})
 	})
 
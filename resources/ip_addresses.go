@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -30,11 +29,11 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	ipAddressCreateParams struct {
-		Name             string `json:"name,omitempty"`
-		Location         string `json:"location,omitempty"`
+		Name             string `json:"name,omitempty" validate:"required"`
+		Location         string `json:"location,omitempty" validate:"required"`
 		Group            string `json:"group_name,omitempty"`
-		AllocationMethod string `json:"allocation_method,omitempty"` //*Mandatory: Defines whether the IP address is stable or dynamic. Options are Static or Dynamic
-		IdleTimeout      int    `json:"timeout,omitempty"`           //Specifies the timeout for the TCP idle connection. The value can be set between 4 and 30 minutes
+		AllocationMethod string `json:"allocation_method,omitempty" validate:"required,oneof=Static|Dynamic"` //*Mandatory: Defines whether the IP address is stable or dynamic. Options are Static or Dynamic
+		IdleTimeout      int    `json:"timeout,omitempty" validate:"range=4..30"`                             //Specifies the timeout for the TCP idle connection. The value can be set between 4 and 30 minutes
 	}
 	// IPAddress is base struct for Azure Public IP Address resource to store input create params,
 	// request create params and response params gotten from cloud.
@@ -45,6 +44,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "ip_address",
+		ContentType:    "vnd.rightscale.ip_address+json",
+		Actions:        crudActions,
+		Setup:          SetupIPAddressesRoutes,
+		CreateParams:   ipAddressCreateParams{},
+		ResponseParams: ipAddressResponseParams{},
+	})
+}
+
 // SetupIPAddressesRoutes declares routes for IPAddress resource
 func SetupIPAddressesRoutes(e *echo.Group) {
 	e.Get("/ip_addresses", listIPAddresses)
@@ -57,6 +67,8 @@ func SetupIPAddressesRoutes(e *echo.Group) {
 	group.Get("", listIPAddresses)
 	group.Get("/:id", listOneIPAddress)
 	group.Post("", createIPAddress)
+	group.Put("/:id", updateIPAddress)
+	group.Patch("/:id", updateIPAddress)
 	group.Delete("/:id", deleteIPAddress)
 }
 
@@ -79,6 +91,16 @@ func createIPAddress(c *echo.Context) error {
 	return Create(c, ipAddress)
 }
 
+func updateIPAddress(c *echo.Context) error {
+	ipAddress := IPAddress{
+		createParams: ipAddressCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &ipAddress)
+}
+
 func deleteIPAddress(c *echo.Context) error {
 	ipAddress := IPAddress{
 		createParams: ipAddressCreateParams{
@@ -96,6 +118,11 @@ func (ip *IPAddress) GetRequestParams(c *echo.Context) (interface{}, error) {
 		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
 	}
 	ip.createParams.Group = c.Param("group_name")
+
+	if err := validateParams(&ip.createParams); err != nil {
+		return nil, err
+	}
+
 	ip.requestParams.Location = ip.createParams.Location
 	ip.requestParams.Properties = map[string]interface{}{
 		"publicIPAllocationMethod": ip.createParams.AllocationMethod,
@@ -108,6 +135,21 @@ func (ip *IPAddress) GetRequestParams(c *echo.Context) (interface{}, error) {
 	return ip.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the ip address gotten from the cloud
+func (ip *IPAddress) GetUpdateParams(c *echo.Context, ipAddress map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&ip.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if ip.createParams.AllocationMethod != "" {
+		setProperty(ipAddress, ip.createParams.AllocationMethod, "properties", "publicIPAllocationMethod")
+	}
+	if ip.createParams.IdleTimeout != 0 {
+		setProperty(ipAddress, ip.createParams.IdleTimeout, "properties", "idleTimeoutInMinutes")
+	}
+	return ipAddress, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (ip *IPAddress) GetResponseParams() interface{} {
 	return ip.responseParams
@@ -115,15 +157,15 @@ func (ip *IPAddress) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle ip address
 func (ip *IPAddress) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, ip.createParams.Group, ipAddressPath, ip.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, ip.createParams.Group, ipAddressPath, ip.createParams.Name, config.APIVersion("Microsoft.Network/publicIPAddresses"))
 }
 
 // GetCollectionPath returns full path to the collection of ip addresses
 func (ip *IPAddress) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, ipAddressPath, microsoftNetworkApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, ipAddressPath, config.APIVersion("Microsoft.Network/publicIPAddresses"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, ipAddressPath, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, ipAddressPath, config.APIVersion("Microsoft.Network/publicIPAddresses"))
 }
 
 // HandleResponse manage raw cloud response
@@ -134,7 +176,7 @@ func (ip *IPAddress) HandleResponse(c *echo.Context, body []byte, actionName str
 	href := ip.GetHref(ip.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		ip.responseParams.Href = href
 	}
 	return nil
@@ -147,6 +189,5 @@ func (ip *IPAddress) GetContentType() string {
 
 // GetHref returns ip address href
 func (ip *IPAddress) GetHref(ipAddressID string) string {
-	array := strings.Split(ipAddressID, "/")
-	return fmt.Sprintf("resource_groups/%s/ip_addresses/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(ipAddressID, "ip_addresses")
 }
@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -31,12 +30,12 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	virtualNetworkGatewayCreateParams struct {
-		Name        string `json:"name,omitempty"`
-		Location    string `json:"location,omitempty"`
+		Name        string `json:"name,omitempty" validate:"required"`
+		Location    string `json:"location,omitempty" validate:"required"`
 		Group       string `json:"group_name,omitempty"`
-		GatewayType string `json:"gateway_type,omitempty"`
-		IPAddressId string `json:"ip_address_id,omitempty"`
-		SubnetId    string `json:"subnet_id,omitempty"`
+		GatewayType string `json:"gateway_type,omitempty" validate:"required,oneof=Vpn|ExpressRoute"`
+		IPAddressId string `json:"ip_address_id,omitempty" validate:"required,id=Microsoft.Network/publicIPAddresses"`
+		SubnetId    string `json:"subnet_id,omitempty" validate:"required,id=Microsoft.Network/virtualNetworks/subnets"`
 	}
 	// VirtualNetworkGateway is base struct for VirtualNetworkGateway resource to store input create params,
 	// request create params and response params gotten from cloud.
@@ -47,6 +46,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "virtual_network_gateway",
+		ContentType:    "vnd.rightscale.virtual_network_gateway+json",
+		Actions:        crudActions,
+		Setup:          SetupVirtualNetworkGatewayRoutes,
+		CreateParams:   virtualNetworkGatewayCreateParams{},
+		ResponseParams: virtualNetworkGatewayResponseParams{},
+	})
+}
+
 // SetupNetworkRoutes declares routes for VirtualNetworkGateway resource
 func SetupVirtualNetworkGatewayRoutes(e *echo.Group) {
 	e.Get("/virtual_network_gateways", listVirtualNetworkGateways)
@@ -56,6 +66,8 @@ func SetupVirtualNetworkGatewayRoutes(e *echo.Group) {
 	group.Get("", listVirtualNetworkGateways)
 	group.Get("/:id", listOneVirtualNetworkGateway)
 	group.Post("", createVirtualNetworkGateway)
+	group.Put("/:id", updateVirtualNetworkGateway)
+	group.Patch("/:id", updateVirtualNetworkGateway)
 	group.Delete("/:id", deleteVirtualNetworkGateway)
 }
 
@@ -79,6 +91,16 @@ func createVirtualNetworkGateway(c *echo.Context) error {
 	return Create(c, virtualNetworkGateway)
 }
 
+func updateVirtualNetworkGateway(c *echo.Context) error {
+	virtualNetworkGateway := VirtualNetworkGateway{
+		createParams: virtualNetworkGatewayCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &virtualNetworkGateway)
+}
+
 func deleteVirtualNetworkGateway(c *echo.Context) error {
 	virtualNetworkGateway := VirtualNetworkGateway{
 		createParams: virtualNetworkGatewayCreateParams{
@@ -97,7 +119,10 @@ func (vng *VirtualNetworkGateway) GetRequestParams(c *echo.Context) (interface{}
 	}
 	vng.createParams.Group = c.Param("group_name")
 
-	//TODO: add validation
+	if err := validateParams(&vng.createParams); err != nil {
+		return nil, err
+	}
+
 	vng.requestParams.Name = vng.createParams.Name
 	vng.requestParams.Location = vng.createParams.Location
 
@@ -115,6 +140,43 @@ func (vng *VirtualNetworkGateway) GetRequestParams(c *echo.Context) (interface{}
 	return vng.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the virtualNetworkGateway gotten from the cloud
+func (vng *VirtualNetworkGateway) GetUpdateParams(c *echo.Context, virtualNetworkGateway map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&vng.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if vng.createParams.GatewayType != "" {
+		setProperty(virtualNetworkGateway, vng.createParams.GatewayType, "properties", "gatewayType")
+	}
+	// IP address and subnet belong to the IP configuration, it is updated in place to keep its name and other properties
+	if vng.createParams.IPAddressId != "" {
+		setProperty(firstIPConfiguration(virtualNetworkGateway), vng.createParams.IPAddressId, "properties", "publicIPAddress", "id")
+	}
+	if vng.createParams.SubnetId != "" {
+		setProperty(firstIPConfiguration(virtualNetworkGateway), vng.createParams.SubnetId, "properties", "subnet", "id")
+	}
+	return virtualNetworkGateway, nil
+}
+
+// firstIPConfiguration returns the first IP configuration of the gateway, it is added if the gateway has none
+func firstIPConfiguration(virtualNetworkGateway map[string]interface{}) map[string]interface{} {
+	properties, ok := virtualNetworkGateway["properties"].(map[string]interface{})
+	if !ok {
+		properties = make(map[string]interface{})
+		virtualNetworkGateway["properties"] = properties
+	}
+	ipConfigurations, _ := properties["ipConfigurations"].([]interface{})
+	if len(ipConfigurations) > 0 {
+		if ipConfiguration, ok := ipConfigurations[0].(map[string]interface{}); ok {
+			return ipConfiguration
+		}
+	}
+	ipConfiguration := map[string]interface{}{"name": "default"}
+	properties["ipConfigurations"] = []interface{}{ipConfiguration}
+	return ipConfiguration
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (vng *VirtualNetworkGateway) GetResponseParams() interface{} {
 	return vng.responseParams
@@ -122,15 +184,15 @@ func (vng *VirtualNetworkGateway) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle virtualNetworkGateway
 func (vng *VirtualNetworkGateway) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, vng.createParams.Group, virtualNetworkGatewayPath, vng.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, vng.createParams.Group, virtualNetworkGatewayPath, vng.createParams.Name, config.APIVersion("Microsoft.Network/virtualNetworkGateways"))
 }
 
 // GetCollectionPath returns full path to the collection of virtualNetworkGateway
 func (vng *VirtualNetworkGateway) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, virtualNetworkGatewayPath, microsoftNetworkApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, virtualNetworkGatewayPath, config.APIVersion("Microsoft.Network/virtualNetworkGateways"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, virtualNetworkGatewayPath, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, virtualNetworkGatewayPath, config.APIVersion("Microsoft.Network/virtualNetworkGateways"))
 }
 
 // HandleResponse manage raw cloud response
@@ -141,7 +203,7 @@ func (vng *VirtualNetworkGateway) HandleResponse(c *echo.Context, body []byte, a
 	href := vng.GetHref(vng.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		vng.responseParams.Href = href
 	}
 	return nil
@@ -154,6 +216,5 @@ func (vng *VirtualNetworkGateway) GetContentType() string {
 
 // GetHref returns virtualNetworkGateway href
 func (vng *VirtualNetworkGateway) GetHref(virtualNetworkGatewayID string) string {
-	array := strings.Split(virtualNetworkGatewayID, "/")
-	return fmt.Sprintf("resource_groups/%s/virtualNetworkGateways/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(virtualNetworkGatewayID, "virtual_network_gateways")
 }
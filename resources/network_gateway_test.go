@@ -0,0 +1,77 @@
+package resources
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+const getVirtualNetworkGatewayResponse = `{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworkGateways/gw1","name":"gw1","location":"westus","etag":"W/\"5a2f7c1e\"","properties":{"gatewayType":"Vpn","ipConfigurations":[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworkGateways/gw1/ipConfigurations/gwipconfig","name":"gwipconfig","properties":{"privateIPAllocationMethod":"Dynamic","publicIPAddress":{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/publicIPAddresses/ip1"},"subnet":{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1/subnets/GatewaySubnet"}}}],"provisioningState":"Succeeded"}}`
+
+var _ = Describe("virtual network gateways", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("updating", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualNetworkGatewayPath+"/gw1"),
+					ghttp.RespondWith(http.StatusOK, getVirtualNetworkGatewayResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualNetworkGatewayPath+"/gw1"),
+					ghttp.VerifyJSON(`{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworkGateways/gw1","name":"gw1","location":"westus","etag":"W/\"5a2f7c1e\"","properties":{"gatewayType":"Vpn","ipConfigurations":[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworkGateways/gw1/ipConfigurations/gwipconfig","name":"gwipconfig","properties":{"privateIPAllocationMethod":"Dynamic","publicIPAddress":{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/publicIPAddresses/ip2"},"subnet":{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1/subnets/GatewaySubnet"}}}],"provisioningState":"Succeeded"}}`),
+					ghttp.RespondWith(http.StatusOK, getVirtualNetworkGatewayResponse),
+				),
+			)
+			response, err = client.Put("/resource_groups/Group-1/virtual_network_gateways/gw1", `{"ip_address_id": "/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/publicIPAddresses/ip2"}`)
+		})
+
+		It("updates IP address of the IP configuration in place", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+
+	Describe("updating gateway without IP configurations", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualNetworkGatewayPath+"/gw1"),
+					ghttp.RespondWith(http.StatusOK, `{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworkGateways/gw1","name":"gw1","location":"westus","properties":{"gatewayType":"Vpn"}}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+virtualNetworkGatewayPath+"/gw1"),
+					ghttp.VerifyJSON(`{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworkGateways/gw1","name":"gw1","location":"westus","properties":{"gatewayType":"Vpn","ipConfigurations":[{"name":"default","properties":{"publicIPAddress":{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/publicIPAddresses/ip2"},"subnet":{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1/subnets/GatewaySubnet"}}}]}}`),
+					ghttp.RespondWith(http.StatusOK, getVirtualNetworkGatewayResponse),
+				),
+			)
+			response, err = client.Put("/resource_groups/Group-1/virtual_network_gateways/gw1", `{"ip_address_id": "/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/publicIPAddresses/ip2", "subnet_id": "/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/virtualNetworks/net1/subnets/GatewaySubnet"}`)
+		})
+
+		It("adds the IP configuration", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+})
@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -30,14 +29,14 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	networkInterfaceCreateParams struct {
-		Name                   string   `json:"name,omitempty"`
-		Location               string   `json:"location,omitempty"`
-		SubnetID               string   `json:"subnet_id,omitempty"`
+		Name                   string   `json:"name,omitempty" validate:"required"`
+		Location               string   `json:"location,omitempty" validate:"required"`
+		SubnetID               string   `json:"subnet_id,omitempty" validate:"required,id=Microsoft.Network/virtualNetworks/subnets"`
 		Group                  string   `json:"group_name,omitempty"`
-		DNSServers             []string `json:"dns_servers,omitempty"`
-		NetworkSecurityGroupID string   `json:"network_security_group_id,omitempty"`
-		PrivateIPAddress       string   `json:"private_ip_address,omitempty"`   // Static IP Address
-		PublicIPAddressID      string   `json:"public_ip_address_id,omitempty"` // Reference to a Public IP Address to associate with this NIC
+		DNSServers             []string `json:"dns_servers,omitempty" validate:"ip"`
+		NetworkSecurityGroupID string   `json:"network_security_group_id,omitempty" validate:"id=Microsoft.Network/networkSecurityGroups"`
+		PrivateIPAddress       string   `json:"private_ip_address,omitempty" validate:"ip"`                                       // Static IP Address
+		PublicIPAddressID      string   `json:"public_ip_address_id,omitempty" validate:"id=Microsoft.Network/publicIPAddresses"` // Reference to a Public IP Address to associate with this NIC
 	}
 	// NetworkInterface is base struct for Azure Network Interface resource to store input create params,
 	// request create params and response params gotten from cloud.
@@ -48,6 +47,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "network_interface",
+		ContentType:    "vnd.rightscale.network_interface+json",
+		Actions:        crudActions,
+		Setup:          SetupNetworkInterfacesRoutes,
+		CreateParams:   networkInterfaceCreateParams{},
+		ResponseParams: networkInterfaceResponseParams{},
+	})
+}
+
 // SetupNetworkInterfacesRoutes declares routes for NetworkInterface resource
 func SetupNetworkInterfacesRoutes(e *echo.Group) {
 	e.Get("/network_interfaces", listNetworkInterfaces)
@@ -60,6 +70,8 @@ func SetupNetworkInterfacesRoutes(e *echo.Group) {
 	group.Get("", listNetworkInterfaces)
 	group.Get("/:id", listOneNetworkInterface)
 	group.Post("", createNetworkInterface)
+	group.Put("/:id", updateNetworkInterface)
+	group.Patch("/:id", updateNetworkInterface)
 	group.Delete("/:id", deleteNetworkInterface)
 }
 
@@ -82,6 +94,16 @@ func createNetworkInterface(c *echo.Context) error {
 	return Create(c, networkInterface)
 }
 
+func updateNetworkInterface(c *echo.Context) error {
+	networkInterface := NetworkInterface{
+		createParams: networkInterfaceCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &networkInterface)
+}
+
 func deleteNetworkInterface(c *echo.Context) error {
 	networkInterface := NetworkInterface{
 		createParams: networkInterfaceCreateParams{
@@ -100,6 +122,10 @@ func (ni *NetworkInterface) GetRequestParams(c *echo.Context) (interface{}, erro
 	}
 	ni.createParams.Group = c.Param("group_name")
 
+	if err := validateParams(&ni.createParams); err != nil {
+		return nil, err
+	}
+
 	ni.requestParams.Location = ni.createParams.Location
 	configProperties := map[string]interface{}{
 		"subnet": map[string]interface{}{
@@ -141,6 +167,48 @@ func (ni *NetworkInterface) GetRequestParams(c *echo.Context) (interface{}, erro
 	return ni.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the network interface gotten from the cloud
+func (ni *NetworkInterface) GetUpdateParams(c *echo.Context, networkInterface map[string]interface{}) (interface{}, error) {
+	name := ni.createParams.Name
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&ni.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if ni.createParams.NetworkSecurityGroupID != "" {
+		setProperty(networkInterface, ni.createParams.NetworkSecurityGroupID, "properties", "networkSecurityGroup", "id")
+	}
+	if ni.createParams.DNSServers != nil {
+		setProperty(networkInterface, ni.createParams.DNSServers, "properties", "dnsSettings", "dnsServers")
+	}
+	if ni.createParams.SubnetID == "" && ni.createParams.PrivateIPAddress == "" && ni.createParams.PublicIPAddressID == "" {
+		return networkInterface, nil
+	}
+
+	// only the primary ip configuration could be updated
+	var ipConfiguration map[string]interface{}
+	properties, _ := networkInterface["properties"].(map[string]interface{})
+	if properties != nil {
+		if ipConfigurations, ok := properties["ipConfigurations"].([]interface{}); ok && len(ipConfigurations) > 0 {
+			ipConfiguration, _ = ipConfigurations[0].(map[string]interface{})
+		}
+	}
+	if ipConfiguration == nil {
+		ipConfiguration = map[string]interface{}{"name": name + "_ip"}
+		setProperty(networkInterface, []interface{}{ipConfiguration}, "properties", "ipConfigurations")
+	}
+	if ni.createParams.SubnetID != "" {
+		setProperty(ipConfiguration, ni.createParams.SubnetID, "properties", "subnet", "id")
+	}
+	if ni.createParams.PrivateIPAddress != "" {
+		setProperty(ipConfiguration, ni.createParams.PrivateIPAddress, "properties", "privateIPAddress")
+		setProperty(ipConfiguration, "Static", "properties", "privateIPAllocationMethod")
+	}
+	if ni.createParams.PublicIPAddressID != "" {
+		setProperty(ipConfiguration, ni.createParams.PublicIPAddressID, "properties", "publicIPAddress", "id")
+	}
+	return networkInterface, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (ni *NetworkInterface) GetResponseParams() interface{} {
 	return ni.responseParams
@@ -148,15 +216,15 @@ func (ni *NetworkInterface) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle network interface
 func (ni *NetworkInterface) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, ni.createParams.Group, networkInterfacePath, ni.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, ni.createParams.Group, networkInterfacePath, ni.createParams.Name, config.APIVersion("Microsoft.Network/networkInterfaces"))
 }
 
 // GetCollectionPath returns full path to the collection of network interfaces
 func (ni *NetworkInterface) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, networkInterfacePath, microsoftNetworkApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, networkInterfacePath, config.APIVersion("Microsoft.Network/networkInterfaces"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, networkInterfacePath, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, networkInterfacePath, config.APIVersion("Microsoft.Network/networkInterfaces"))
 }
 
 // HandleResponse manage raw cloud response
@@ -167,7 +235,7 @@ func (ni *NetworkInterface) HandleResponse(c *echo.Context, body []byte, actionN
 	href := ni.GetHref(ni.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		ni.responseParams.Href = href
 	}
 	return nil
@@ -180,6 +248,5 @@ func (ni *NetworkInterface) GetContentType() string {
 
 // GetHref returns network interface href
 func (ni *NetworkInterface) GetHref(networkInterfaceID string) string {
-	array := strings.Split(networkInterfaceID, "/")
-	return fmt.Sprintf("resource_groups/%s/network_interfaces/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(networkInterfaceID, "network_interfaces")
 }
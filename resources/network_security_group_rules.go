@@ -3,11 +3,11 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	rid "github.com/rightscale/azure_arm_proxy/resource_id"
 )
 
 type (
@@ -23,20 +23,20 @@ type (
 		Properties map[string]interface{} `json:"properties"`
 	}
 	networkSecurityGroupRuleCreateParams struct {
-		Name            string `json:"name,omitempty"`
+		Name            string `json:"name,omitempty" validate:"required"`
 		Group           string `json:"group_name,omitempty"`
 		SecurityGroupID string `json:"security_group_id,omitempty"`
 		Type            string
 
-		Description              string `json:"description,omitempty"`                //A description for this rule. Restricted to 140 characters.
-		Protocol                 string `json:"protocol,omitempty"`                   // *Mandatory. Network protocol this rule applies to. Can be Tcp, Udp or * to match both.
-		SourcePortRange          string `json:"source_port_range,omitempty"`          // *Mandatory. Source Port or Range. Integer or range between 0 and 65535 or * to match any.
-		DestinationPortRange     string `json:"destination_port_range,omitempty"`     // *Mandatory. Destination Port or Range. Integer or range between 0 and 65535 or * to match any.
-		SourceAddressPrefix      string `json:"source_address_prefix,omitempty"`      // *Mandatory. CIDR or source IP range or * to match any IP. Tags such as ‘VirtualNetwork’, ‘AzureLoadBalancer’ and ‘Internet’ can also be used.
-		DestinationAddressPrefix string `json:"destination_address_prefix,omitempty"` // *Mandatory. CIDR or destination IP range or * to match any IP. Tags such as ‘VirtualNetwork’, ‘AzureLoadBalancer’ and ‘Internet’ can also be used.
-		Access                   string `json:"access,omitempty"`                     // *Mandatory. Specifies whether network traffic is allowed or denied. Possible values are “Allow” and “Deny”.
-		Priority                 int    `json:"priority,omitempty"`                   // *Mandatory. Specifies the priority of the rule. The value can be between 100 and 4096. The priority number must be unique for each rule in the collection. The lower the priority number, the higher the priority of the rule.
-		Direction                string `json:"direction,omitempty"`                  // *Mandatory. The direction specifies if rule will be evaluated on incoming or outgoing traffic. Possible values are “Inbound” and “Outbound”.
+		Description              string `json:"description,omitempty" validate:"max_len=140"`                    //A description for this rule. Restricted to 140 characters.
+		Protocol                 string `json:"protocol,omitempty" validate:"required,oneof=Tcp|Udp|*"`          // *Mandatory. Network protocol this rule applies to. Can be Tcp, Udp or * to match both.
+		SourcePortRange          string `json:"source_port_range,omitempty" validate:"required,port_range"`      // *Mandatory. Source Port or Range. Integer or range between 0 and 65535 or * to match any.
+		DestinationPortRange     string `json:"destination_port_range,omitempty" validate:"required,port_range"` // *Mandatory. Destination Port or Range. Integer or range between 0 and 65535 or * to match any.
+		SourceAddressPrefix      string `json:"source_address_prefix,omitempty" validate:"required"`             // *Mandatory. CIDR or source IP range or * to match any IP. Tags such as ‘VirtualNetwork’, ‘AzureLoadBalancer’ and ‘Internet’ can also be used.
+		DestinationAddressPrefix string `json:"destination_address_prefix,omitempty" validate:"required"`        // *Mandatory. CIDR or destination IP range or * to match any IP. Tags such as ‘VirtualNetwork’, ‘AzureLoadBalancer’ and ‘Internet’ can also be used.
+		Access                   string `json:"access,omitempty" validate:"required,oneof=Allow|Deny"`           // *Mandatory. Specifies whether network traffic is allowed or denied. Possible values are “Allow” and “Deny”.
+		Priority                 int    `json:"priority,omitempty" validate:"required,range=100..4096"`          // *Mandatory. Specifies the priority of the rule. The value can be between 100 and 4096. The priority number must be unique for each rule in the collection. The lower the priority number, the higher the priority of the rule.
+		Direction                string `json:"direction,omitempty" validate:"required,oneof=Inbound|Outbound"`  // *Mandatory. The direction specifies if rule will be evaluated on incoming or outgoing traffic. Possible values are “Inbound” and “Outbound”.
 	}
 	// NetworkSecurityGroupRule is base struct for Azure Network Security Group Rule resource to store input create params,
 	// request create params and response params gotten from cloud.
@@ -47,6 +47,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "network_security_group_rule",
+		ContentType:    "vnd.rightscale.network_security_group_rule+json",
+		Actions:        crudActions,
+		Setup:          SetupNetworkSecurityGroupRuleRoutes,
+		CreateParams:   networkSecurityGroupRuleCreateParams{},
+		ResponseParams: networkSecurityGroupRuleResponseParams{},
+	})
+}
+
 // SetupNetworkSecurityGroupRuleRoutes declares routes for NetworkSecurityGroupRule resource
 func SetupNetworkSecurityGroupRuleRoutes(e *echo.Group) {
 	e.Get("/network_security_group_rules", listAllNetworkSecurityGroupRules)
@@ -56,6 +67,8 @@ func SetupNetworkSecurityGroupRuleRoutes(e *echo.Group) {
 	group.Get("", listNetworkSecurityGroupRules)
 	group.Get("/:id", listOneNetworkSecurityGroupRule)
 	group.Post("", createNetworkSecurityGroupRule)
+	group.Put("/:id", updateNetworkSecurityGroupRule)
+	group.Patch("/:id", updateNetworkSecurityGroupRule)
 	group.Delete("/:id", deleteNetworkSecurityGroupRule)
 
 	groupD := e.Group("/resource_groups/:group_name/network_security_groups/:security_group_name/default_network_security_group_rules")
@@ -64,31 +77,33 @@ func SetupNetworkSecurityGroupRuleRoutes(e *echo.Group) {
 }
 
 func listAllNetworkSecurityGroupRules(c *echo.Context) error {
-	rules := make([]map[string]interface{}, 0)
 	creds, err := GetClientCredentials(c)
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, networkSecurityGroupPath, microsoftNetworkApiVersion)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, networkSecurityGroupPath, config.APIVersion("Microsoft.Network/networkSecurityGroups"))
 	groups, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
+	listings := make([]childListing, 0, len(groups))
 	for _, group := range groups {
-		array := strings.Split(group["id"].(string), "/")
-		groupName := array[len(array)-5]
-		groupID := group["name"].(string)
-		path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/securityRules?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkSecurityGroupPath, groupID, microsoftNetworkApiVersion)
-		resp, err := GetResources(c, path)
+		id, err := rid.Parse(group["id"].(string))
 		if err != nil {
-			return err
+			return eh.GenericException(fmt.Sprintf("got bad response from server: %v", err))
 		}
-		for _, rule := range resp {
-			rule["href"] = fmt.Sprintf("resource_groups/%s/network_security_groups/%s/network_security_group_rules/%s", groupName, groupID, rule["name"])
-		}
-		rules = append(rules, resp...)
+		groupName := id.ResourceGroup
+		groupID := group["name"].(string)
+		listings = append(listings, childListing{
+			Parent: group["id"].(string),
+			Path:   primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/securityRules?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkSecurityGroupPath, groupID, config.APIVersion("Microsoft.Network/networkSecurityGroups/securityRules"))),
+			Prepare: func(rule map[string]interface{}) {
+				ruleID, _ := rule["id"].(string)
+				rule["href"] = buildHref(ruleID, "network_security_groups", "network_security_group_rules")
+			},
+		})
 	}
-	return Render(c, 200, rules, "vnd.rightscale.network_security_group_rule+json;type=collection")
+	return renderChildren(c, listings, "vnd.rightscale.network_security_group_rule+json")
 }
 
 func listNetworkSecurityGroupRules(c *echo.Context) error {
@@ -98,16 +113,17 @@ func listNetworkSecurityGroupRules(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/securityRules?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkSecurityGroupPath, groupID, microsoftNetworkApiVersion)
+	path := primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/securityRules?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkSecurityGroupPath, groupID, config.APIVersion("Microsoft.Network/networkSecurityGroups/securityRules")))
 	rules, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
 	//add href for each rule
 	for _, rule := range rules {
-		rule["href"] = fmt.Sprintf("resource_groups/%s/network_security_groups/%s/network_security_group_rules/%s", groupName, groupID, rule["name"])
+		ruleID, _ := rule["id"].(string)
+		rule["href"] = buildHref(ruleID, "network_security_groups", "network_security_group_rules")
 	}
-	return Render(c, 200, rules, "vnd.rightscale.network_security_group_rule+json;type=collection")
+	return RenderCollection(c, rules, "vnd.rightscale.network_security_group_rule+json")
 }
 
 func listOneNetworkSecurityGroupRule(c *echo.Context) error {
@@ -140,16 +156,17 @@ func listDefaultNetworkSecurityGroupRules(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/defaultSecurityRules?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkSecurityGroupPath, groupID, microsoftNetworkApiVersion)
+	path := primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/defaultSecurityRules?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkSecurityGroupPath, groupID, config.APIVersion("Microsoft.Network/networkSecurityGroups/securityRules")))
 	rules, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
 	//add href for each rule
 	for _, rule := range rules {
-		rule["href"] = fmt.Sprintf("resource_groups/%s/networks/%s/network_security_group_rules/%s", groupName, groupID, rule["name"])
+		ruleID, _ := rule["id"].(string)
+		rule["href"] = buildHref(ruleID, "network_security_groups", "default_network_security_group_rules")
 	}
-	return Render(c, 200, rules, "vnd.rightscale.network_security_group_rule+json;type=collection")
+	return RenderCollection(c, rules, "vnd.rightscale.network_security_group_rule+json")
 }
 
 func createNetworkSecurityGroupRule(c *echo.Context) error {
@@ -157,6 +174,17 @@ func createNetworkSecurityGroupRule(c *echo.Context) error {
 	return Create(c, networkSecurityGroupRule)
 }
 
+func updateNetworkSecurityGroupRule(c *echo.Context) error {
+	networkSecurityGroupRule := NetworkSecurityGroupRule{
+		createParams: networkSecurityGroupRuleCreateParams{
+			Name:            c.Param("id"),
+			Group:           c.Param("group_name"),
+			SecurityGroupID: c.Param("security_group_name"),
+		},
+	}
+	return Update(c, &networkSecurityGroupRule)
+}
+
 func deleteNetworkSecurityGroupRule(c *echo.Context) error {
 	networkSecurityGroupRule := NetworkSecurityGroupRule{
 		createParams: networkSecurityGroupRuleCreateParams{
@@ -177,6 +205,10 @@ func (r *NetworkSecurityGroupRule) GetRequestParams(c *echo.Context) (interface{
 	r.createParams.Group = c.Param("group_name")
 	r.createParams.SecurityGroupID = c.Param("security_group_name")
 
+	if err := validateParams(&r.createParams); err != nil {
+		return nil, err
+	}
+
 	r.requestParams.Properties = map[string]interface{}{
 		"description":              r.createParams.Description,
 		"protocol":                 r.createParams.Protocol,
@@ -192,6 +224,33 @@ func (r *NetworkSecurityGroupRule) GetRequestParams(c *echo.Context) (interface{
 	return r.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the network security group rule gotten from the cloud
+func (r *NetworkSecurityGroupRule) GetUpdateParams(c *echo.Context, rule map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&r.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	properties := map[string]string{
+		"description":              r.createParams.Description,
+		"protocol":                 r.createParams.Protocol,
+		"sourcePortRange":          r.createParams.SourcePortRange,
+		"destinationPortRange":     r.createParams.DestinationPortRange,
+		"sourceAddressPrefix":      r.createParams.SourceAddressPrefix,
+		"destinationAddressPrefix": r.createParams.DestinationAddressPrefix,
+		"access":                   r.createParams.Access,
+		"direction":                r.createParams.Direction,
+	}
+	for name, value := range properties {
+		if value != "" {
+			setProperty(rule, value, "properties", name)
+		}
+	}
+	if r.createParams.Priority != 0 {
+		setProperty(rule, r.createParams.Priority, "properties", "priority")
+	}
+	return rule, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (r *NetworkSecurityGroupRule) GetResponseParams() interface{} {
 	return r.responseParams
@@ -203,7 +262,7 @@ func (r *NetworkSecurityGroupRule) GetPath(subscription string) string {
 	if r.createParams.Type == "default" {
 		resourceName = "defaultSecurityRules"
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/%s/%s?api-version=%s", config.BaseURL, subscription, r.createParams.Group, networkSecurityGroupPath, r.createParams.SecurityGroupID, resourceName, r.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/%s/%s?api-version=%s", config.BaseURL, subscription, r.createParams.Group, networkSecurityGroupPath, r.createParams.SecurityGroupID, resourceName, r.createParams.Name, config.APIVersion("Microsoft.Network/networkSecurityGroups/securityRules"))
 }
 
 // GetCollectionPath is a fake function to support AzureResource by NetworkSecurityGroupRule
@@ -219,7 +278,7 @@ func (r *NetworkSecurityGroupRule) HandleResponse(c *echo.Context, body []byte,
 	href := r.GetHref(r.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		r.responseParams.Href = href
 	}
 	return nil
@@ -232,6 +291,8 @@ func (r *NetworkSecurityGroupRule) GetContentType() string {
 
 // GetHref returns network security group rule href
 func (r *NetworkSecurityGroupRule) GetHref(networkSecurityGroupRuleID string) string {
-	array := strings.Split(networkSecurityGroupRuleID, "/")
-	return fmt.Sprintf("resource_groups/%s/network_security_groups/%s/network_security_group_rules/%s", array[len(array)-7], array[len(array)-3], array[len(array)-1])
+	if r.createParams.Type == "default" {
+		return buildHref(networkSecurityGroupRuleID, "network_security_groups", "default_network_security_group_rules")
+	}
+	return buildHref(networkSecurityGroupRuleID, "network_security_groups", "network_security_group_rules")
 }
@@ -75,14 +75,13 @@ var _ = Describe("network security group rules", func() {
 					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/"+networkSecurityGroupPath),
 					ghttp.RespondWith(http.StatusOK, listNSGsResponse),
 				),
-				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+networkSecurityGroupPath+"/khrvi1/securityRules"),
-					ghttp.RespondWith(http.StatusOK, listEmptyResponse),
-				),
-				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+networkSecurityGroupPath+"/khrvi2/securityRules"),
-					ghttp.RespondWith(http.StatusOK, listNSGRsResponse),
-				),
+			)
+			// rules of security groups are listed concurrently
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+networkSecurityGroupPath+"/khrvi1/securityRules",
+				ghttp.RespondWith(http.StatusOK, listEmptyResponse),
+			)
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+networkSecurityGroupPath+"/khrvi2/securityRules",
+				ghttp.RespondWith(http.StatusOK, listNSGRsResponse),
 			)
 			response, err = client.Get("/network_security_group_rules")
 		})
@@ -110,6 +109,42 @@ var _ = Describe("network security group rules", func() {
 		})
 	})
 
+	Describe("listing default rules", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+networkSecurityGroupPath+"/khrvi1/defaultSecurityRules"),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkSecurityGroups/khrvi1/defaultSecurityRules/DenyAllInBound","name":"DenyAllInBound"}]}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-1/network_security_groups/khrvi1/default_network_security_group_rules")
+		})
+
+		It("builds hrefs pointing to the default rules", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkSecurityGroups/khrvi1/defaultSecurityRules/DenyAllInBound","name":"DenyAllInBound","href":"resource_groups/Group-1/network_security_groups/khrvi1/default_network_security_group_rules/DenyAllInBound"}]`))
+		})
+	})
+
+	Describe("list one default rule", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+networkSecurityGroupPath+"/khrvi1/defaultSecurityRules/DenyAllInBound"),
+					ghttp.RespondWith(http.StatusOK, `{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/networkSecurityGroups/khrvi1/defaultSecurityRules/DenyAllInBound","name":"DenyAllInBound"}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-1/network_security_groups/khrvi1/default_network_security_group_rules/DenyAllInBound")
+		})
+
+		It("builds href pointing to the default rule", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(ContainSubstring(`"href":"resource_groups/Group-1/network_security_groups/khrvi1/default_network_security_group_rules/DenyAllInBound"`))
+		})
+	})
+
 	Describe("listing empty", func() {
 		BeforeEach(func() {
 			do.AppendHandlers(
@@ -223,6 +258,35 @@ var _ = Describe("network security group rules", func() {
 		})
 	})
 
+	Describe("creating with wrong params", func() {
+		BeforeEach(func() {
+			response, err = client.Post("/resource_groups/Group-1/network_security_groups/khrvi2/network_security_group_rules", "{\"name\": \"khrvi2_1\", \"protocol\": \"Tcp\", \"source_port_range\": \"80-70000\", \"destination_port_range\": \"801\", \"source_address_prefix\": \"*\", \"access\": \"Maybe\", \"priority\": 50}")
+		})
+
+		It("no error occured", func() {
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns 422 status code without calling Azure", func() {
+			Ω(do.ReceivedRequests()).Should(HaveLen(0))
+			Ω(response.Status).Should(Equal(422))
+		})
+
+		It("reports all invalid params at once", func() {
+			Ω(response.Body).Should(MatchJSON(`{
+				"Code": 422,
+				"Message": "You have specified invalid parameters: source_port_range, destination_address_prefix, access, priority, direction.",
+				"errors": [
+					{"field": "source_port_range", "message": "should be port between 0 and 65535, range of ports or '*', got '80-70000'"},
+					{"field": "destination_address_prefix", "message": "is required"},
+					{"field": "access", "message": "should be one of: Allow, Deny"},
+					{"field": "priority", "message": "should be between 100 and 4096"},
+					{"field": "direction", "message": "is required"}
+				]
+			}`))
+		})
+	})
+
 	Describe("deleting", func() {
 		BeforeEach(func() {
 			do.AppendHandlers(
@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -30,8 +29,8 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	networkSecurityGroupCreateParams struct {
-		Name          string                   `json:"name,omitempty"`
-		Location      string                   `json:"location,omitempty"`
+		Name          string                   `json:"name,omitempty" validate:"required"`
+		Location      string                   `json:"location,omitempty" validate:"required"`
 		Group         string                   `json:"group_name,omitempty"`
 		SecurityRules []map[string]interface{} `json:"security_rules,omitempty"`
 	}
@@ -44,6 +43,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "network_security_group",
+		ContentType:    "vnd.rightscale.network_security_group+json",
+		Actions:        crudActions,
+		Setup:          SetupNetworkSecurityGroupRoutes,
+		CreateParams:   networkSecurityGroupCreateParams{},
+		ResponseParams: networkSecurityGroupResponseParams{},
+	})
+}
+
 // SetupNetworkSecurityGroupRoutes declares routes for NetworkSecurityGroup resource
 func SetupNetworkSecurityGroupRoutes(e *echo.Group) {
 	e.Get("/network_security_groups", listNetworkSecurityGroup)
@@ -53,6 +63,8 @@ func SetupNetworkSecurityGroupRoutes(e *echo.Group) {
 	group.Get("", listNetworkSecurityGroup)
 	group.Get("/:id", listOneNetworkSecurityGroup)
 	group.Post("", createNetworkSecurityGroup)
+	group.Put("/:id", updateNetworkSecurityGroup)
+	group.Patch("/:id", updateNetworkSecurityGroup)
 	group.Delete("/:id", deleteNetworkSecurityGroup)
 }
 
@@ -75,6 +87,16 @@ func createNetworkSecurityGroup(c *echo.Context) error {
 	return Create(c, networkSecurityGroup)
 }
 
+func updateNetworkSecurityGroup(c *echo.Context) error {
+	networkSecurityGroup := NetworkSecurityGroup{
+		createParams: networkSecurityGroupCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &networkSecurityGroup)
+}
+
 func deleteNetworkSecurityGroup(c *echo.Context) error {
 	networkSecurityGroup := NetworkSecurityGroup{
 		createParams: networkSecurityGroupCreateParams{
@@ -93,6 +115,10 @@ func (nsg *NetworkSecurityGroup) GetRequestParams(c *echo.Context) (interface{},
 	}
 	nsg.createParams.Group = c.Param("group_name")
 
+	if err := validateParams(&nsg.createParams); err != nil {
+		return nil, err
+	}
+
 	nsg.requestParams.Location = nsg.createParams.Location
 	nsg.requestParams.Properties = map[string]interface{}{
 		"securityRules": nsg.createParams.SecurityRules,
@@ -101,6 +127,18 @@ func (nsg *NetworkSecurityGroup) GetRequestParams(c *echo.Context) (interface{},
 	return nsg.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the network security group gotten from the cloud
+func (nsg *NetworkSecurityGroup) GetUpdateParams(c *echo.Context, networkSecurityGroup map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&nsg.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if nsg.createParams.SecurityRules != nil {
+		setProperty(networkSecurityGroup, nsg.createParams.SecurityRules, "properties", "securityRules")
+	}
+	return networkSecurityGroup, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (nsg *NetworkSecurityGroup) GetResponseParams() interface{} {
 	return nsg.responseParams
@@ -108,15 +146,15 @@ func (nsg *NetworkSecurityGroup) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle network security group
 func (nsg *NetworkSecurityGroup) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, nsg.createParams.Group, networkSecurityGroupPath, nsg.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, nsg.createParams.Group, networkSecurityGroupPath, nsg.createParams.Name, config.APIVersion("Microsoft.Network/networkSecurityGroups"))
 }
 
 // GetCollectionPath returns full path to the collection of network security groups
 func (nsg *NetworkSecurityGroup) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, networkSecurityGroupPath, microsoftNetworkApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, networkSecurityGroupPath, config.APIVersion("Microsoft.Network/networkSecurityGroups"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, networkSecurityGroupPath, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, networkSecurityGroupPath, config.APIVersion("Microsoft.Network/networkSecurityGroups"))
 }
 
 // HandleResponse manage raw cloud response
@@ -127,7 +165,7 @@ func (nsg *NetworkSecurityGroup) HandleResponse(c *echo.Context, body []byte, ac
 	href := nsg.GetHref(nsg.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		nsg.responseParams.Href = href
 	}
 	return nil
@@ -140,6 +178,5 @@ func (nsg *NetworkSecurityGroup) GetContentType() string {
 
 // GetHref returns network security group href
 func (nsg *NetworkSecurityGroup) GetHref(networkSecurityGroupID string) string {
-	array := strings.Split(networkSecurityGroupID, "/")
-	return fmt.Sprintf("resource_groups/%s/network_security_groups/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(networkSecurityGroupID, "network_security_groups")
 }
@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -11,8 +10,7 @@ import (
 )
 
 const (
-	networkPath                = "providers/Microsoft.Network/virtualNetworks"
-	microsoftNetworkApiVersion = "2016-03-30"
+	networkPath = "providers/Microsoft.Network/virtualNetworks"
 )
 
 type (
@@ -32,10 +30,10 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	networkCreateParams struct {
-		Name            string                   `json:"name,omitempty"`
-		Location        string                   `json:"location,omitempty"`
+		Name            string                   `json:"name,omitempty" validate:"required"`
+		Location        string                   `json:"location,omitempty" validate:"required"`
 		Group           string                   `json:"group_name,omitempty"`
-		AddressPrefixes []string                 `json:"address_prefixes,omitempty"`
+		AddressPrefixes []string                 `json:"address_prefixes,omitempty" validate:"required,cidr"`
 		Subnets         []map[string]interface{} `json:"subnets,omitempty"`
 		DHCPOptions     map[string]interface{}   `json:"dhcp_options,omitempty"`
 	}
@@ -48,6 +46,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "network",
+		ContentType:    "vnd.rightscale.network+json",
+		Actions:        crudActions,
+		Setup:          SetupNetworkRoutes,
+		CreateParams:   networkCreateParams{},
+		ResponseParams: networkResponseParams{},
+	})
+}
+
 // SetupNetworkRoutes declares routes for IPAddress resource
 func SetupNetworkRoutes(e *echo.Group) {
 	e.Get("/networks", listNetworks)
@@ -57,6 +66,8 @@ func SetupNetworkRoutes(e *echo.Group) {
 	group.Get("", listNetworks)
 	group.Get("/:id", listOneNetwork)
 	group.Post("", createNetwork)
+	group.Put("/:id", updateNetwork)
+	group.Patch("/:id", updateNetwork)
 	group.Delete("/:id", deleteNetwork)
 }
 
@@ -80,6 +91,16 @@ func createNetwork(c *echo.Context) error {
 	return Create(c, network)
 }
 
+func updateNetwork(c *echo.Context) error {
+	network := Network{
+		createParams: networkCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &network)
+}
+
 func deleteNetwork(c *echo.Context) error {
 	network := Network{
 		createParams: networkCreateParams{
@@ -98,7 +119,10 @@ func (n *Network) GetRequestParams(c *echo.Context) (interface{}, error) {
 	}
 	n.createParams.Group = c.Param("group_name")
 
-	//TODO: add validation
+	if err := validateParams(&n.createParams); err != nil {
+		return nil, err
+	}
+
 	n.requestParams.Name = n.createParams.Name
 	n.requestParams.Location = n.createParams.Location
 	n.requestParams.Properties = map[string]interface{}{
@@ -106,6 +130,34 @@ func (n *Network) GetRequestParams(c *echo.Context) (interface{}, error) {
 			"addressPrefixes": n.createParams.AddressPrefixes,
 		},
 	}
+	n.requestParams.Properties["subnets"] = n.prepareSubnets()
+
+	if n.createParams.DHCPOptions != nil {
+		n.requestParams.Properties["dhcpOptions"] = n.createParams.DHCPOptions
+	}
+
+	return n.requestParams, nil
+}
+
+// GetUpdateParams maps passed params onto the network gotten from the cloud
+func (n *Network) GetUpdateParams(c *echo.Context, network map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&n.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if n.createParams.AddressPrefixes != nil {
+		setProperty(network, n.createParams.AddressPrefixes, "properties", "addressSpace", "addressPrefixes")
+	}
+	if n.createParams.Subnets != nil {
+		setProperty(network, n.prepareSubnets(), "properties", "subnets")
+	}
+	if n.createParams.DHCPOptions != nil {
+		setProperty(network, n.createParams.DHCPOptions, "properties", "dhcpOptions")
+	}
+	return network, nil
+}
+
+func (n *Network) prepareSubnets() []map[string]interface{} {
 	var subnets []map[string]interface{}
 	for _, subnet := range n.createParams.Subnets {
 		resource := map[string]interface{}{
@@ -121,13 +173,7 @@ func (n *Network) GetRequestParams(c *echo.Context) (interface{}, error) {
 		}
 		subnets = append(subnets, resource)
 	}
-	n.requestParams.Properties["subnets"] = subnets
-
-	if n.createParams.DHCPOptions != nil {
-		n.requestParams.Properties["dhcpOptions"] = n.createParams.DHCPOptions
-	}
-
-	return n.requestParams, nil
+	return subnets
 }
 
 // GetResponseParams is accessor function for getting access to responseParams struct
@@ -137,15 +183,15 @@ func (n *Network) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle network
 func (n *Network) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, n.createParams.Group, networkPath, n.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, n.createParams.Group, networkPath, n.createParams.Name, config.APIVersion("Microsoft.Network/virtualNetworks"))
 }
 
 // GetCollectionPath returns full path to the collection of network
 func (n *Network) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, networkPath, microsoftNetworkApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, networkPath, config.APIVersion("Microsoft.Network/virtualNetworks"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, networkPath, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, networkPath, config.APIVersion("Microsoft.Network/virtualNetworks"))
 }
 
 // HandleResponse manage raw cloud response
@@ -156,7 +202,7 @@ func (n *Network) HandleResponse(c *echo.Context, body []byte, actionName string
 	href := n.GetHref(n.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		n.responseParams.Href = href
 	}
 	return nil
@@ -169,6 +215,5 @@ func (n *Network) GetContentType() string {
 
 // GetHref returns network href
 func (n *Network) GetHref(networkID string) string {
-	array := strings.Split(networkID, "/")
-	return fmt.Sprintf("resource_groups/%s/networks/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(networkID, "networks")
 }
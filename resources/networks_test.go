@@ -13,6 +13,7 @@ import (
 
 const (
 	listNetworksResponse   = `{"value":[{"etag":"W/\"b055718a-6d32-49e4-a4dd-d8bde3f84070\"","href":"resource_groups/Group-3/networks/khrvi-3","id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3","location":"westus","name":"khrvi-3","properties":{"addressSpace":{"addressPrefixes":["10.0.0.0/16"]},"provisioningState":"Succeeded","subnets":[{"etag":"W/\"b055718a-6d32-49e4-a4dd-d8bde3f84070\"","id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3/subnets/khrvi-3","name":"khrvi-3","properties":{"addressPrefix":"10.0.0.0/16","provisioningState":"Succeeded"}}]}},{"etag":"W/\"2bc1c8a9-e9d1-4432-8b92-8e6c79d48e82\"","href":"resource_groups/Group-3/networks/net2","id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","location":"westus","name":"net2","properties":{"addressSpace":{"addressPrefixes":["10.0.0.0/16"]},"dhcpOptions":{"dnsServers":["10.1.0.5","10.1.0.6"]},"provisioningState":"Succeeded"}}]}`
+	getNetworkResponse     = `{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2","location":"westus","etag":"W/\"2bc1c8a9-e9d1-4432-8b92-8e6c79d48e82\"","properties":{"addressSpace":{"addressPrefixes":["10.0.0.0/16"]},"dhcpOptions":{"dnsServers":["10.1.0.5","10.1.0.6"]},"provisioningState":"Succeeded"}}`
 	listOneNetworkResponse = `{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2","location":"westus","etag":"W/\"2bc1c8a9-e9d1-4432-8b92-8e6c79d48e82\"","properties":{"addressSpace":{"addressPrefixes":["10.0.0.0/16"]},"dhcpOptions":{"dnsServers":["10.1.0.5","10.1.0.6"]},"provisioningState":"Succeeded"},"href":"resource_groups/Group-3/networks/net2"}`
 )
 
@@ -120,6 +121,134 @@ var _ = Describe("networks", func() {
 		})
 	})
 
+	Describe("listing with next link", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3","name":"khrvi-3"}],"nextLink":"`+do.URL()+`/subscriptions/test/resourceGroups/Group-3/`+networkPath+`?api-version=2016-03-30&$skiptoken=2"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath, "api-version=2016-03-30&$skiptoken=2"),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2"}]}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		It("follows next link until the last page", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3","name":"khrvi-3","href":"resource_groups/Group-3/networks/khrvi-3"},{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2","href":"resource_groups/Group-3/networks/net2"}]`))
+		})
+	})
+
+	Describe("listing with repeated next link", func() {
+		BeforeEach(func() {
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath,
+				func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte(`{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3","name":"khrvi-3"}],"nextLink":"` + do.URL() + `/subscriptions/test/resourceGroups/Group-3/` + networkPath + `?api-version=2016-03-30&$skiptoken=2"}`))
+				},
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		It("stops following the link once it repeats", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(400))
+			Ω(response.Body).Should(ContainSubstring("'nextLink' repeats"))
+		})
+	})
+
+	Describe("listing with IDs in different casing", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/SUBSCRIPTIONS/test/RESOURCEGROUPS/Group-3/PROVIDERS/Microsoft.Network/virtualnetworks/net2","name":"net2"}]}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		It("builds hrefs from parsed IDs", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Body).Should(MatchJSON(`[{"id":"/SUBSCRIPTIONS/test/RESOURCEGROUPS/Group-3/PROVIDERS/Microsoft.Network/virtualnetworks/net2","name":"net2","href":"resource_groups/Group-3/networks/net2"}]`))
+		})
+	})
+
+	Describe("listing with ID of another resource type", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/publicIPAddresses/net2","name":"net2"}]}`),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		It("doesn't build href pointing to the network", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Body).Should(MatchJSON(`[{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/publicIPAddresses/net2","name":"net2","href":""}]`))
+		})
+	})
+
+	Describe("listing with paging", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+				),
+			)
+		})
+
+		It("returns requested page", func() {
+			response, err = client.Get("/resource_groups/Group-3/networks?page=2&per_page=1")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Headers.Get("X-Total-Count")).Should(Equal("2"))
+			Ω(response.Headers.Get("X-Next-Page")).Should(BeEmpty())
+			networks := make(map[string][]interface{}, 0)
+			err = json.Unmarshal([]byte(listNetworksResponse), &networks)
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := json.Marshal(networks["value"][1:])
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Body).Should(MatchJSON(expected))
+		})
+
+		It("returns next page number if there are more resources", func() {
+			response, err = client.Get("/resource_groups/Group-3/networks?per_page=1")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Headers.Get("X-Next-Page")).Should(Equal("2"))
+		})
+
+		It("returns empty array if page is out of range", func() {
+			response, err = client.Get("/resource_groups/Group-3/networks?page=3&per_page=1")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(Equal("[]\n"))
+		})
+
+		It("returns empty array for huge page", func() {
+			response, err = client.Get("/resource_groups/Group-3/networks?page=9223372036854775807&per_page=2")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(Equal("[]\n"))
+			Ω(response.Headers.Get("X-Next-Page")).Should(BeEmpty())
+		})
+
+		It("returns error for invalid page", func() {
+			response, err = client.Get("/resource_groups/Group-3/networks?page=0")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(400))
+		})
+	})
+
 	Describe("list one network", func() {
 		BeforeEach(func() {
 			do.AppendHandlers(
@@ -260,6 +389,57 @@ var _ = Describe("networks", func() {
 		})
 	})
 
+	Describe("updating", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2"),
+					ghttp.RespondWith(http.StatusOK, getNetworkResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2"),
+					ghttp.VerifyHeaderKV("If-Match", "W/\"2bc1c8a9-e9d1-4432-8b92-8e6c79d48e82\""),
+					ghttp.VerifyJSON(`{"id":"/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/net2","name":"net2","location":"westus","etag":"W/\"2bc1c8a9-e9d1-4432-8b92-8e6c79d48e82\"","properties":{"addressSpace":{"addressPrefixes":["10.0.0.0/8"]},"dhcpOptions":{"dnsServers":["10.1.0.5","10.1.0.6"]},"provisioningState":"Succeeded"}}`),
+					ghttp.RespondWith(http.StatusOK, getNetworkResponse),
+				),
+			)
+			response, err = client.Put("/resource_groups/Group-3/networks/net2", `{"address_prefixes": ["10.0.0.0/8"]}`)
+		})
+
+		It("no error occured", func() {
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("modifies the network gotten from the cloud", func() {
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+
+		It("returns updated network", func() {
+			Ω(response.Headers["Content-Type"][0]).Should(Equal("vnd.rightscale.network+json"))
+			Ω(response.Body).Should(MatchJSON(listOneNetworkResponse))
+		})
+	})
+
+	Describe("updating via PATCH", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2"),
+					ghttp.VerifyJSON(`{"properties":{"dhcpOptions":{"dnsServers":["10.1.0.5"]}}}`),
+					ghttp.RespondWith(http.StatusOK, listOneNetworkResponse),
+				),
+			)
+			response, err = client.Patch("/resource_groups/Group-3/networks/net2", `{"dhcp_options": {"dnsServers": ["10.1.0.5"]}}`)
+		})
+
+		It("sends passed params only", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(1))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+
 	Describe("deleting", func() {
 		BeforeEach(func() {
 			do.AppendHandlers(
@@ -284,4 +464,34 @@ var _ = Describe("networks", func() {
 			Ω(response.Body).Should(BeEmpty())
 		})
 	})
+
+	Describe("deleting asynchronously", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net1"),
+					ghttp.RespondWith(202, "", http.Header{
+						"Azure-Asyncoperation": {do.URL() + "/subscriptions/" + subscriptionID + "/providers/Microsoft.Network/locations/westus/operations/8c1d1bc4?api-version=2016-03-30"},
+						"Location":             {do.URL() + "/subscriptions/" + subscriptionID + "/providers/Microsoft.Network/locations/westus/operationResults/5e2f03a1?api-version=2016-03-30"},
+					}),
+				),
+			)
+			response, err = client.Delete("/resource_groups/Group-3/networks/net1")
+		})
+
+		It("returns 202 status code", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(202))
+		})
+
+		It("prefers 'Azure-AsyncOperation' header over 'Location' one", func() {
+			Ω(response.Headers["Operationid"][0]).Should(Equal("8c1d1bc4"))
+		})
+
+		It("returns token of the operation", func() {
+			operationURL, err := parseOperationToken(response.Headers["Operationtoken"][0])
+			Expect(err).NotTo(HaveOccurred())
+			Ω(operationURL).Should(Equal(do.URL() + "/subscriptions/" + subscriptionID + "/providers/Microsoft.Network/locations/westus/operations/8c1d1bc4?api-version=2016-03-30"))
+		})
+	})
 })
@@ -0,0 +1,367 @@
+package resources
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+// openAPIVersion is version of OpenAPI specification the document follows
+const openAPIVersion = "3.0.0"
+
+// getOpenAPI describes the plugin API in OpenAPI format, the document is generated from routes
+// and param structs of registered resource types, so it could not go out of sync with the code
+func getOpenAPI(c *echo.Context) error {
+	return c.JSON(200, buildOpenAPI())
+}
+
+// openAPIRoute is a route declared by resource type Setup func
+type openAPIRoute struct {
+	method string
+	path   string
+}
+
+func buildOpenAPI() map[string]interface{} {
+	paths := make(map[string]interface{})
+	schemas := map[string]interface{}{
+		"error": errorSchema(),
+	}
+	for _, resourceType := range ResourceTypes() {
+		if resourceType.CreateParams != nil {
+			schemas[resourceType.Name+"_create_params"] = schemaOf(reflect.TypeOf(resourceType.CreateParams))
+		}
+		if resourceType.ResponseParams != nil {
+			schemas[resourceType.Name] = schemaOf(reflect.TypeOf(resourceType.ResponseParams))
+		}
+		for _, route := range resourceTypeRoutes(resourceType) {
+			path := openAPIPath(route.path)
+			item, ok := paths[path].(map[string]interface{})
+			if !ok {
+				item = make(map[string]interface{})
+				paths[path] = item
+			}
+			item[strings.ToLower(route.method)] = openAPIOperation(resourceType, route)
+		}
+	}
+	server := *config.AppPrefix
+	if server == "" {
+		server = "/"
+	}
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "Azure ARM proxy",
+			"description": "RightScale Self-Service plugin for Azure Resource Manager",
+			"version":     "1.0",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": server}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"access_token": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"subscription": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Azure-Subscription-Id"},
+				"session":      map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Azure-Session"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"access_token": []string{}, "subscription": []string{}},
+			map[string]interface{}{"session": []string{}},
+		},
+	}
+}
+
+// resourceTypeRoutes returns routes of the resource type by declaring them on a scratch router
+func resourceTypeRoutes(resourceType *ResourceType) []openAPIRoute {
+	e := echo.New()
+	resourceType.Setup(e.Group(""))
+	var routes []openAPIRoute
+	for _, route := range e.Routes() {
+		routes = append(routes, openAPIRoute{method: route.Method, path: route.Path})
+	}
+	return routes
+}
+
+func openAPIOperation(resourceType *ResourceType, route openAPIRoute) map[string]interface{} {
+	operation := map[string]interface{}{
+		"tags":        []string{resourceType.Name},
+		"operationId": operationID(route),
+	}
+	var parameters []interface{}
+	for _, segment := range strings.Split(route.path, "/") {
+		if strings.HasPrefix(segment, ":") {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     segment[1:],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	// resources kept in Azure are created, updated and deleted asynchronously if Azure decides so
+	azure := contains(resourceType.Actions, ActionUpdate)
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef("error")}},
+		},
+	}
+	switch {
+	case route.method == "GET" && !isParamSegment(lastSegment(route.path)) && contains(resourceType.Actions, ActionList):
+		parameters = append(parameters,
+			queryParam("page", "integer", "Number of the page, all resources are returned if it is not passed"),
+			queryParam("per_page", "integer", fmt.Sprintf("Number of resources on the page, default: %d, max: %d", defaultPerPage, maxPerPage)))
+		responses["200"] = bodyResponse("List of resources", resourceType, resourceType.ContentType+";type=collection", true)
+	case route.method == "GET":
+		responses["200"] = bodyResponse("Resource", resourceType, resourceType.ContentType, false)
+	case route.method == "POST" && contains(resourceType.Actions, ActionCreate):
+		operation["requestBody"] = requestBody(resourceType)
+		if azure {
+			responses["201"] = map[string]interface{}{
+				"description": "Resource is created, its href is returned in the 'Location' header",
+				"headers":     map[string]interface{}{"Location": stringHeader()},
+			}
+			responses["202"] = acceptedResponse()
+		} else {
+			responses["201"] = bodyResponse("Resource is created", resourceType, resourceType.ContentType, false)
+		}
+	case (route.method == "PUT" || route.method == "PATCH") && azure:
+		operation["requestBody"] = requestBody(resourceType)
+		responses["200"] = bodyResponse("Resource is updated", resourceType, resourceType.ContentType, false)
+		responses["202"] = acceptedResponse()
+	case route.method == "DELETE" && isParamSegment(lastSegment(route.path)):
+		responses["204"] = map[string]interface{}{"description": "Resource is deleted"}
+		if azure {
+			responses["202"] = acceptedResponse()
+		}
+	default:
+		responses["200"] = bodyResponse("Result of the action", resourceType, resourceType.ContentType, false)
+	}
+	if _, ok := operation["requestBody"]; azure && (ok || route.method == "DELETE") {
+		parameters = append(parameters, queryParam("dry_run", "boolean", "Return request to Azure instead of sending it"))
+	}
+	if route.method == "POST" {
+		parameters = append(parameters, headerParam(am.IdempotencyKeyHeader, "Key of the request, its retries with the same key get the first outcome replayed"))
+	}
+	public := false
+	for _, p := range am.PublicPaths {
+		if route.path == p || strings.HasPrefix(route.path, p+"/") {
+			public = true
+		}
+	}
+	if public {
+		operation["security"] = []interface{}{}
+	} else {
+		parameters = append(parameters, queryParam("api_version", "string", "Azure API version overriding the configured one"))
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+// requestBody describes create params which are also used to update the resource
+func requestBody(resourceType *ResourceType) map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef(resourceType.Name + "_create_params")}},
+	}
+}
+
+// bodyResponse describes response with resource or collection of resources in the body,
+// resource types without response params return free-form JSON
+func bodyResponse(description string, resourceType *ResourceType, contentType string, collection bool) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object"}
+	if resourceType.ResponseParams != nil {
+		schema = schemaRef(resourceType.Name)
+	}
+	if collection {
+		schema = map[string]interface{}{"type": "array", "items": schema}
+	}
+	return map[string]interface{}{
+		"description": description,
+		"content":     map[string]interface{}{contentType: map[string]interface{}{"schema": schema}},
+	}
+}
+
+func acceptedResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"description": "Operation is in progress, its status could be polled via href returned in the 'Location' header",
+		"headers": map[string]interface{}{
+			"Location":       stringHeader(),
+			"OperationToken": stringHeader(),
+		},
+	}
+}
+
+func stringHeader() map[string]interface{} {
+	return map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+}
+
+func queryParam(name string, kind string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": kind},
+	}
+}
+
+func headerParam(name string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "header",
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// errorSchema describes body of errors returned by the plugin, see error_handler package
+func errorSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"Code":    map[string]interface{}{"type": "integer"},
+			"Message": map[string]interface{}{"type": "string"},
+			"errors": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"field":   map[string]interface{}{"type": "string"},
+						"message": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+			"error":           map[string]interface{}{"type": "object"},
+			"x-ms-request-id": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+// schemaOf describes Go type as JSON schema, struct fields are described by their json and validate tags
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		addProperties(t, properties, &required)
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	// interface{} could hold any value
+	return map[string]interface{}{}
+}
+
+func addProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addProperties(field.Type, properties, required)
+			continue
+		}
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+		name := paramName(field)
+		schema := schemaOf(field.Type)
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				*required = append(*required, name)
+				continue
+			}
+			applyRule(schema, rule)
+		}
+		properties[name] = schema
+	}
+}
+
+// applyRule describes validation rule in the schema, see validation.go for the list of rules
+func applyRule(schema map[string]interface{}, rule string) {
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		// rules are applied to every element of slices
+		schema = items
+	}
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "oneof":
+		schema["enum"] = strings.Split(arg, "|")
+	case "range":
+		bounds := strings.SplitN(arg, "..", 2)
+		min, _ := strconv.Atoi(bounds[0])
+		max, _ := strconv.Atoi(bounds[1])
+		schema["minimum"], schema["maximum"] = min, max
+	case "max_len":
+		max, _ := strconv.Atoi(arg)
+		schema["maxLength"] = max
+	case "cidr", "ip":
+		schema["format"] = name
+	case "port_range":
+		schema["format"] = "port-range"
+	case "id":
+		schema["format"] = "azure-resource-id"
+		if arg != "" {
+			schema["description"] = "ID of " + arg + " resource"
+		}
+	}
+}
+
+// openAPIPath converts echo path params to OpenAPI ones: /networks/:id -> /networks/{id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isParamSegment(segment) {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationID builds unique operation ID from method and path: GET /resource_groups/:group_name -> get_resource_groups_group_name
+func operationID(route openAPIRoute) string {
+	id := strings.ToLower(route.method)
+	for _, segment := range strings.Split(route.path, "/") {
+		if segment = strings.TrimPrefix(segment, ":"); segment != "" {
+			id += "_" + segment
+		}
+	}
+	return id
+}
+
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func isParamSegment(segment string) bool {
+	return strings.HasPrefix(segment, ":")
+}
@@ -0,0 +1,87 @@
+package resources
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("OpenAPI document", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+	var document map[string]interface{}
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+		AccessTokenTest = ""
+		response, err = client.Get("/openapi.json")
+		AccessTokenTest = "fake"
+		document = nil
+		if err == nil {
+			json.Unmarshal([]byte(response.Body), &document)
+		}
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	// lookup follows keys of the document: lookup("paths", "/networks", "get")
+	lookup := func(keys ...string) interface{} {
+		var value interface{} = document
+		for _, key := range keys {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = object[key]
+		}
+		return value
+	}
+
+	It("is served without credentials", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(HaveLen(0))
+		Ω(response.Status).Should(Equal(200))
+		Ω(document["openapi"]).Should(Equal("3.0.0"))
+	})
+
+	It("describes routes of registered resource types", func() {
+		Ω(lookup("paths")).Should(HaveKey("/resource_groups/{group_name}/networks/{id}"))
+		Ω(lookup("paths")).Should(HaveKey("/storage_accounts"))
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks/{id}")).Should(HaveKey("patch"))
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks", "post", "tags")).Should(Equal([]interface{}{"network"}))
+		Ω(lookup("paths", "/sessions", "post", "security")).Should(BeEmpty())
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks", "post", "requestBody", "content", "application/json", "schema", "$ref")).Should(Equal("#/components/schemas/network_create_params"))
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks", "post", "parameters")).Should(ContainElement(HaveKeyWithValue("name", "Idempotency-Key")))
+	})
+
+	It("describes content types of responses", func() {
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks/{id}", "get", "responses", "200", "content")).Should(HaveKey("vnd.rightscale.network+json"))
+		Ω(lookup("paths", "/networks", "get", "responses", "200", "content")).Should(HaveKey("vnd.rightscale.network+json;type=collection"))
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks", "post", "responses")).Should(HaveKey("201"))
+		Ω(lookup("paths", "/resource_groups/{group_name}/networks/{id}", "delete", "responses")).Should(HaveKey("204"))
+	})
+
+	It("describes params by their json and validate tags", func() {
+		Ω(lookup("components", "schemas", "network_create_params", "required")).Should(Equal([]interface{}{"name", "location", "address_prefixes"}))
+		Ω(lookup("components", "schemas", "instance_create_params", "properties")).Should(HaveKey("instance_type_uid"))
+		Ω(lookup("components", "schemas", "network_security_group_rule_create_params", "properties", "priority")).Should(Equal(map[string]interface{}{
+			"type":    "integer",
+			"minimum": float64(100),
+			"maximum": float64(4096),
+		}))
+		Ω(lookup("components", "schemas", "network_security_group_rule_create_params", "properties", "access", "enum")).Should(Equal([]interface{}{"Allow", "Deny"}))
+		Ω(lookup("components", "schemas", "network_create_params", "properties", "address_prefixes", "items", "format")).Should(Equal("cidr"))
+		Ω(lookup("components", "schemas", "network", "properties")).Should(HaveKey("href"))
+	})
+})
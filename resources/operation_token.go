@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+var (
+	operationKey     []byte
+	operationKeyOnce sync.Once
+)
+
+// newOperationToken encodes polling URL of async operation into an opaque token: "<url>.<signature>"
+// where both parts are base64 encoded and signature is HMAC-SHA256 of the URL
+func newOperationToken(operationURL string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(operationURL)) + "." +
+		base64.RawURLEncoding.EncodeToString(signOperationURL(operationURL))
+}
+
+// parseOperationToken returns polling URL of async operation if token has not been tampered with
+func parseOperationToken(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", eh.InvalidParamException("token")
+	}
+	operationURL, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", eh.InvalidParamException("token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signOperationURL(string(operationURL))) {
+		return "", eh.InvalidParamException("token")
+	}
+	return string(operationURL), nil
+}
+
+func signOperationURL(operationURL string) []byte {
+	mac := hmac.New(sha256.New, getOperationKey())
+	mac.Write([]byte(operationURL))
+	return mac.Sum(nil)
+}
+
+// getOperationKey returns key passed via 'operation_secret' flag or random one,
+// tokens signed by random key become invalid after restart of the plugin
+func getOperationKey() []byte {
+	operationKeyOnce.Do(func() {
+		if config.OperationSecret != nil && *config.OperationSecret != "" {
+			operationKey = []byte(*config.OperationSecret)
+			return
+		}
+		operationKey = make([]byte, 32)
+		if _, err := rand.Read(operationKey); err != nil {
+			panic(err)
+		}
+	})
+	return operationKey
+}
@@ -1,7 +1,10 @@
 package resources
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -9,16 +12,49 @@ import (
 )
 
 type operationResponseParams struct {
-	Status  string `json:"status"`
-	Details string `json:"details,omitempty"`
-	Href    string `json:"href,omitempty"`
+	Status  string          `json:"status"`
+	Details string          `json:"details,omitempty"`
+	Error   *operationError `json:"error,omitempty"`
+	Href    string          `json:"href,omitempty"`
+}
+
+type operationError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// operationStatus represents body of async operation status or error gotten from Azure
+// https://msdn.microsoft.com/en-us/library/azure/mt163601.aspx
+type operationStatus struct {
+	Status string          `json:"status"`
+	Error  *operationError `json:"error"`
+}
+
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "operation",
+		ContentType:    "vnd.rightscale.operation+json",
+		Actions:        []string{ActionGet},
+		Setup:          SetupOperationRoutes,
+		ResponseParams: operationResponseParams{},
+	})
 }
 
 // SetupOperationRoutes declares routes for Operation resource
 func SetupOperationRoutes(e *echo.Group) {
+	e.Get("/operations/:token", getOperationByToken)
+	// kept for compatibility, operations of some providers could not be tracked this way
 	e.Get("/locations/:location/services/:service/operations/:id", getOperation)
 }
 
+func getOperationByToken(c *echo.Context) error {
+	operationURL, err := parseOperationToken(c.Param("token"))
+	if err != nil {
+		return err
+	}
+	return renderOperation(c, operationURL, fmt.Sprintf("operations/%s", c.Param("token")), getOperationID(operationURL))
+}
+
 func getOperation(c *echo.Context) error {
 	service := c.Param("service")
 	creds, err := GetClientCredentials(c)
@@ -28,42 +64,77 @@ func getOperation(c *echo.Context) error {
 	var path string
 	//Crasy stuff
 	if service == "storage" {
-		path = fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Storage/operations/%s?monitor=true&api-version=%s", config.BaseURL, creds.Subscription, c.Param("id"), "2015-06-15")
+		path = fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Storage/operations/%s?monitor=true&api-version=%s", config.BaseURL, creds.Subscription, c.Param("id"), config.APIVersion("Microsoft.Storage/operations"))
 	} else if service == "microsoft.compute" {
-		path = fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/operations/%s?monitor=true&api-version=%s", config.BaseURL, creds.Subscription, c.Param("location"), c.Param("id"), "2015-05-01-preview")
+		path = fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/operations/%s?monitor=true&api-version=%s", config.BaseURL, creds.Subscription, c.Param("location"), c.Param("id"), config.APIVersion("Microsoft.Compute/locations/operations"))
 	} else if service == "microsoft.network" {
-		path = fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Network/locations/%s/operationResults/%s?api-version=%s", config.BaseURL, creds.Subscription, c.Param("location"), c.Param("id"), "2015-06-15")
+		path = fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Network/locations/%s/operationResults/%s?api-version=%s", config.BaseURL, creds.Subscription, c.Param("location"), c.Param("id"), config.APIVersion("Microsoft.Network/locations/operations"))
 	} else {
-		path = fmt.Sprintf("%s/subscriptions/%s/operationresults/%s?api-version=%s", config.BaseURL, creds.Subscription, c.Param("id"), "2015-11-01")
+		path = fmt.Sprintf("%s/subscriptions/%s/operationresults/%s?api-version=%s", config.BaseURL, creds.Subscription, c.Param("id"), config.APIVersion("Microsoft.Resources/operationResults"))
 	}
+	return renderOperation(c, path, fmt.Sprintf("locations/%s/operations/%s", c.Param("location"), c.Param("id")), c.Param("id"))
+}
 
+// renderOperation polls async operation by the given URL and renders its status
+func renderOperation(c *echo.Context, path string, href string, id string) error {
 	client, err := GetAzureClient(c)
 	if err != nil {
 		return err
 	}
 
+	config.Logger.Info("Get Operation request:", "path", path)
 	resp, err := client.Get(path)
-	defer resp.Body.Close()
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("Error has occurred while requesting resource: %v", err))
 	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
+	}
+	var status operationStatus
+	// operation result may have no body or contain the resource itself
+	json.Unmarshal(b, &status)
+
 	var responseParams operationResponseParams
-	responseParams.Href = fmt.Sprintf("locations/%s/operations/%s", c.Param("location"), c.Param("id"))
-	if resp.StatusCode == 202 {
+	responseParams.Href = href
+	if resp.StatusCode == 404 {
+		responseParams.Status = "failed"
+		responseParams.Details = fmt.Sprintf("Error has occurred while requesting async operation: Could not find operation with id '%s'", id)
+	} else if resp.StatusCode >= 400 {
+		responseParams.Status = "failed"
+		responseParams.Error = status.Error
+		if status.Error != nil {
+			responseParams.Details = status.Error.Message
+		} else {
+			responseParams.Details = fmt.Sprintf("Error has occurred while requesting async operation: %s", string(b))
+		}
+	} else if resp.StatusCode == 202 {
 		responseParams.Status = "in-progress"
-	} else if resp.StatusCode == 200 || resp.StatusCode == 204 {
-		responseParams.Status = "succeeded"
 	} else {
-		var details string
-		if resp.StatusCode == 404 {
-			details = fmt.Sprintf("Could not find operation with id '%s'", c.Param("id"))
-		} else {
-			details = resp.Header.Get("Location")
+		responseParams.Status = getOperationStatus(status.Status)
+		if responseParams.Status == "failed" || responseParams.Status == "canceled" {
+			responseParams.Error = status.Error
+			if status.Error != nil {
+				responseParams.Details = status.Error.Message
+			}
 		}
-
-		responseParams.Details = fmt.Sprintf("Error has occurred while requesting async operation: %s", details)
-		responseParams.Status = "failed"
 	}
 
 	return Render(c, 200, responseParams, "vnd.rightscale.operation+json")
 }
+
+// getOperationStatus converts Azure operation status to the plugin one,
+// operation without status is considered as succeeded since its body is the result of operation
+func getOperationStatus(status string) string {
+	switch strings.ToLower(status) {
+	case "", "succeeded":
+		return "succeeded"
+	case "failed":
+		return "failed"
+	case "canceled":
+		return "canceled"
+	default:
+		return "in-progress"
+	}
+}
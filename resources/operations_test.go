@@ -1,8 +1,10 @@
 package resources
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -36,7 +38,7 @@ var _ = Describe("operations", func() {
 		BeforeEach(func() {
 			do.AppendHandlers(
 				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/providers/Microsoft.Compute/locations/westus/operations/896da082-4e65-4d00-a1bc-8d86591949fc"),
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/providers/Microsoft.Compute/locations/westus/operations/896da082-4e65-4d00-a1bc-8d86591949fc", "monitor=true&api-version="+config.APIVersion("Microsoft.Compute/locations/operations")),
 					ghttp.RespondWith(http.StatusOK, listOneOperationResponse),
 				),
 			)
@@ -84,4 +86,95 @@ var _ = Describe("operations", func() {
 			Ω(response.Body).Should(Equal("{\"status\":\"failed\",\"details\":\"Error has occurred while requesting async operation: Could not find operation with id 'khrvi1'\",\"href\":\"locations/westus/operations/khrvi1\"}\n"))
 		})
 	})
+
+	Describe("get operation in progress", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/providers/Microsoft.Network/locations/westus/operationResults/8c1d1bc4"),
+					ghttp.RespondWith(http.StatusOK, `{"status":"InProgress"}`),
+				),
+			)
+			response, err = client.Get("/locations/westus/services/microsoft.network/operations/8c1d1bc4")
+		})
+
+		It("returns status from the operation body", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`{"status":"in-progress","href":"locations/westus/operations/8c1d1bc4"}`))
+		})
+	})
+
+	Describe("get failed operation", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/providers/Microsoft.Network/locations/westus/operationResults/8c1d1bc4"),
+					ghttp.RespondWith(http.StatusOK, `{"status":"Failed","error":{"code":"InUseSubnetCannotBeDeleted","message":"Subnet default is in use and cannot be deleted."}}`),
+				),
+			)
+			response, err = client.Get("/locations/westus/services/microsoft.network/operations/8c1d1bc4")
+		})
+
+		It("returns failure code and message", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`{"status":"failed","details":"Subnet default is in use and cannot be deleted.","error":{"code":"InUseSubnetCannotBeDeleted","message":"Subnet default is in use and cannot be deleted."},"href":"locations/westus/operations/8c1d1bc4"}`))
+		})
+	})
+
+	Describe("get operation with error response", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/operationresults/eyJqb2JJZCI6"),
+					ghttp.RespondWith(http.StatusConflict, `{"error":{"code":"ResourceGroupDeletionBlocked","message":"Deletion of resource group 'Group-1' failed."}}`),
+				),
+			)
+			response, err = client.Get("/locations/westus/services/resources/operations/eyJqb2JJZCI6")
+		})
+
+		It("returns failure code and message", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`{"status":"failed","details":"Deletion of resource group 'Group-1' failed.","error":{"code":"ResourceGroupDeletionBlocked","message":"Deletion of resource group 'Group-1' failed."},"href":"locations/westus/operations/eyJqb2JJZCI6"}`))
+		})
+	})
+
+	Describe("get operation by token", func() {
+		var token string
+
+		BeforeEach(func() {
+			token = newOperationToken(do.URL() + "/subscriptions/" + subscriptionID + "/providers/Microsoft.Web/locations/westus/operationResults/4f1b2c3d?api-version=2016-08-01")
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/providers/Microsoft.Web/locations/westus/operationResults/4f1b2c3d", "api-version=2016-08-01"),
+					ghttp.RespondWith(http.StatusOK, `{"status":"Succeeded"}`),
+				),
+			)
+			response, err = client.Get("/operations/" + token)
+		})
+
+		It("polls the URL encoded in the token", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(1))
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`{"status":"succeeded","href":"operations/` + token + `"}`))
+		})
+	})
+
+	Describe("get operation by tampered token", func() {
+		BeforeEach(func() {
+			token := newOperationToken(do.URL() + "/subscriptions/" + subscriptionID + "/providers/Microsoft.Web/locations/westus/operationResults/4f1b2c3d")
+			signature := token[strings.Index(token, "."):]
+			forged := base64.RawURLEncoding.EncodeToString([]byte(do.URL()+"/subscriptions/other/operationresults/4f1b2c3d")) + signature
+			response, err = client.Get("/operations/" + forged)
+		})
+
+		It("rejects the token", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(BeEmpty())
+			Ω(response.Status).Should(Equal(400))
+		})
+	})
 })
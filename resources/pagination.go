@@ -0,0 +1,79 @@
+package resources
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+)
+
+const (
+	defaultPerPage = 100
+	maxPerPage     = 1000
+)
+
+// RenderCollection sends a collection of resources with status code 200.
+// If 'page' or 'per_page' query params are passed only the requested slice of the collection is rendered
+// and the total number of resources is reported in the 'X-Total-Count' header.
+func RenderCollection(c *echo.Context, resources []map[string]interface{}, contentType string) error {
+	page, perPage, err := getPageParams(c)
+	if err != nil {
+		return err
+	}
+	if page > 0 {
+		total := len(resources)
+		resources = paginate(resources, page, perPage)
+		c.Response().Header().Set("X-Total-Count", strconv.Itoa(total))
+		c.Response().Header().Set("X-Page", strconv.Itoa(page))
+		c.Response().Header().Set("X-Per-Page", strconv.Itoa(perPage))
+		// page is compared with the number of pages, since page*perPage could overflow for huge pages
+		if page < pageCount(total, perPage) {
+			c.Response().Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+	}
+	return Render(c, 200, resources, contentType+";type=collection")
+}
+
+// getPageParams parses 'page' and 'per_page' query params, page is 0 if paging is not requested
+func getPageParams(c *echo.Context) (int, int, error) {
+	pageParam := c.Query("page")
+	perPageParam := c.Query("per_page")
+	if pageParam == "" && perPageParam == "" {
+		return 0, 0, nil
+	}
+	page := 1
+	perPage := defaultPerPage
+	var err error
+	if pageParam != "" {
+		page, err = strconv.Atoi(pageParam)
+		if err != nil || page < 1 {
+			return 0, 0, eh.InvalidParamException("page")
+		}
+	}
+	if perPageParam != "" {
+		perPage, err = strconv.Atoi(perPageParam)
+		if err != nil || perPage < 1 || perPage > maxPerPage {
+			return 0, 0, eh.GenericException(fmt.Sprintf("You have specified an invalid 'per_page' parameter. It should be between 1 and %d.", maxPerPage))
+		}
+	}
+	return page, perPage, nil
+}
+
+// paginate returns resources for the given page, empty array is returned if page is out of range
+func paginate(resources []map[string]interface{}, page int, perPage int) []map[string]interface{} {
+	if page > pageCount(len(resources), perPage) {
+		return make([]map[string]interface{}, 0)
+	}
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > len(resources) {
+		end = len(resources)
+	}
+	return resources[start:end]
+}
+
+// pageCount returns number of pages of the collection
+func pageCount(total int, perPage int) int {
+	return (total + perPage - 1) / perPage
+}
@@ -27,9 +27,15 @@ type (
 	}
 )
 
-const (
-	providerAPIVersion = "2015-01-01"
-)
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "provider",
+		ContentType:    "vnd.rightscale.provider+json",
+		Actions:        []string{ActionList, ActionGet, "register"},
+		Setup:          SetupProviderRoutes,
+		ResponseParams: providerResponseParams{},
+	})
+}
 
 // SetupProviderRoutes declares routes for Provider resource
 func SetupProviderRoutes(e *echo.Group) {
@@ -39,14 +45,14 @@ func SetupProviderRoutes(e *echo.Group) {
 }
 
 func listProviders(c *echo.Context) error {
-	return List(c, new(Provider))
+	return ListCached(c, "providers", new(Provider))
 }
 
 func listOneProvider(c *echo.Context) error {
 	provider := Provider{
 		Name: c.Param("provider_name"),
 	}
-	return Get(c, &provider)
+	return GetCached(c, "providers", &provider)
 }
 
 // GetRequestParams is a fake function to support AzureResource by Provider
@@ -59,12 +65,12 @@ func (p *Provider) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle provider
 func (p *Provider) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/providers/%s?api-version=%s", config.BaseURL, subscription, p.Name, providerAPIVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/providers/%s?api-version=%s", config.BaseURL, subscription, p.Name, config.APIVersion("Microsoft.Resources/providers"))
 }
 
 // GetCollectionPath returns full path to the collection of providers
 func (p *Provider) GetCollectionPath(_ string, subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/providers?api-version=%s", config.BaseURL, subscription, providerAPIVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/providers?api-version=%s", config.BaseURL, subscription, config.APIVersion("Microsoft.Resources/providers"))
 }
 
 // HandleResponse manage raw cloud response
@@ -86,7 +92,12 @@ func (p *Provider) GetHref(namespace string) string {
 	return fmt.Sprintf("providers/%s", namespace)
 }
 
-func registerProvider(c *echo.Context) error {
+func registerProvider(c *echo.Context) (err error) {
+	if err := rejectDryRun(c); err != nil {
+		return err
+	}
+	event := startAudit(c, "register_provider")
+	defer func() { event.finish(c, err) }()
 	provider := new(Provider)
 	provider.Name = c.Param("provider_name")
 	creds, err := GetClientCredentials(c)
@@ -109,17 +120,24 @@ func registerProvider(c *echo.Context) error {
 		if err != nil {
 			return err
 		}
-		path := fmt.Sprintf("%s/subscriptions/%s/providers/%s/register?api-version=%s", config.BaseURL, creds.Subscription, provider.Name, providerAPIVersion)
+		path := fmt.Sprintf("%s/subscriptions/%s/providers/%s/register?api-version=%s", config.BaseURL, creds.Subscription, provider.Name, config.APIVersion("Microsoft.Resources/providers"))
 		config.Logger.Info("Registering Provider ", provider.Name, path)
+		event.request("POST", path, nil)
 		resp, err := client.PostForm(path, nil)
 		if err != nil {
 			return eh.GenericException(fmt.Sprintf("Error has occurred while registering provider: %v", err))
 		}
 		defer resp.Body.Close()
+		event.response(resp)
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 		}
+		if resp.StatusCode >= 400 {
+			return eh.AzureException("Error has occurred while registering provider", resp, body)
+		}
+		// registration state of cached providers is outdated
+		invalidateCachedEndpoint(c, "providers")
 
 		provider.HandleResponse(c, body, "")
 		return Render(c, 200, provider.GetResponseParams(), provider.GetContentType())
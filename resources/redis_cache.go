@@ -0,0 +1,193 @@
+package resources
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redisKeyPrefix separates keys of the plugin from other keys of the shared server
+	redisKeyPrefix = "azure_arm_proxy:cache:"
+	redisTimeout   = 5 * time.Second
+)
+
+// redisCache keeps values in Redis compatible server, so cache is shared by instances of the plugin
+// and survives their restart. It speaks RESP protocol over one connection which is reopened on failures.
+type redisCache struct {
+	addr string
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func newRedisCache(addr string) *redisCache {
+	return &redisCache{addr: addr}
+}
+
+// Get returns value, missing and expired values are reported by the server as nil
+func (r *redisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := r.do("GET", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply to GET: %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value which is expired by the server
+func (r *redisCache) Set(key string, value []byte, ttl time.Duration) error {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := r.do("SET", redisKeyPrefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// DeletePrefix scans keys matching the prefix and removes them
+func (r *redisCache) DeletePrefix(prefix string) (int, error) {
+	pattern := redisKeyPrefix + escapeRedisPattern(prefix) + "*"
+	deleted := 0
+	cursor := "0"
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return deleted, err
+		}
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return deleted, fmt.Errorf("unexpected reply to SCAN: %v", reply)
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]interface{})
+		if len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, key := range keys {
+				if k, ok := key.([]byte); ok {
+					args = append(args, string(k))
+				}
+			}
+			reply, err := r.do(args...)
+			if err != nil {
+				return deleted, err
+			}
+			if n, ok := reply.(int64); ok {
+				deleted += int(n)
+			}
+		}
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return deleted, nil
+		}
+	}
+}
+
+// do sends command and reads its reply: []byte for bulk strings, string for simple ones,
+// int64 for integers, []interface{} for arrays and nil for missing values
+func (r *redisCache) do(args ...string) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		conn, err := net.DialTimeout("tcp", r.addr, redisTimeout)
+		if err != nil {
+			return nil, err
+		}
+		r.conn, r.rd = conn, bufio.NewReader(conn)
+	}
+	r.conn.SetDeadline(time.Now().Add(redisTimeout))
+	reply, err := r.roundTrip(args)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// connection state is unknown after network and protocol errors
+		r.conn.Close()
+		r.conn, r.rd = nil, nil
+	}
+	return reply, err
+}
+
+func (r *redisCache) roundTrip(args []string) (interface{}, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := r.conn.Write(b.Bytes()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(r.rd)
+}
+
+// redisError is an error reply of the server, connection could be used after it
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func readRedisReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRedisReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply '%s'", line)
+}
+
+// escapeRedisPattern escapes glob characters of SCAN pattern
+func escapeRedisPattern(value string) string {
+	var b bytes.Buffer
+	for _, ch := range value {
+		if strings.ContainsRune(`*?[]\`, ch) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package resources
+
+import (
+	"sort"
+
+	"github.com/labstack/echo"
+)
+
+// Capabilities of resource types
+const (
+	ActionList   = "list"
+	ActionGet    = "get"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// crudActions are supported by most of resource types
+var crudActions = []string{ActionList, ActionGet, ActionCreate, ActionUpdate, ActionDelete}
+
+// ResourceType describes resource exposed by the plugin
+type ResourceType struct {
+	Name        string   `json:"name"`
+	ContentType string   `json:"content_type"`
+	Actions     []string `json:"actions"`
+	// Setup declares routes of the resource type
+	Setup func(*echo.Group) `json:"-"`
+	// CreateParams and ResponseParams are zero values of param structs which describe bodies in the OpenAPI document
+	CreateParams   interface{} `json:"-"`
+	ResponseParams interface{} `json:"-"`
+}
+
+// resourceTypes are registered by resource files on initialization
+var resourceTypes = make(map[string]*ResourceType)
+
+// registerResourceType adds resource type to the registry, it panics on duplicates since it is a programming error
+func registerResourceType(resourceType *ResourceType) {
+	if _, ok := resourceTypes[resourceType.Name]; ok {
+		panic("resource type is registered twice: " + resourceType.Name)
+	}
+	if err := checkValidationTags(resourceType.CreateParams); err != nil {
+		panic("resource type " + resourceType.Name + " has invalid validation tags: " + err.Error())
+	}
+	resourceTypes[resourceType.Name] = resourceType
+}
+
+// ResourceTypes returns registered resource types sorted by name
+func ResourceTypes() []*ResourceType {
+	types := make([]*ResourceType, 0, len(resourceTypes))
+	for _, resourceType := range resourceTypes {
+		types = append(types, resourceType)
+	}
+	sort.Sort(byName(types))
+	return types
+}
+
+type byName []*ResourceType
+
+func (t byName) Len() int           { return len(t) }
+func (t byName) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byName) Less(i, j int) bool { return t[i].Name < t[j].Name }
+
+// SetupResourceRoutes declares routes of all registered resource types and discovery route
+func SetupResourceRoutes(e *echo.Group) {
+	for _, resourceType := range ResourceTypes() {
+		resourceType.Setup(e)
+	}
+	e.Get("/resource_types", listResourceTypes)
+	e.Get("/openapi.json", getOpenAPI)
+}
+
+func listResourceTypes(c *echo.Context) error {
+	return Render(c, 200, ResourceTypes(), "vnd.rightscale.resource_type+json;type=collection")
+}
@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("resource types", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	It("lists registered resource types without credentials", func() {
+		AccessTokenTest = ""
+		defer func() { AccessTokenTest = "fake" }()
+		response, err = client.Get("/resource_types")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(HaveLen(0))
+		Ω(response.Status).Should(Equal(200))
+		Ω(response.Headers.Get("Content-Type")).Should(Equal("vnd.rightscale.resource_type+json;type=collection"))
+		var types []ResourceType
+		Expect(json.Unmarshal([]byte(response.Body), &types)).To(Succeed())
+		Ω(types).Should(HaveLen(len(resourceTypes)))
+		Ω(types).Should(ContainElement(ResourceType{
+			Name:        "network",
+			ContentType: "vnd.rightscale.network+json",
+			Actions:     []string{"list", "get", "create", "update", "delete"},
+		}))
+	})
+
+	It("declares routes of every registered resource type", func() {
+		for _, name := range []string{"event", "image", "instance_type", "route", "route_table", "virtual_network_gateway"} {
+			Ω(resourceTypes).Should(HaveKey(name))
+		}
+		do.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+routeTablePath),
+				ghttp.RespondWith(http.StatusOK, `{"value": []}`),
+			),
+		)
+		response, err = client.Get("/resource_groups/Group-3/route_tables")
+		Expect(err).NotTo(HaveOccurred())
+		Ω(do.ReceivedRequests()).Should(HaveLen(1))
+		Ω(response.Status).Should(Equal(200))
+	})
+})
@@ -3,17 +3,12 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
 )
 
-const (
-	resourceGroupApiVersion = "2016-02-01"
-)
-
 type (
 	resourceGroupResponseParams struct {
 		ID         string      `json:"id,omitempty"`
@@ -29,8 +24,8 @@ type (
 		Tags     map[string]interface{} `json:"tags,omitempty"`
 	}
 	resourceGroupCreateParams struct {
-		Name     string                 `json:"name,omitempty"`
-		Location string                 `json:"location,omitempty"`
+		Name     string                 `json:"name,omitempty" validate:"required"`
+		Location string                 `json:"location,omitempty" validate:"required"`
 		Tags     map[string]interface{} `json:"tags,omitempty"`
 	}
 	// ResourceGroup is base struct for Azure Resource Group resource to store input create params,
@@ -42,12 +37,25 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "resource_group",
+		ContentType:    "vnd.rightscale.resource_group+json",
+		Actions:        crudActions,
+		Setup:          SetupGroupsRoutes,
+		CreateParams:   resourceGroupCreateParams{},
+		ResponseParams: resourceGroupResponseParams{},
+	})
+}
+
 // SetupGroupsRoutes declares routes for resource group resource
 func SetupGroupsRoutes(e *echo.Group) {
 	group := e.Group("/resource_groups")
 	group.Get("", listResourceGroups)
 	group.Get("/:id", listOneResourceGroup)
 	group.Post("", createResourceGroup)
+	group.Put("/:id", updateResourceGroup)
+	group.Patch("/:id", updateResourceGroup)
 	group.Delete("/:id", deleteResourceGroup)
 }
 
@@ -69,6 +77,15 @@ func createResourceGroup(c *echo.Context) error {
 	return Create(c, group)
 }
 
+func updateResourceGroup(c *echo.Context) error {
+	group := ResourceGroup{
+		createParams: resourceGroupCreateParams{
+			Name: c.Param("id"),
+		},
+	}
+	return Update(c, &group)
+}
+
 func deleteResourceGroup(c *echo.Context) error {
 	group := ResourceGroup{
 		createParams: resourceGroupCreateParams{
@@ -85,13 +102,8 @@ func (rg *ResourceGroup) GetRequestParams(c *echo.Context) (interface{}, error)
 		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
 	}
 
-	//TODO: make a func for validating createParams and return all errors at once
-	if rg.createParams.Name == "" {
-		return nil, eh.InvalidParamException("name")
-	}
-
-	if rg.createParams.Location == "" {
-		return nil, eh.InvalidParamException("location")
+	if err := validateParams(&rg.createParams); err != nil {
+		return nil, err
 	}
 
 	rg.requestParams.Location = rg.createParams.Location
@@ -100,6 +112,18 @@ func (rg *ResourceGroup) GetRequestParams(c *echo.Context) (interface{}, error)
 	return rg.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the resource group gotten from the cloud
+func (rg *ResourceGroup) GetUpdateParams(c *echo.Context, group map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&rg.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if rg.createParams.Tags != nil {
+		group["tags"] = rg.createParams.Tags
+	}
+	return group, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (rg *ResourceGroup) GetResponseParams() interface{} {
 	return rg.responseParams
@@ -107,12 +131,12 @@ func (rg *ResourceGroup) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle resource group
 func (rg *ResourceGroup) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s?api-version=%s", config.BaseURL, subscription, rg.createParams.Name, resourceGroupApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s?api-version=%s", config.BaseURL, subscription, rg.createParams.Name, config.APIVersion("Microsoft.Resources/resourceGroups"))
 }
 
 // GetCollectionPath returns full path to the collection of resource groups
 func (rg *ResourceGroup) GetCollectionPath(_ string, subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups?api-version=%s", config.BaseURL, subscription, resourceGroupApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups?api-version=%s", config.BaseURL, subscription, config.APIVersion("Microsoft.Resources/resourceGroups"))
 }
 
 // HandleResponse manage raw cloud response
@@ -123,7 +147,7 @@ func (rg *ResourceGroup) HandleResponse(c *echo.Context, body []byte, actionName
 	href := rg.GetHref(rg.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		rg.responseParams.Href = href
 	}
 	return nil
@@ -136,6 +160,5 @@ func (rg *ResourceGroup) GetContentType() string {
 
 // GetHref returns resource group href
 func (rg *ResourceGroup) GetHref(groupID string) string {
-	array := strings.Split(groupID, "/")
-	return fmt.Sprintf("resource_groups/%s", array[len(array)-1])
+	return buildHref(groupID)
 }
@@ -0,0 +1,86 @@
+package resources
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+var _ = Describe("retries", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("listing when throttled", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(429, `{"error":{"code":"TooManyRequests","message":"Too many requests."}}`, http.Header{"Retry-After": {"0"}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse, http.Header{"X-Ms-Ratelimit-Remaining-Subscription-Reads": {"14998"}}),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		It("retries request after delay requested by Azure", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+
+		It("passes Azure rate limits in the header", func() {
+			Ω(response.Headers["X-Ms-Ratelimit-Remaining-Subscription-Reads"][0]).Should(Equal("14998"))
+		})
+	})
+
+	Describe("listing when Azure is unavailable", func() {
+		var baseDelay time.Duration
+
+		BeforeEach(func() {
+			baseDelay = *config.RetryBaseDelay
+			*config.RetryBaseDelay = time.Millisecond
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusServiceUnavailable, ""),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-3/networks")
+		})
+
+		AfterEach(func() {
+			*config.RetryBaseDelay = baseDelay
+		})
+
+		It("retries idempotent request with backoff", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(do.ReceivedRequests()).Should(HaveLen(2))
+			Ω(response.Status).Should(Equal(200))
+		})
+	})
+})
@@ -3,7 +3,6 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -12,7 +11,6 @@ import (
 
 const (
 	routeTablePath = "providers/Microsoft.Network/routeTables"
-	apiVersion     = "2015-06-15"
 )
 
 type (
@@ -31,8 +29,8 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	routeTableCreateParams struct {
-		Name     string   `json:"name,omitempty"`
-		Location string   `json:"location,omitempty"`
+		Name     string   `json:"name,omitempty" validate:"required"`
+		Location string   `json:"location,omitempty" validate:"required"`
 		Group    string   `json:"group_name,omitempty"`
 		Routes   []string `json:"routes,omitempty"`
 	}
@@ -45,6 +43,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "route_table",
+		ContentType:    "vnd.rightscale.route_table+json",
+		Actions:        crudActions,
+		Setup:          SetupRouteTablesRoutes,
+		CreateParams:   routeTableCreateParams{},
+		ResponseParams: routeTableResponseParams{},
+	})
+}
+
 // SetupRouteTablesRoutes declares routes for RouteTable resource
 func SetupRouteTablesRoutes(e *echo.Group) {
 	e.Get("/route_tables", listRouteTables)
@@ -54,6 +63,8 @@ func SetupRouteTablesRoutes(e *echo.Group) {
 	group.Get("", listRouteTables)
 	group.Get("/:id", listOneRouteTable)
 	group.Post("", createRouteTable)
+	group.Put("/:id", updateRouteTable)
+	group.Patch("/:id", updateRouteTable)
 	group.Delete("/:id", deleteRouteTable)
 }
 
@@ -76,6 +87,16 @@ func createRouteTable(c *echo.Context) error {
 	return Create(c, routeTable)
 }
 
+func updateRouteTable(c *echo.Context) error {
+	routeTable := RouteTable{
+		createParams: routeTableCreateParams{
+			Name:  c.Param("id"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &routeTable)
+}
+
 func deleteRouteTable(c *echo.Context) error {
 	routeTable := RouteTable{
 		createParams: routeTableCreateParams{
@@ -94,6 +115,10 @@ func (rt *RouteTable) GetRequestParams(c *echo.Context) (interface{}, error) {
 	}
 	rt.createParams.Group = c.Param("group_name")
 
+	if err := validateParams(&rt.createParams); err != nil {
+		return nil, err
+	}
+
 	rt.requestParams.Location = rt.createParams.Location
 	rt.requestParams.Properties = map[string]interface{}{
 		"routes": rt.createParams.Routes,
@@ -102,6 +127,18 @@ func (rt *RouteTable) GetRequestParams(c *echo.Context) (interface{}, error) {
 	return rt.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the route table gotten from the cloud
+func (rt *RouteTable) GetUpdateParams(c *echo.Context, routeTable map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&rt.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if rt.createParams.Routes != nil {
+		setProperty(routeTable, rt.createParams.Routes, "properties", "routes")
+	}
+	return routeTable, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (rt *RouteTable) GetResponseParams() interface{} {
 	return rt.responseParams
@@ -109,15 +146,15 @@ func (rt *RouteTable) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle route table
 func (rt *RouteTable) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, rt.createParams.Group, routeTablePath, rt.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, rt.createParams.Group, routeTablePath, rt.createParams.Name, config.APIVersion("Microsoft.Network/routeTables"))
 }
 
 // GetCollectionPath returns full path to the collection of route tables
 func (rt *RouteTable) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, routeTablePath, microsoftNetworkApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, routeTablePath, config.APIVersion("Microsoft.Network/routeTables"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, routeTablePath, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, routeTablePath, config.APIVersion("Microsoft.Network/routeTables"))
 }
 
 // HandleResponse manage raw cloud response
@@ -128,7 +165,7 @@ func (rt *RouteTable) HandleResponse(c *echo.Context, body []byte, actionName st
 	href := rt.GetHref(rt.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		rt.responseParams.Href = href
 	}
 	return nil
@@ -141,6 +178,5 @@ func (rt *RouteTable) GetContentType() string {
 
 // GetHref returns route table href
 func (rt *RouteTable) GetHref(routeTableID string) string {
-	array := strings.Split(routeTableID, "/")
-	return fmt.Sprintf("resource_groups/%s/route_tables/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(routeTableID, "route_tables")
 }
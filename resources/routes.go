@@ -3,11 +3,11 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	rid "github.com/rightscale/azure_arm_proxy/resource_id"
 )
 
 type (
@@ -25,11 +25,11 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	routesCreateParams struct {
-		Name             string `json:"name"`
+		Name             string `json:"name" validate:"required"`
 		Location         string `json:"location"`
-		Prefix           string `json:"address_prefix"`
-		NextHopType      string `json:"next_hop_type"`
-		NextHopIpAddress string `json:"next_hop_ip_address,omitempty"`
+		Prefix           string `json:"address_prefix" validate:"required,cidr"`
+		NextHopType      string `json:"next_hop_type" validate:"required,oneof=VirtualNetworkGateway|VnetLocal|Internet|VirtualAppliance|None"`
+		NextHopIpAddress string `json:"next_hop_ip_address,omitempty" validate:"ip"`
 		// the following params are required for building path
 		Group          string `json:"group_name,omitempty"`
 		RouteTableName string `json:"route_table_name,omitempty"`
@@ -43,6 +43,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "route",
+		ContentType:    "vnd.rightscale.route+json",
+		Actions:        crudActions,
+		Setup:          SetupRoutes,
+		CreateParams:   routesCreateParams{},
+		ResponseParams: routesResponseParams{},
+	})
+}
+
 // SetupRoutes declares routes for Route resource
 func SetupRoutes(e *echo.Group) {
 	e.Get("/routes", listAllRoutes)
@@ -52,36 +63,41 @@ func SetupRoutes(e *echo.Group) {
 	group.Get("", listRoutes)
 	group.Get("/:id", listOneRoute)
 	group.Post("", createRoute)
+	group.Put("/:id", updateRoute)
+	group.Patch("/:id", updateRoute)
 	group.Delete("/:id", deleteRoute)
 }
 
 func listAllRoutes(c *echo.Context) error {
-	routes := make([]map[string]interface{}, 0)
 	creds, err := GetClientCredentials(c)
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, routeTablePath, microsoftNetworkApiVersion)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, routeTablePath, config.APIVersion("Microsoft.Network/routeTables"))
 	tables, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
+	listings := make([]childListing, 0, len(tables))
 	for _, table := range tables {
-		array := strings.Split(table["id"].(string), "/")
-		groupName := array[len(array)-5]
-		tableID := table["name"].(string)
-		path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/routes?api-version=%s", config.BaseURL, creds.Subscription, groupName, routeTablePath, tableID, microsoftNetworkApiVersion)
-		resp, err := GetResources(c, path)
+		id, err := rid.Parse(table["id"].(string))
 		if err != nil {
-			return err
-		}
-		for _, route := range resp {
-			route["href"] = fmt.Sprintf("/resource_groups/%s/route_tables/%s/routes/%s", groupName, tableID, route["name"])
-			route["location"] = table["location"]
+			return eh.GenericException(fmt.Sprintf("got bad response from server: %v", err))
 		}
-		routes = append(routes, resp...)
-	}
-	return Render(c, 200, routes, "vnd.rightscale.route+json;type=collection")
+		groupName := id.ResourceGroup
+		tableID := table["name"].(string)
+		location := table["location"]
+		listings = append(listings, childListing{
+			Parent: table["id"].(string),
+			Path:   primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/routes?api-version=%s", config.BaseURL, creds.Subscription, groupName, routeTablePath, tableID, config.APIVersion("Microsoft.Network/routeTables/routes"))),
+			Prepare: func(route map[string]interface{}) {
+				routeID, _ := route["id"].(string)
+				route["href"] = buildHref(routeID, "route_tables", "routes")
+				route["location"] = location
+			},
+		})
+	}
+	return renderChildren(c, listings, "vnd.rightscale.route+json")
 }
 
 // it doesn't return 'location' as listRoutes or listAllRoutes
@@ -92,16 +108,17 @@ func listRoutes(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/routes?api-version=%s", config.BaseURL, creds.Subscription, groupName, routeTablePath, tableID, microsoftNetworkApiVersion)
+	path := primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/routes?api-version=%s", config.BaseURL, creds.Subscription, groupName, routeTablePath, tableID, config.APIVersion("Microsoft.Network/routeTables/routes")))
 	routes, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
 	//add href for each rule
 	for _, route := range routes {
-		route["href"] = fmt.Sprintf("/resource_groups/%s/route_tables/%s/routes/%s", groupName, tableID, route["name"])
+		routeID, _ := route["id"].(string)
+		route["href"] = buildHref(routeID, "route_tables", "routes")
 	}
-	return Render(c, 200, routes, "vnd.rightscale.routes+json;type=collection")
+	return RenderCollection(c, routes, "vnd.rightscale.routes+json")
 }
 
 // it doesn't return 'location' as listRoutes or listAllRoutes
@@ -121,6 +138,17 @@ func createRoute(c *echo.Context) error {
 	return Create(c, routes)
 }
 
+func updateRoute(c *echo.Context) error {
+	routes := Route{
+		createParams: routesCreateParams{
+			Name:           c.Param("id"),
+			Group:          c.Param("group_name"),
+			RouteTableName: c.Param("route_table_name"),
+		},
+	}
+	return Update(c, &routes)
+}
+
 func deleteRoute(c *echo.Context) error {
 	routes := Route{
 		createParams: routesCreateParams{
@@ -141,6 +169,10 @@ func (r *Route) GetRequestParams(c *echo.Context) (interface{}, error) {
 	r.createParams.Group = c.Param("group_name")
 	r.createParams.RouteTableName = c.Param("route_table_name")
 
+	if err := validateParams(&r.createParams); err != nil {
+		return nil, err
+	}
+
 	r.requestParams.Location = r.createParams.Location
 	r.requestParams.Properties = map[string]interface{}{
 		"addressPrefix":    r.createParams.Prefix,
@@ -151,6 +183,24 @@ func (r *Route) GetRequestParams(c *echo.Context) (interface{}, error) {
 	return r.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the route gotten from the cloud
+func (r *Route) GetUpdateParams(c *echo.Context, route map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&r.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if r.createParams.Prefix != "" {
+		setProperty(route, r.createParams.Prefix, "properties", "addressPrefix")
+	}
+	if r.createParams.NextHopType != "" {
+		setProperty(route, r.createParams.NextHopType, "properties", "nextHopType")
+	}
+	if r.createParams.NextHopIpAddress != "" {
+		setProperty(route, r.createParams.NextHopIpAddress, "properties", "nextHopIpAddress")
+	}
+	return route, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (r *Route) GetResponseParams() interface{} {
 	return r.responseParams
@@ -158,7 +208,7 @@ func (r *Route) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle route
 func (r *Route) GetPath(subscription string) string {
-	rr := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/routes/%s?api-version=%s", config.BaseURL, subscription, r.createParams.Group, routeTablePath, r.createParams.RouteTableName, r.createParams.Name, microsoftNetworkApiVersion)
+	rr := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/routes/%s?api-version=%s", config.BaseURL, subscription, r.createParams.Group, routeTablePath, r.createParams.RouteTableName, r.createParams.Name, config.APIVersion("Microsoft.Network/routeTables/routes"))
 	return rr
 }
 
@@ -173,7 +223,7 @@ func (r *Route) HandleResponse(c *echo.Context, body []byte, actionName string)
 	href := r.GetHref(r.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		r.responseParams.Href = href
 	}
 	return nil
@@ -186,6 +236,5 @@ func (r *Route) GetContentType() string {
 
 // GetHref returns route href
 func (r *Route) GetHref(routesID string) string {
-	array := strings.Split(routesID, "/")
-	return fmt.Sprintf("resource_groups/%s/route_tables/%s/routes/%s", array[len(array)-7], array[len(array)-3], array[len(array)-1])
+	return buildHref(routesID, "route_tables", "routes")
 }
@@ -0,0 +1,74 @@
+package resources
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+const (
+	listRouteTablesResponse = `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/routeTables/rt1","name":"rt1","location":"westus"}]}`
+	listRoutesResponse      = `{"value":[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/routeTables/rt1/routes/route1","name":"route1","properties":{"addressPrefix":"10.1.0.0/16","nextHopType":"VnetLocal"}}]}`
+)
+
+var _ = Describe("routes", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("listing", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+routeTablePath+"/rt1/routes"),
+					ghttp.RespondWith(http.StatusOK, listRoutesResponse),
+				),
+			)
+			response, err = client.Get("/resource_groups/Group-1/route_tables/rt1/routes")
+		})
+
+		It("builds hrefs from IDs of routes", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/routeTables/rt1/routes/route1","name":"route1","properties":{"addressPrefix":"10.1.0.0/16","nextHopType":"VnetLocal"},"href":"resource_groups/Group-1/route_tables/rt1/routes/route1"}]`))
+		})
+	})
+
+	Describe("listing via 'flat' route", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/"+routeTablePath),
+					ghttp.RespondWith(http.StatusOK, listRouteTablesResponse),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+routeTablePath+"/rt1/routes"),
+					ghttp.RespondWith(http.StatusOK, listRoutesResponse),
+				),
+			)
+			response, err = client.Get("/routes")
+		})
+
+		It("builds hrefs from IDs of routes and adds location of route table", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			Ω(response.Body).Should(MatchJSON(`[{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Network/routeTables/rt1/routes/route1","name":"route1","properties":{"addressPrefix":"10.1.0.0/16","nextHopType":"VnetLocal"},"href":"resource_groups/Group-1/route_tables/rt1/routes/route1","location":"westus"}]`))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/rightscale/azure_arm_proxy/config"
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	am "github.com/rightscale/azure_arm_proxy/middleware"
+)
+
+type sessionResponseParams struct {
+	ID        string `json:"id"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "session",
+		ContentType:    "vnd.rightscale.session+json",
+		Actions:        []string{ActionCreate, ActionDelete},
+		Setup:          SetupSessionRoutes,
+		CreateParams:   am.Session{},
+		ResponseParams: sessionResponseParams{},
+	})
+}
+
+// SetupSessionRoutes declares routes for Session resource
+func SetupSessionRoutes(e *echo.Group) {
+	e.Post("/sessions", createSession)
+	e.Delete("/sessions/:id", deleteSession)
+}
+
+// createSession stores credentials on the plugin side, returned session ID is passed instead of credentials
+// in the 'X-Azure-Session' header or 'Session' cookie
+func createSession(c *echo.Context) error {
+	session := new(am.Session)
+	if err := json.NewDecoder(c.Request().Body).Decode(session); err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if session.TenantID == "" || session.ClientID == "" {
+		return eh.GenericException("Both 'tenant_id' and 'client_id' are required.")
+	}
+	if session.CertificateProfile == "" && (session.ClientSecret == "" || session.RefreshToken == "") {
+		return eh.GenericException("Either 'client_secret' and 'refresh_token' or 'certificate_profile' are required.")
+	}
+	// the route is public, so certificate of the profile could be used only by the service principal it is bound to
+	if session.CertificateProfile != "" {
+		if _, ok := config.CertificateProfiles[session.CertificateProfile]; !ok {
+			return eh.InvalidParamException("certificate_profile")
+		}
+		if err := am.CheckCertificateProfile(session.CertificateProfile, session.TenantID, session.ClientID); err != nil {
+			return err
+		}
+	}
+	id, expiresAt, err := am.CreateSession(session)
+	if err != nil {
+		return eh.GenericException(fmt.Sprintf("Error has occurred while creating session: %v", err))
+	}
+	config.Logger.Info("Session created:", "tenant", session.TenantID, "client", session.ClientID, "expires_at", expiresAt)
+	return Render(c, 201, sessionResponseParams{ID: id, ExpiresAt: expiresAt.UTC().Format(time.RFC3339)}, "vnd.rightscale.session+json")
+}
+
+func deleteSession(c *echo.Context) error {
+	if err := am.DeleteSession(c.Param("id")); err != nil {
+		return err
+	}
+	return c.NoContent(204)
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
@@ -15,8 +14,7 @@ import (
 )
 
 const (
-	storageAccountPath         = "providers/Microsoft.Storage/storageAccounts"
-	microsoftStorageApiVersion = "2016-01-01"
+	storageAccountPath = "providers/Microsoft.Storage/storageAccounts"
 )
 
 type (
@@ -37,11 +35,11 @@ type (
 		Kind       string                 `json:"kind"`
 	}
 	storageAccountCreateParams struct {
-		Name        string                 `json:"name,omitempty"`
-		Location    string                 `json:"location,omitempty"`
+		Name        string                 `json:"name,omitempty" validate:"required"`
+		Location    string                 `json:"location,omitempty" validate:"required"`
 		Properties  map[string]interface{} `json:"properties,omitempty"`
-		AccountType string                 `json:"account_type,omitempty"`
-		Kind        string                 `json:"kind,omitempty"`
+		AccountType string                 `json:"account_type,omitempty" validate:"required,oneof=Standard_LRS|Standard_ZRS|Standard_GRS|Standard_RAGRS|Premium_LRS"`
+		Kind        string                 `json:"kind,omitempty" validate:"oneof=Storage|BlobStorage"`
 		Group       string                 `json:"group_name,omitempty"`
 	}
 	// StorageAccount is base struct for Azure Storage Account resource to store input create params,
@@ -53,6 +51,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "storage_account",
+		ContentType:    "vnd.rightscale.storage_account+json",
+		Actions:        append(crudActions, "keys", "check_name"),
+		Setup:          SetupStorageAccountsRoutes,
+		CreateParams:   storageAccountCreateParams{},
+		ResponseParams: storageAccountResponseParams{},
+	})
+}
+
 // SetupStorageAccountsRoutes declares routes for Storage account resource
 func SetupStorageAccountsRoutes(e *echo.Group) {
 	e.Get("/storage_accounts", listStorageAccounts)
@@ -67,6 +76,8 @@ func SetupStorageAccountsRoutes(e *echo.Group) {
 	group.Get("/:name/check_name", checkNameAvailability)
 	group.Get("/:name/keys", listKeys)
 	group.Post("", createStorageAccount)
+	group.Put("/:name", updateStorageAccount)
+	group.Patch("/:name", updateStorageAccount)
 	group.Delete("/:name", deleteStorageAccount)
 	//group.Delete("/:id/keys", getStorageAccountKeys)
 }
@@ -90,6 +101,16 @@ func createStorageAccount(c *echo.Context) error {
 	return Create(c, storageAccount)
 }
 
+func updateStorageAccount(c *echo.Context) error {
+	storageAccount := StorageAccount{
+		createParams: storageAccountCreateParams{
+			Name:  c.Param("name"),
+			Group: c.Param("group_name"),
+		},
+	}
+	return Update(c, &storageAccount)
+}
+
 func deleteStorageAccount(c *echo.Context) error {
 	storageAccount := StorageAccount{
 		createParams: storageAccountCreateParams{
@@ -108,6 +129,10 @@ func (s *StorageAccount) GetRequestParams(c *echo.Context) (interface{}, error)
 	}
 	s.createParams.Group = c.Param("group_name")
 
+	if err := validateParams(&s.createParams); err != nil {
+		return nil, err
+	}
+
 	s.requestParams.Location = s.createParams.Location
 	s.requestParams.Properties = s.createParams.Properties
 	s.requestParams.Kind = s.createParams.Kind
@@ -116,6 +141,21 @@ func (s *StorageAccount) GetRequestParams(c *echo.Context) (interface{}, error)
 	return s.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the storage account gotten from the cloud
+func (s *StorageAccount) GetUpdateParams(c *echo.Context, account map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&s.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	for name, value := range s.createParams.Properties {
+		setProperty(account, value, "properties", name)
+	}
+	if s.createParams.AccountType != "" {
+		setProperty(account, s.createParams.AccountType, "sku", "name")
+	}
+	return account, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (s *StorageAccount) GetResponseParams() interface{} {
 	return s.responseParams
@@ -123,15 +163,15 @@ func (s *StorageAccount) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle storage account
 func (s *StorageAccount) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, s.createParams.Group, storageAccountPath, s.createParams.Name, microsoftStorageApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s?api-version=%s", config.BaseURL, subscription, s.createParams.Group, storageAccountPath, s.createParams.Name, config.APIVersion("Microsoft.Storage/storageAccounts"))
 }
 
 // GetCollectionPath returns full path to the collection of storage accounts
 func (s *StorageAccount) GetCollectionPath(groupName string, subscription string) string {
 	if groupName == "" {
-		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, storageAccountPath, microsoftStorageApiVersion)
+		return fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, subscription, storageAccountPath, config.APIVersion("Microsoft.Storage/storageAccounts"))
 	}
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, storageAccountPath, microsoftStorageApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s?api-version=%s", config.BaseURL, subscription, groupName, storageAccountPath, config.APIVersion("Microsoft.Storage/storageAccounts"))
 }
 
 // HandleResponse manage raw cloud response
@@ -139,10 +179,11 @@ func (s *StorageAccount) HandleResponse(c *echo.Context, body []byte, actionName
 	if err := json.Unmarshal(body, &s.responseParams); err != nil {
 		return eh.GenericException(fmt.Sprintf("got bad response from server: %s", string(body)))
 	}
+	href := s.GetHref(s.responseParams.ID)
 	if actionName == "create" {
-		c.Response().Header().Add("Location", fmt.Sprintf("resource_groups/%s/storage_accounts/%s", s.createParams.Group, s.createParams.Name))
-	} else if actionName == "get" {
-		s.responseParams.Href = s.GetHref(s.responseParams.ID)
+		c.Response().Header().Add("Location", href)
+	} else if actionName == "get" || actionName == "update" {
+		s.responseParams.Href = href
 	}
 	return nil
 }
@@ -154,8 +195,7 @@ func (s *StorageAccount) GetContentType() string {
 
 // GetHref returns storage account href
 func (s *StorageAccount) GetHref(accountID string) string {
-	array := strings.Split(accountID, "/")
-	return fmt.Sprintf("resource_groups/%s/storage_accounts/%s", array[len(array)-5], array[len(array)-1])
+	return buildHref(accountID, "storage_accounts")
 }
 
 func checkNameAvailability(c *echo.Context) error {
@@ -167,7 +207,7 @@ func checkNameAvailability(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Storage/checkNameAvailability?api-version=%s", config.BaseURL, creds.Subscription, microsoftStorageApiVersion)
+	path := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Storage/checkNameAvailability?api-version=%s", config.BaseURL, creds.Subscription, config.APIVersion("Microsoft.Storage/storageAccounts"))
 	by, err := json.Marshal(map[string]interface{}{
 		"name": c.Param("name"),
 		"type": "Microsoft.Storage/storageAccounts",
@@ -190,6 +230,9 @@ func checkNameAvailability(c *echo.Context) error {
 	if err != nil {
 		return eh.GenericException(fmt.Sprintf("failed to load response body: %s", err))
 	}
+	if resp.StatusCode >= 400 {
+		return eh.AzureException("Error has occurred while checking name availability", resp, body)
+	}
 
 	var response map[string]interface{}
 	if err := json.Unmarshal(body, &response); err != nil {
@@ -199,7 +242,9 @@ func checkNameAvailability(c *echo.Context) error {
 
 }
 
-func listKeys(c *echo.Context) error {
+func listKeys(c *echo.Context) (err error) {
+	event := startAudit(c, "list_keys")
+	defer func() { event.finish(c, err) }()
 	client, err := GetAzureClient(c)
 	if err != nil {
 		return err
@@ -208,7 +253,8 @@ func listKeys(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s/listKeys?api-version=%s", config.BaseURL, creds.Subscription, c.Param("group_name"), c.Param("name"), microsoftStorageApiVersion)
+	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s/listKeys?api-version=%s", config.BaseURL, creds.Subscription, c.Param("group_name"), c.Param("name"), config.APIVersion("Microsoft.Storage/storageAccounts"))
+	event.request("POST", path, nil)
 	req, err := http.NewRequest("POST", path, nil)
 	if err != nil {
 		return err
@@ -218,6 +264,7 @@ func listKeys(c *echo.Context) error {
 		return eh.GenericException(fmt.Sprintf("Error has occurred while listing storage account keys: %v", err))
 	}
 	defer resp.Body.Close()
+	event.response(resp)
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -225,7 +272,7 @@ func listKeys(c *echo.Context) error {
 	}
 
 	if resp.StatusCode >= 400 {
-		return eh.GenericException(fmt.Sprintf("Error has occurred while listing storage account keys: %s", string(body)))
+		return eh.AzureException("Error has occurred while listing storage account keys", resp, body)
 	}
 
 	var response map[string]interface{}
@@ -0,0 +1,49 @@
+package resources
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/rightscale/azure_arm_proxy/config"
+)
+
+const getStorageAccountResponse = `{"id":"/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Storage/storageAccounts/sa1","name":"sa1","location":"westus","kind":"Storage","sku":{"name":"Standard_LRS"},"properties":{"provisioningState":"Succeeded"}}`
+
+var _ = Describe("storage accounts", func() {
+
+	var do *ghttp.Server
+	var client *AzureClient
+	var response *Response
+	var err error
+
+	BeforeEach(func() {
+		do = ghttp.NewServer()
+		config.BaseURL = do.URL()
+		client = NewAzureClient()
+	})
+
+	AfterEach(func() {
+		do.Close()
+	})
+
+	Describe("creating", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-1/"+storageAccountPath+"/sa1"),
+					ghttp.RespondWith(http.StatusOK, getStorageAccountResponse),
+				),
+			)
+			response, err = client.Post("/resource_groups/Group-1/storage_accounts", `{"name": "sa1", "location": "westus", "account_type": "Standard_LRS"}`)
+		})
+
+		It("returns href built from ID of the created account in the 'Location' header", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(201))
+			Ω(response.Headers["Location"][0]).Should(Equal("resource_groups/Group-1/storage_accounts/sa1"))
+		})
+	})
+})
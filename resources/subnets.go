@@ -3,11 +3,11 @@ package resources
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/labstack/echo"
 	"github.com/rightscale/azure_arm_proxy/config"
 	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	rid "github.com/rightscale/azure_arm_proxy/resource_id"
 )
 
 type (
@@ -23,11 +23,11 @@ type (
 		Properties map[string]interface{} `json:"properties,omitempty"`
 	}
 	subnetCreateParams struct {
-		Name                   string `json:"name,omitempty"`
+		Name                   string `json:"name,omitempty" validate:"required"`
 		Group                  string `json:"group_name,omitempty"`
 		NetworkID              string `json:"network_id,omitempty"`
-		AddressPrefix          string `json:"address_prefix,omitempty"`
-		NetworkSecurityGroupID string `json:"network_security_group_id,omitempty"`
+		AddressPrefix          string `json:"address_prefix,omitempty" validate:"required,cidr"`
+		NetworkSecurityGroupID string `json:"network_security_group_id,omitempty" validate:"id=Microsoft.Network/networkSecurityGroups"`
 	}
 	// Subnet is base struct for Azure Subnet resource to store input create params,
 	// request create params and response params gotten from cloud.
@@ -38,6 +38,17 @@ type (
 	}
 )
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "subnet",
+		ContentType:    "vnd.rightscale.subnet+json",
+		Actions:        crudActions,
+		Setup:          SetupSubnetsRoutes,
+		CreateParams:   subnetCreateParams{},
+		ResponseParams: subnetResponseParams{},
+	})
+}
+
 // SetupSubnetsRoutes declares routes for Subnet resource
 func SetupSubnetsRoutes(e *echo.Group) {
 	e.Get("/subnets", listAllSubnets)
@@ -49,6 +60,8 @@ func SetupSubnetsRoutes(e *echo.Group) {
 	group.Get("", listSubnets)
 	group.Get("/:id", listOneSubnet)
 	group.Post("", createSubnet)
+	group.Put("/:id", updateSubnet)
+	group.Patch("/:id", updateSubnet)
 	group.Delete("/:id", deleteSubnet)
 }
 
@@ -59,45 +72,48 @@ func listSubnets(c *echo.Context) error {
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/subnets?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkPath, networkID, microsoftNetworkApiVersion)
+	path := primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/subnets?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkPath, networkID, config.APIVersion("Microsoft.Network/virtualNetworks/subnets")))
 	subnets, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
 	//add href for each subnet
 	for _, subnet := range subnets {
-		subnet["href"] = fmt.Sprintf("resource_groups/%s/networks/%s/subnets/%s", groupName, networkID, subnet["name"])
+		subnetID, _ := subnet["id"].(string)
+		subnet["href"] = buildHref(subnetID, "networks", "subnets")
 	}
-	return Render(c, 200, subnets, "vnd.rightscale.subnet+json;type=collection")
+	return RenderCollection(c, subnets, "vnd.rightscale.subnet+json")
 }
 
 // To get all subnets faster could be used Network resource since each network contains set of subnets
 func listAllSubnets(c *echo.Context) error {
-	subnets := make([]map[string]interface{}, 0)
 	creds, err := GetClientCredentials(c)
 	if err != nil {
 		return err
 	}
-	path := fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, networkPath, microsoftNetworkApiVersion)
+	path := fmt.Sprintf("%s/subscriptions/%s/%s?api-version=%s", config.BaseURL, creds.Subscription, networkPath, config.APIVersion("Microsoft.Network/virtualNetworks"))
 	networks, err := GetResources(c, path)
 	if err != nil {
 		return err
 	}
+	listings := make([]childListing, 0, len(networks))
 	for _, network := range networks {
-		array := strings.Split(network["id"].(string), "/")
-		groupName := array[len(array)-5]
-		networkID := network["name"].(string)
-		path := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/subnets?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkPath, networkID, microsoftNetworkApiVersion)
-		resp, err := GetResources(c, path)
+		id, err := rid.Parse(network["id"].(string))
 		if err != nil {
-			return err
-		}
-		for _, subnet := range resp {
-			subnet["href"] = fmt.Sprintf("resource_groups/%s/networks/%s/subnets/%s", groupName, networkID, subnet["name"])
+			return eh.GenericException(fmt.Sprintf("got bad response from server: %v", err))
 		}
-		subnets = append(subnets, resp...)
-	}
-	return Render(c, 200, subnets, "vnd.rightscale.subnet+json;type=collection")
+		groupName := id.ResourceGroup
+		networkID := network["name"].(string)
+		listings = append(listings, childListing{
+			Parent: network["id"].(string),
+			Path:   primaryPath(c, fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/subnets?api-version=%s", config.BaseURL, creds.Subscription, groupName, networkPath, networkID, config.APIVersion("Microsoft.Network/virtualNetworks/subnets"))),
+			Prepare: func(subnet map[string]interface{}) {
+				subnetID, _ := subnet["id"].(string)
+				subnet["href"] = buildHref(subnetID, "networks", "subnets")
+			},
+		})
+	}
+	return renderChildren(c, listings, "vnd.rightscale.subnet+json")
 }
 
 func listOneSubnet(c *echo.Context) error {
@@ -116,6 +132,17 @@ func createSubnet(c *echo.Context) error {
 	return Create(c, subnet)
 }
 
+func updateSubnet(c *echo.Context) error {
+	subnet := Subnet{
+		createParams: subnetCreateParams{
+			Name:      c.Param("id"),
+			Group:     c.Param("group_name"),
+			NetworkID: c.Param("network_id"),
+		},
+	}
+	return Update(c, &subnet)
+}
+
 func deleteSubnet(c *echo.Context) error {
 	subnet := Subnet{
 		createParams: subnetCreateParams{
@@ -136,6 +163,10 @@ func (s *Subnet) GetRequestParams(c *echo.Context) (interface{}, error) {
 	s.createParams.Group = c.Param("group_name")
 	s.createParams.NetworkID = c.Param("network_id")
 
+	if err := validateParams(&s.createParams); err != nil {
+		return nil, err
+	}
+
 	s.requestParams.Properties = map[string]interface{}{
 		"addressPrefix": s.createParams.AddressPrefix,
 	}
@@ -149,6 +180,21 @@ func (s *Subnet) GetRequestParams(c *echo.Context) (interface{}, error) {
 	return s.requestParams, nil
 }
 
+// GetUpdateParams maps passed params onto the subnet gotten from the cloud
+func (s *Subnet) GetUpdateParams(c *echo.Context, subnet map[string]interface{}) (interface{}, error) {
+	err := c.Get("bodyDecoder").(*json.Decoder).Decode(&s.createParams)
+	if err != nil {
+		return nil, eh.GenericException(fmt.Sprintf("Error has occurred while decoding params: %v", err))
+	}
+	if s.createParams.AddressPrefix != "" {
+		setProperty(subnet, s.createParams.AddressPrefix, "properties", "addressPrefix")
+	}
+	if s.createParams.NetworkSecurityGroupID != "" {
+		setProperty(subnet, s.createParams.NetworkSecurityGroupID, "properties", "networkSecurityGroup", "id")
+	}
+	return subnet, nil
+}
+
 // GetResponseParams is accessor function for getting access to responseParams struct
 func (s *Subnet) GetResponseParams() interface{} {
 	return s.responseParams
@@ -156,7 +202,7 @@ func (s *Subnet) GetResponseParams() interface{} {
 
 // GetPath returns full path to the sigle subnet
 func (s *Subnet) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/subnets/%s?api-version=%s", config.BaseURL, subscription, s.createParams.Group, networkPath, s.createParams.NetworkID, s.createParams.Name, microsoftNetworkApiVersion)
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/%s/%s/subnets/%s?api-version=%s", config.BaseURL, subscription, s.createParams.Group, networkPath, s.createParams.NetworkID, s.createParams.Name, config.APIVersion("Microsoft.Network/virtualNetworks/subnets"))
 }
 
 // GetCollectionPath is a fake function to support AzureResource by Subnet
@@ -170,7 +216,7 @@ func (s *Subnet) HandleResponse(c *echo.Context, body []byte, actionName string)
 	href := s.GetHref(s.responseParams.ID)
 	if actionName == "create" {
 		c.Response().Header().Add("Location", href)
-	} else if actionName == "get" {
+	} else if actionName == "get" || actionName == "update" {
 		s.responseParams.Href = href
 	}
 	return nil
@@ -183,6 +229,5 @@ func (s *Subnet) GetContentType() string {
 
 // GetHref returns subnet href
 func (s *Subnet) GetHref(subnetID string) string {
-	array := strings.Split(subnetID, "/")
-	return fmt.Sprintf("resource_groups/%s/networks/%s/subnets/%s", array[len(array)-7], array[len(array)-3], array[len(array)-1])
+	return buildHref(subnetID, "networks", "subnets")
 }
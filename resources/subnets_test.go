@@ -3,6 +3,8 @@ package resources
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -74,14 +76,13 @@ var _ = Describe("subnets", func() {
 					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/"+networkPath),
 					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
 				),
-				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/khrvi-3/subnets"),
-					ghttp.RespondWith(http.StatusOK, listSubnetsResponse),
-				),
-				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2/subnets"),
-					ghttp.RespondWith(http.StatusOK, listEmptyResponse),
-				),
+			)
+			// subnets of networks are listed concurrently
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/khrvi-3/subnets",
+				ghttp.RespondWith(http.StatusOK, listSubnetsResponse),
+			)
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2/subnets",
+				ghttp.RespondWith(http.StatusOK, listEmptyResponse),
 			)
 			response, err = client.Get("/subnets")
 		})
@@ -109,6 +110,91 @@ var _ = Describe("subnets", func() {
 		})
 	})
 
+	Describe("listing via 'flat' route with some networks failing", func() {
+		BeforeEach(func() {
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+				),
+			)
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/khrvi-3/subnets",
+				ghttp.RespondWith(http.StatusForbidden, `{"error": {"code": "AuthorizationFailed", "message": "The client does not have authorization."}}`),
+			)
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2/subnets",
+				ghttp.RespondWith(http.StatusOK, strings.Replace(listSubnetsResponse, "khrvi-3", "net2", -1)),
+			)
+		})
+
+		It("lists subnets of available networks and reports failed ones", func() {
+			response, err = client.Get("/subnets")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(200))
+			var subnets []map[string]interface{}
+			Expect(json.Unmarshal([]byte(response.Body), &subnets)).To(Succeed())
+			Ω(subnets).Should(HaveLen(1))
+			Ω(subnets[0]).Should(HaveKeyWithValue("href", "resource_groups/Group-3/networks/net2/subnets/sub1"))
+			var failures []map[string]interface{}
+			Expect(json.Unmarshal([]byte(response.Headers.Get(PartialFailuresHeader)), &failures)).To(Succeed())
+			Ω(failures).Should(HaveLen(1))
+			Ω(failures[0]).Should(HaveKeyWithValue("parent", "/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3"))
+			Ω(failures[0]).Should(HaveKeyWithValue("status", BeNumerically("==", 403)))
+			Ω(failures[0]["message"]).Should(ContainSubstring("The client does not have authorization."))
+		})
+
+		It("fails if subnets of all networks can't be listed", func() {
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2/subnets",
+				ghttp.RespondWith(http.StatusForbidden, `{"error": {"code": "AuthorizationFailed", "message": "The client does not have authorization."}}`),
+			)
+			response, err = client.Get("/subnets")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(response.Status).Should(Equal(403))
+			Ω(response.Headers.Get(PartialFailuresHeader)).Should(BeEmpty())
+		})
+	})
+
+	Describe("listing via 'flat' route with slow network", func() {
+		var timeout, baseDelay, maxDelay time.Duration
+
+		BeforeEach(func() {
+			timeout, baseDelay, maxDelay = *config.FanOutTimeout, *config.RetryBaseDelay, *config.RetryMaxDelay
+			*config.FanOutTimeout, *config.RetryBaseDelay, *config.RetryMaxDelay = 200*time.Millisecond, 10*time.Second, 10*time.Second
+			do.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/subscriptions/"+subscriptionID+"/"+networkPath),
+					ghttp.RespondWith(http.StatusOK, listNetworksResponse),
+				),
+			)
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/khrvi-3/subnets",
+				func(w http.ResponseWriter, req *http.Request) {
+					time.Sleep(time.Second)
+				},
+			)
+			do.RouteToHandler("GET", "/subscriptions/"+subscriptionID+"/resourceGroups/Group-3/"+networkPath+"/net2/subnets",
+				ghttp.RespondWith(http.StatusOK, listSubnetsResponse),
+			)
+		})
+
+		AfterEach(func() {
+			*config.FanOutTimeout, *config.RetryBaseDelay, *config.RetryMaxDelay = timeout, baseDelay, maxDelay
+		})
+
+		It("cuts off the slow network by 'fan_out_timeout' without waiting for retries", func() {
+			started := time.Now()
+			response, err = client.Get("/subnets")
+			Expect(err).NotTo(HaveOccurred())
+			Ω(time.Since(started)).Should(BeNumerically("<", time.Second))
+			Ω(response.Status).Should(Equal(200))
+			var subnets []map[string]interface{}
+			Expect(json.Unmarshal([]byte(response.Body), &subnets)).To(Succeed())
+			Ω(subnets).Should(HaveLen(1))
+			var failures []map[string]interface{}
+			Expect(json.Unmarshal([]byte(response.Headers.Get(PartialFailuresHeader)), &failures)).To(Succeed())
+			Ω(failures).Should(HaveLen(1))
+			Ω(failures[0]).Should(HaveKeyWithValue("parent", "/subscriptions/test/resourceGroups/Group-3/providers/Microsoft.Network/virtualNetworks/khrvi-3"))
+		})
+	})
+
 	Describe("listing empty", func() {
 		BeforeEach(func() {
 			do.AppendHandlers(
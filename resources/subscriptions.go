@@ -23,6 +23,16 @@ type Subscription struct {
 	Href           string      `json:"href,omitempty"`
 }
 
+func init() {
+	registerResourceType(&ResourceType{
+		Name:           "subscription",
+		ContentType:    "vnd.rightscale.subscription+json",
+		Actions:        []string{ActionGet},
+		Setup:          SetupSubscriptionRoutes,
+		ResponseParams: Subscription{},
+	})
+}
+
 // SetupSubscriptionRoutes declares routes for Subscription resource
 func SetupSubscriptionRoutes(e *echo.Group) {
 	// get a current subscription
@@ -30,12 +40,12 @@ func SetupSubscriptionRoutes(e *echo.Group) {
 }
 
 func getSubscription(c *echo.Context) error {
-	return Get(c, new(Subscription))
+	return GetCached(c, "subscription", new(Subscription))
 }
 
 // GetPath returns full path to the sigle subscription
 func (s *Subscription) GetPath(subscription string) string {
-	return fmt.Sprintf("%s/%s/%s?api-version=%s", config.BaseURL, subscriptionsPath, subscription, "2015-01-01")
+	return fmt.Sprintf("%s/%s/%s?api-version=%s", config.BaseURL, subscriptionsPath, subscription, config.APIVersion("Microsoft.Resources/subscriptions"))
 }
 
 // HandleResponse manage raw cloud response
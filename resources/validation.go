@@ -0,0 +1,288 @@
+package resources
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+
+	eh "github.com/rightscale/azure_arm_proxy/error_handler"
+	rid "github.com/rightscale/azure_arm_proxy/resource_id"
+)
+
+// Create params are validated declaratively by 'validate' tags of their fields, rules are separated by comma:
+//   required        - value should not be empty (zero)
+//   oneof=A|B       - value should be one of the listed ones ignoring case
+//   range=MIN..MAX  - number should be between MIN and MAX inclusive
+//   max_len=N       - string should not be longer than N characters
+//   cidr            - value should be CIDR block, ex: 10.0.0.0/16
+//   ip              - value should be IP address
+//   port_range      - value should be port, range of ports or '*', ex: 22, 8000-8080
+//   id[=TYPE]       - value should be Azure resource ID, of the given type if passed
+// Rules except 'required' are applied to non-empty values only and to every element of slices.
+// Tags of create params are checked when resource type is registered, so unknown or malformed rules panic on start.
+// Params could implement paramsValidator to check dependencies between fields.
+
+// paramsValidator is implemented by create params which need checks not expressible by tags
+type paramsValidator interface {
+	validate() []eh.FieldError
+}
+
+// validateParams checks params and returns 422 error listing all invalid fields, nil is returned for valid params
+func validateParams(params interface{}) error {
+	fieldErrors := validateFields(reflect.Indirect(reflect.ValueOf(params)))
+	if v, ok := params.(paramsValidator); ok {
+		fieldErrors = append(fieldErrors, v.validate()...)
+	}
+	if len(fieldErrors) > 0 {
+		return eh.ValidationException(fieldErrors)
+	}
+	return nil
+}
+
+func validateFields(value reflect.Value) []eh.FieldError {
+	var fieldErrors []eh.FieldError
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fieldErrors = append(fieldErrors, validateFields(value.Field(i))...)
+			continue
+		}
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		if message := validateField(value.Field(i), rules); message != "" {
+			fieldErrors = append(fieldErrors, eh.FieldError{Field: paramName(field), Message: message})
+		}
+	}
+	return fieldErrors
+}
+
+// validateField returns message describing the first broken rule, empty string is returned for valid value
+func validateField(value reflect.Value, rules string) string {
+	empty := isEmpty(value)
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		if name == "required" {
+			if empty {
+				return "is required"
+			}
+			continue
+		}
+		if empty {
+			continue
+		}
+		values := []reflect.Value{value}
+		if value.Kind() == reflect.Slice {
+			values = values[:0]
+			for j := 0; j < value.Len(); j++ {
+				values = append(values, value.Index(j))
+			}
+		}
+		for _, v := range values {
+			if message := checkRule(name, arg, reflect.Indirect(v)); message != "" {
+				return message
+			}
+		}
+	}
+	return ""
+}
+
+func checkRule(name string, arg string, value reflect.Value) string {
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	switch name {
+	case "range":
+		min, max, err := parseRange(arg)
+		if err != nil {
+			return err.Error()
+		}
+		var n float64
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(value.Int())
+		case reflect.Float32, reflect.Float64:
+			n = value.Float()
+		default:
+			return "should be a number"
+		}
+		if n < min || n > max {
+			return fmt.Sprintf("should be between %s and %s", formatNumber(min), formatNumber(max))
+		}
+		return ""
+	}
+	if value.Kind() != reflect.String {
+		return "should be a string"
+	}
+	s := value.String()
+	switch name {
+	case "oneof":
+		for _, allowed := range strings.Split(arg, "|") {
+			if strings.EqualFold(s, allowed) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("should be one of: %s", strings.Replace(arg, "|", ", ", -1))
+	case "max_len":
+		max, _ := strconv.Atoi(arg)
+		if len([]rune(s)) > max {
+			return fmt.Sprintf("should not be longer than %d characters", max)
+		}
+	case "cidr":
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return fmt.Sprintf("should be CIDR block, ex: 10.0.0.0/16, got '%s'", s)
+		}
+	case "ip":
+		if net.ParseIP(s) == nil {
+			return fmt.Sprintf("should be IP address, got '%s'", s)
+		}
+	case "port_range":
+		if !isPortRange(s) {
+			return fmt.Sprintf("should be port between 0 and 65535, range of ports or '*', got '%s'", s)
+		}
+	case "id":
+		id, err := rid.Parse(s)
+		if err != nil {
+			return fmt.Sprintf("should be Azure resource ID, got '%s'", s)
+		}
+		if arg != "" && !id.IsType(arg) {
+			return fmt.Sprintf("should be ID of %s resource, got '%s'", arg, s)
+		}
+	default:
+		// unknown rules are rejected when resource type is registered, see checkValidationTags
+		return fmt.Sprintf("has unknown validation rule '%s'", name)
+	}
+	return ""
+}
+
+// checkValidationTags checks rules of 'validate' tags of params fields, so broken tags fail on start rather than on request
+func checkValidationTags(params interface{}) error {
+	t := reflect.TypeOf(params)
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := checkValidationTags(reflect.Zero(field.Type).Interface()); err != nil {
+				return err
+			}
+			continue
+		}
+		rules := field.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if err := checkValidationRule(rule); err != nil {
+				return fmt.Errorf("%s.%s: %s", t.Name(), field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkValidationRule(rule string) error {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+	switch name {
+	case "required", "cidr", "ip", "port_range":
+		if arg != "" {
+			return fmt.Errorf("rule '%s' takes no argument", name)
+		}
+	case "oneof":
+		if arg == "" {
+			return fmt.Errorf("rule 'oneof' should list allowed values")
+		}
+	case "range":
+		if _, _, err := parseRange(arg); err != nil {
+			return err
+		}
+	case "max_len":
+		if n, err := strconv.Atoi(arg); err != nil || n < 0 {
+			return fmt.Errorf("rule 'max_len' should have non-negative length, got '%s'", arg)
+		}
+	case "id":
+	default:
+		return fmt.Errorf("unknown validation rule '%s'", name)
+	}
+	return nil
+}
+
+// parseRange parses bounds of 'range' rule: MIN..MAX
+func parseRange(arg string) (float64, float64, error) {
+	bounds := strings.SplitN(arg, "..", 2)
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("rule 'range' should be MIN..MAX, got '%s'", arg)
+	}
+	min, err := strconv.ParseFloat(bounds[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("rule 'range' has malformed lower bound '%s'", bounds[0])
+	}
+	max, err := strconv.ParseFloat(bounds[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("rule 'range' has malformed upper bound '%s'", bounds[1])
+	}
+	if min > max {
+		return 0, 0, fmt.Errorf("rule 'range' has lower bound greater than upper one: '%s'", arg)
+	}
+	return min, max, nil
+}
+
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return value.IsNil()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	}
+	return false
+}
+
+func isPortRange(value string) bool {
+	if value == "*" {
+		return true
+	}
+	var ports []int
+	for _, port := range strings.SplitN(value, "-", 2) {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 0 || n > 65535 {
+			return false
+		}
+		ports = append(ports, n)
+	}
+	return len(ports) == 1 || ports[0] <= ports[1]
+}
+
+// paramName returns name of the param as it is passed in the request body
+func paramName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
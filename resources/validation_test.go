@@ -0,0 +1,104 @@
+package resources
+
+import (
+	"reflect"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("validation", func() {
+
+	const storageAccountID = "/subscriptions/test/resourceGroups/Group-1/providers/Microsoft.Storage/storageAccounts/sa1"
+
+	// every case is checked by validateField, empty message means valid value
+	cases := []struct {
+		rules   string
+		value   interface{}
+		message string
+	}{
+		{"required", "", "is required"},
+		{"required", 0, "is required"},
+		{"required", []string{}, "is required"},
+		{"required", "net1", ""},
+		{"oneof=Static|Dynamic", "static", ""},
+		{"oneof=Static|Dynamic", "Reserved", "should be one of: Static, Dynamic"},
+		{"max_len=3", "abc", ""},
+		{"max_len=3", "abcd", "should not be longer than 3 characters"},
+		{"cidr", "10.0.0.0/16", ""},
+		{"cidr", "2001:db8::/32", ""},
+		{"cidr", "10.0.0.0", "should be CIDR block, ex: 10.0.0.0/16, got '10.0.0.0'"},
+		{"cidr", "10.0.0.0/33", "should be CIDR block, ex: 10.0.0.0/16, got '10.0.0.0/33'"},
+		{"ip", "10.1.0.5", ""},
+		{"ip", "::1", ""},
+		{"ip", "10.1.0", "should be IP address, got '10.1.0'"},
+		{"port_range", "22", ""},
+		{"port_range", "8000-8080", ""},
+		{"port_range", "*", ""},
+		{"port_range", "65536", "should be port between 0 and 65535, range of ports or '*', got '65536'"},
+		{"port_range", "8080-8000", "should be port between 0 and 65535, range of ports or '*', got '8080-8000'"},
+		{"port_range", "http", "should be port between 0 and 65535, range of ports or '*', got 'http'"},
+		{"id", storageAccountID, ""},
+		{"id", "sa1", "should be Azure resource ID, got 'sa1'"},
+		{"id=Microsoft.Storage/storageAccounts", storageAccountID, ""},
+		{"id=Microsoft.Network/publicIPAddresses", storageAccountID, "should be ID of Microsoft.Network/publicIPAddresses resource, got '" + storageAccountID + "'"},
+		{"range=4..30", 4, ""},
+		{"range=4..30", 31, "should be between 4 and 30"},
+		{"range=4..30", 30.5, "should be between 4 and 30"},
+		{"range=0.5..1.5", 1.25, ""},
+		{"range=0.5..1.5", 0.25, "should be between 0.5 and 1.5"},
+		{"range=4..30", "10", "should be a number"},
+		{"required,cidr", []string{"10.0.0.0/16", "10.1.0.0/16"}, ""},
+		{"required,cidr", []string{"10.0.0.0/16", "10.1.0.0"}, "should be CIDR block, ex: 10.0.0.0/16, got '10.1.0.0'"},
+		{"ip", []string{"10.1.0.5", "dns"}, "should be IP address, got 'dns'"},
+		{"range=1..10", []int{1, 11}, "should be between 1 and 10"},
+		{"ip", []interface{}{"10.1.0.5", 5}, "should be a string"},
+	}
+	for _, c := range cases {
+		c := c
+		It("checks "+c.rules+" rule", func() {
+			Ω(validateField(reflect.ValueOf(c.value), c.rules)).Should(Equal(c.message), "value: %#v", c.value)
+		})
+	}
+
+	Describe("tags", func() {
+		malformed := []struct {
+			rules string
+			err   string
+		}{
+			{"required,unique", "unknown validation rule 'unique'"},
+			{"range=4", "rule 'range' should be MIN..MAX, got '4'"},
+			{"range=four..30", "rule 'range' has malformed lower bound 'four'"},
+			{"range=4..", "rule 'range' has malformed upper bound ''"},
+			{"range=30..4", "rule 'range' has lower bound greater than upper one: '30..4'"},
+			{"max_len=long", "rule 'max_len' should have non-negative length, got 'long'"},
+			{"oneof=", "rule 'oneof' should list allowed values"},
+			{"cidr=16", "rule 'cidr' takes no argument"},
+		}
+		for _, m := range malformed {
+			m := m
+			It("rejects "+m.rules, func() {
+				err := checkValidationRule(m.rules[strings.LastIndex(m.rules, ",")+1:])
+				Expect(err).To(HaveOccurred())
+				Ω(err.Error()).Should(Equal(m.err))
+			})
+		}
+
+		It("reports the field with malformed rule", func() {
+			type params struct {
+				Name    string `json:"name" validate:"required"`
+				Timeout int    `json:"timeout" validate:"range=4..thirty"`
+			}
+			err := checkValidationTags(params{})
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).Should(Equal("params.Timeout: rule 'range' has malformed upper bound 'thirty'"))
+		})
+
+		It("are valid for create params of all registered resource types", func() {
+			for _, resourceType := range ResourceTypes() {
+				Ω(checkValidationTags(resourceType.CreateParams)).Should(Succeed(), resourceType.Name)
+			}
+		})
+	})
+})